@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Limits of calculate_batch, configurable with the BATCH_MAX_EXPRESSIONS and BATCH_MAX_LENGTH
+// environment variables. Each expression is also limited to 500 characters, as in calculate.
+var (
+	maxBatchExpressions = envLimit("BATCH_MAX_EXPRESSIONS", 100)
+	maxBatchLength      = envLimit("BATCH_MAX_LENGTH", 20000) // characters in all expressions
+)
+
+// envLimit reads a positive integer from the environment, falling back to def when the
+// variable is unset or invalid
+func envLimit(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Ignoring %s=%q: expected a positive integer, using %d", name, value, def)
+		return def
+	}
+	return n
+}
+
+// batchItem is the outcome of one expression of calculate_batch: the fields calculate would
+// return for it, or its error message in result
+type batchItem struct {
+	Input string `json:"input" jsonschema:"The expression as given; expression holds it as parsed"`
+	OK    bool   `json:"ok" jsonschema:"Whether the expression was evaluated; when false, result holds the error message and error its details, if any"`
+	calculateOutput
+}
+
+// evaluateBatch evaluates the expressions in order against state, so that assignments and
+// definitions are seen by the expressions after them. A failed expression does not stop the
+// batch; cancellation does, and the items evaluated so far are returned with the error.
+func evaluateBatch(ctx context.Context, expressions []string, options calculateInput, state *sessionState) ([]batchItem, error) {
+	items := make([]batchItem, 0, len(expressions))
+	for _, expression := range expressions {
+		if err := ctx.Err(); err != nil {
+			return items, err
+		}
+		input := options
+		input.Expression = expression
+		result, output, _ := calculate(ctx, input, state)
+		item := batchItem{Input: expression, OK: result == nil || !result.IsError, calculateOutput: output}
+		if !item.OK {
+			for _, c := range result.Content {
+				if text, ok := c.(*mcp.TextContent); ok {
+					item.Result = text.Text
+					break
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestEnvLimit(t *testing.T) {
+	t.Setenv("TEST_BATCH_LIMIT", "25")
+	if got := envLimit("TEST_BATCH_LIMIT", 10); got != 25 {
+		t.Errorf("envLimit = %d, want 25", got)
+	}
+	for _, value := range []string{"", "0", "-3", "many"} {
+		t.Setenv("TEST_BATCH_LIMIT", value)
+		if got := envLimit("TEST_BATCH_LIMIT", 10); got != 10 {
+			t.Errorf("envLimit with %q = %d, want the default 10", value, got)
+		}
+	}
+}
+
+func TestEvaluateBatch(t *testing.T) {
+	state := newSessionState()
+	items, err := evaluateBatch(context.Background(), []string{"x = 3", "2x + 1", "1/0", "f(t) = t^2", "f(x) + ans", ""}, calculateInput{}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		ok     bool
+		result string
+	}{
+		{true, "Assigned: x = 3"},
+		{true, "Result: 2x + 1 = 7"},
+		{false, "Calculation error: division by zero is not allowed"},
+		{true, "Defined: f(t) = t^2"},
+		{true, "Result: f(x) + ans = 16"},
+		{false, "Expression cannot be empty"},
+	}
+	for i, w := range want {
+		if items[i].OK != w.ok || !strings.HasPrefix(items[i].Result, w.result) {
+			t.Errorf("item %d = %+v, want ok=%v and %q", i, items[i], w.ok, w.result)
+		}
+	}
+	if items[2].Error == nil || items[2].Error.Kind != errKindDivisionByZero {
+		t.Errorf("expected a structured error for 1/0, got %+v", items[2].Error)
+	}
+
+	// Mode options apply to every expression
+	items, _ = evaluateBatch(context.Background(), []string{"1/3 + 1/6", "sqrt(2)"}, calculateInput{Mode: "exact"}, newSessionState())
+	if !items[0].OK || items[0].Fraction != "1/2" || items[1].OK {
+		t.Errorf("unexpected exact mode items: %+v", items)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if items, err := evaluateBatch(ctx, []string{"1", "2"}, calculateInput{}, newSessionState()); err == nil || len(items) != 0 {
+		t.Errorf("expected cancellation, got %v, %v", items, err)
+	}
+}
+
+// cancelAfter is a context that reports cancellation once Err has been called n times
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCalculateBatchCancelled(t *testing.T) {
+	ctx := &cancelAfter{Context: context.Background(), n: 1}
+	res, out, _ := handleCalculateBatch(ctx, &mcp.CallToolRequest{}, calculateBatchInput{Expressions: []string{"1 + 1", "2 + 2"}})
+	if !res.IsError || len(out.Results) != 1 || out.Results[0].Value == nil || *out.Results[0].Value != 2 {
+		t.Fatalf("expected the item evaluated before the cancellation, got %+v", out)
+	}
+	if out.Result != "Batch cancelled after 1 of 2 expressions\n[1] Result: 1 + 1 = 2" {
+		t.Errorf("unexpected result text:\n%s", out.Result)
+	}
+}
+
+func TestCalculateBatchTool(t *testing.T) {
+	cs, _ := connectTestClient(t)
+	callTool(t, cs, "calculate", map[string]any{"expression": "base = 100"}, nil)
+
+	var out calculateBatchOutput
+	callTool(t, cs, "calculate_batch", map[string]any{
+		"expressions": []string{"base * (1 + rate)", "y = base * rate", "y / zero", "y * 2"},
+		"variables":   map[string]float64{"rate": 0.05},
+	}, &out)
+	if out.Succeeded != 3 || out.Failed != 1 || len(out.Results) != 4 {
+		t.Fatalf("unexpected output: %+v", out)
+	}
+	if out.Results[0].Result != "Result: base * (1 + rate) = 105" || out.Results[3].Result != "Result: y * 2 = 10" {
+		t.Errorf("unexpected results: %+v", out.Results)
+	}
+	if out.Results[0].Input != "base * (1 + rate)" || out.Results[0].Expression != "base*(1+rate)" {
+		t.Errorf("expected the expression as given and as parsed, got %+v", out.Results[0])
+	}
+	if out.Results[2].OK || out.Results[2].Error == nil || out.Results[2].Error.Kind != errKindUnknownIdentifier {
+		t.Errorf("expected an unknown identifier error, got %+v", out.Results[2])
+	}
+	if !strings.HasPrefix(out.Result, "Evaluated 3 of 4 expressions\n[1] Result: base * (1 + rate) = 105\n") {
+		t.Errorf("unexpected result text:\n%s", out.Result)
+	}
+
+	// Bindings and assignments do not reach the session
+	var vars variablesOutput
+	callTool(t, cs, "variables", map[string]any{}, &vars)
+	if _, ok := vars.Variables["rate"]; ok {
+		t.Errorf("the batch binding leaked into the session: %v", vars.Variables)
+	}
+	if _, ok := vars.Variables["y"]; ok {
+		t.Errorf("the batch assignment leaked into the session: %v", vars.Variables)
+	}
+
+	// Limits fail the whole batch
+	defer func(n, length int) { maxBatchExpressions, maxBatchLength = n, length }(maxBatchExpressions, maxBatchLength)
+	maxBatchExpressions, maxBatchLength = 3, 20
+	for _, args := range []map[string]any{
+		{"expressions": []string{}},
+		{"expressions": []string{"1", "2", "3", "4"}},
+		{"expressions": []string{"123456789 + 123456789", "1"}},
+		{"expressions": []string{"x"}, "variables": map[string]float64{"pi": 3}},
+	} {
+		if res := callTool(t, cs, "calculate_batch", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v, got %q", args, resultText(res))
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// maxExactFloatInt is the largest magnitude below which every integer is exactly representable as a float64
+const maxExactFloatInt = 1 << 53
+
+// integerArg converts x to an int64 if it is a whole number that fits
+func integerArg(x float64) (int64, bool) {
+	if x != math.Trunc(x) || math.Abs(x) >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(x), true
+}
+
+// lnFactorial returns ln(n!)
+func lnFactorial(n int64) float64 {
+	v, _ := math.Lgamma(float64(n) + 1)
+	return v
+}
+
+// fitsExact reports whether an integer of about lnSize = ln(value) fits within maxExactIntBits,
+// so that huge results are rejected before they are computed
+func fitsExact(lnSize float64) bool {
+	return lnSize/math.Ln2 <= maxExactIntBits
+}
+
+// factorialExact computes n! (step 1) or the double factorial n!! (step 2) for n >= 0, or for
+// n = -1 with step 2. ok is false when the result would exceed maxExactIntBits.
+func factorialExact(n, step int64) (result *big.Int, ok bool) {
+	if step == 1 {
+		if !fitsExact(lnFactorial(n)) {
+			return nil, false
+		}
+		return new(big.Int).MulRange(1, n), true
+	}
+	// n!! * (n-1)!! = n!, and n!! is the larger of the two
+	if !fitsExact((lnFactorial(n) + math.Log(float64(n)+1)) / 2) {
+		return nil, false
+	}
+	result = big.NewInt(1)
+	for k := n; k > 1; k -= 2 {
+		result.Mul(result, big.NewInt(k))
+	}
+	return result, true
+}
+
+// permutationsExact computes nPr = n! / (n-r)!, which is 0 when r > n
+func permutationsExact(n, r int64) (*big.Int, bool) {
+	if r > n {
+		return new(big.Int), true
+	}
+	if !fitsExact(lnFactorial(n) - lnFactorial(n-r)) {
+		return nil, false
+	}
+	return new(big.Int).MulRange(n-r+1, n), true
+}
+
+// combinationsExact computes nCr = n! / (r! (n-r)!), which is 0 when r > n
+func combinationsExact(n, r int64) (*big.Int, bool) {
+	if r > n {
+		return new(big.Int), true
+	}
+	if !fitsExact(lnFactorial(n) - lnFactorial(r) - lnFactorial(n-r)) {
+		return nil, false
+	}
+	return new(big.Int).Binomial(n, r), true
+}
+
+// countingArgs checks the arguments of nPr and nCr
+func countingArgs(name string, n, r float64) (int64, int64, error) {
+	ni, okN := integerArg(n)
+	ri, okR := integerArg(r)
+	if !okN || !okR || ni < 0 || ri < 0 {
+		return 0, 0, fmt.Errorf("%s requires non-negative integer arguments", name)
+	}
+	return ni, ri, nil
+}
+
+// countingFunction adapts nPr or nCr to the builtin signature. Results that float64 cannot hold
+// are +Inf; calculate then reports them exactly with exactIntegerResult.
+func countingFunction(name string, exact func(n, r int64) (*big.Int, bool)) builtinFunction {
+	return builtinFunction{minArgs: 2, maxArgs: 2, apply: func(args []float64) (float64, error) {
+		n, r, err := countingArgs(name, args[0], args[1])
+		if err != nil {
+			return 0, err
+		}
+		v, ok := exact(n, r)
+		if !ok {
+			return math.Inf(1), nil
+		}
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	}}
+}
+
+// factorialFloat computes x!, extended to non-integers by the gamma function: x! = Γ(x+1).
+// With double set it computes x!!, which is only defined here for integers x >= -1.
+func factorialFloat(x float64, double bool) (float64, error) {
+	n, integer := integerArg(x)
+	if double {
+		if !integer || n < -1 {
+			return 0, fmt.Errorf("double factorial requires an integer of at least -1")
+		}
+		v, ok := factorialExact(n, 2)
+		if !ok {
+			return math.Inf(1), nil
+		}
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	}
+
+	if integer && n < 0 {
+		return 0, fmt.Errorf("factorial is undefined for negative integers")
+	}
+	if integer && n <= 170 {
+		v, _ := factorialExact(n, 1)
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, nil
+	}
+	return math.Gamma(x + 1), nil
+}
+
+// usesCounting reports whether n contains a factorial, nPr or nCr
+func usesCounting(n node) bool {
+	switch n := n.(type) {
+	case *factorialNode:
+		return true
+	case *percentNode:
+		return usesCounting(n.operand)
+	case *unaryNode:
+		return usesCounting(n.operand)
+	case *binaryNode:
+		return usesCounting(n.left) || usesCounting(n.right)
+	case *conditionalNode:
+		return usesCounting(n.cond) || usesCounting(n.then) || usesCounting(n.otherwise)
+	case *callNode:
+		if n.name == "nPr" || n.name == "nCr" {
+			return true
+		}
+		for _, arg := range n.args {
+			if usesCounting(arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exactIntegerResult re-evaluates a counting expression whose float64 result is beyond the range
+// of exactly representable integers, or is NaN as 171! - 171! is in float64, returning all digits
+// of the exact integer result. It returns "" when the expression has no exact integer value, e.g.
+// because it divides unevenly, uses a function that is only available in float64 or exceeds
+// maxExactIntBits.
+func exactIntegerResult(expr string, vars map[string]float64, result float64) string {
+	if math.Abs(result) <= maxExactFloatInt && !math.IsInf(result, 0) {
+		return ""
+	}
+	stmt, err := parseStatement(expr)
+	if err != nil || !usesCounting(stmt.expr) || rejectLogical(stmt.expr) != nil {
+		return ""
+	}
+	v, err := newBigEvaluator(17, vars).evalTop(stmt.expr)
+	if err != nil || v.i == nil {
+		return ""
+	}
+	return v.i.String()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCounting(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"5!", 120},
+		{"0!", 1},
+		{"3!^2", 36},
+		{"2^3!", 64},
+		{"-3!", -6},
+		{"(2+1)!", 6},
+		{"7!!", 105},
+		{"8!!", 384},
+		{"0!!", 1},
+		{"0.5!", math.Sqrt(math.Pi) / 2},
+		{"(-0.5)!", math.Sqrt(math.Pi)},
+		{"nPr(5, 2)", 20},
+		{"nCr(5, 2)", 10},
+		{"nCr(52, 5)", 2598960},
+		{"nCr(3, 5)", 0},
+		{"5! != 120", 0},
+		{"171!", math.Inf(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := evaluateExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if result != tt.expected && math.Abs(result-tt.expected) > 1e-10 {
+				t.Errorf("%q: expected %v, got %v", tt.expr, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCountingErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"n!", errKindDomain, "n!"},
+		{"2.5!!", errKindDomain, "2.5!!"},
+		{"nPr(5.5, 2)", errKindDomain, "nPr(5.5, 2)"},
+		{"nCr(-1, 2)", errKindDomain, "nCr(-1, 2)"},
+		{"nCr(5)", errKindArity, "nCr(5)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := evaluateStatement(tt.expr, map[string]float64{"n": -3})
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestExactIntegerResult(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"25!", "15511210043330985984000000"},
+		{"nCr(100, 50)", "100891344545564193334812497256"},
+		{"200! / 198!", "39800"},
+		{"2 * nPr(30, 20)", "146193154658394542899200000"},
+		{"30! / 31", ""},
+		{"2^60", ""},
+		{"5!", ""},
+		{"171! - 171!", "0"},
+		{"171! / 170!", "171"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := evaluateExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if got := exactIntegerResult(tt.expr, nil, result); got != tt.expected {
+				t.Errorf("%q: expected %q, got %q", tt.expr, tt.expected, got)
+			}
+		})
+	}
+
+	// Exact results stop at maxExactIntBits, as documented: 5910! fits, 5911! does not
+	if got := exactIntegerResult("5910!", nil, math.Inf(1)); len(got) != 19726 {
+		t.Errorf("5910!: expected 19726 digits, got %d", len(got))
+	}
+	if got := exactIntegerResult("5911!", nil, math.Inf(1)); got != "" {
+		t.Errorf("5911!: expected no exact result, got %d digits", len(got))
+	}
+}
+
+func TestCountingInOtherModes(t *testing.T) {
+	if _, exact, err := evaluateStatementExact("nCr(6, 2) / 4!", nil); err != nil || exact.fraction != "5/8" {
+		t.Errorf("exact: expected 5/8, got %v (%v)", exact, err)
+	}
+	if _, str, _, err := evaluateStatementBig(context.Background(), "30!", nil, nil, 10); err != nil || str != "265252859812191058636308480000000" {
+		t.Errorf("precise: expected all digits of 30!, got %s (%v)", str, err)
+	}
+	if _, _, _, err := evaluateStatementBig(context.Background(), "0.5!", nil, nil, 10); err == nil {
+		t.Errorf("precise: expected the gamma extension to be unsupported")
+	}
+	if _, _, err := evaluateStatementInt("5!", nil, 32, true); err == nil {
+		t.Errorf("programmer: expected factorials to be unsupported")
+	}
+}
+
+func TestCalculateLargeFactorial(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "30!"}, &out)
+	if out.Result != "Result: 30! = 265252859812191058636308480000000" || out.Integer != "265252859812191058636308480000000" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// mathConstants is the single registry of named constants. It backs both the
+// math://constants resource and identifier lookup in expressions, so the two cannot drift.
+var mathConstants = map[string]float64{
+	"pi":    math.Pi,
+	"e":     math.E,
+	"phi":   math.Phi, // Golden ratio
+	"sqrt2": math.Sqrt2,
+	"ln2":   math.Ln2,
+	"ln10":  math.Ln10,
+}
+
+// constantNames returns the registered constant names in sorted order
+func constantNames() []string {
+	names := make([]string, 0, len(mathConstants))
+	for name := range mathConstants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// suggestion returns a "did you mean" hint for the candidate closest to name, or "" if none is close
+func suggestion(name string, candidates []string) string {
+	best := ""
+	bestDist, bestPrefix := 0, 0
+	for _, c := range candidates {
+		d, prefix := editDistance(name, c), commonPrefixLen(name, c)
+		// Ties are broken by the longer shared prefix, so "pii" suggests "pi" over "phi"
+		if best == "" || d < bestDist || (d == bestDist && prefix > bestPrefix) {
+			best, bestDist, bestPrefix = c, d, prefix
+		}
+	}
+	// Only suggest names that are plausibly typos rather than unrelated words. Every name of one
+	// character is within one edit of e, so single letters get no suggestion.
+	if len(name) <= 1 {
+		return ""
+	}
+	maxDist := 2
+	if len(name) <= 3 {
+		maxDist = 1
+	}
+	if best == "" || bestDist > maxDist {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean '%s'?)", best)
+}
+
+// editDistance computes the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
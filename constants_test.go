@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestConstantsInExpressions(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected float64
+	}{
+		{"pi", "pi", math.Pi},
+		{"circle_area", "pi*3^2", math.Pi * 9},
+		{"e", "ln(e)", 1},
+		{"phi", "phi^2-phi", 1},
+		{"sqrt2", "sqrt2^2", 2},
+		{"ln2", "exp(ln2)", 2},
+		{"ln10", "ln10/ln(10)", 1},
+		{"e_after_number", "2*e", 2 * math.E},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := evaluateExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error for expression %q: %v", tt.expr, err)
+			}
+			if math.Abs(result-tt.expected) > 1e-10 {
+				t.Errorf("expression %q: expected %v, got %v", tt.expr, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestUnknownIdentifierSuggestions(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"2*pii", "unknown variable or constant 'pii' (did you mean 'pi'?)"},
+		{"phy", "unknown variable or constant 'phy' (did you mean 'phi'?)"},
+		{"sqrt3", "unknown variable or constant 'sqrt3' (did you mean 'sqrt2'?)"},
+		{"velocity", "unknown variable or constant 'velocity'"},
+		{"2*y", "unknown variable or constant 'y'"},
+		{"sqrt", "function 'sqrt' must be called with arguments"},
+		{"sqr(4)", "unknown function 'sqr' at position 0 (did you mean 'sqrt'?)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := evaluateExpression(tt.expr)
+			if err == nil {
+				t.Fatalf("expected error for expression %q", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expression %q: expected error containing %q, got %q", tt.expr, tt.wantErr, err)
+			}
+			if !strings.Contains(tt.wantErr, "did you mean") && strings.Contains(err.Error(), "did you mean") {
+				t.Errorf("expression %q: unexpected suggestion in %q", tt.expr, err)
+			}
+		})
+	}
+}
+
+// TestMathConstantsResourceMatchesEvaluator ensures every published constant evaluates to the published value
+func TestMathConstantsResourceMatchesEvaluator(t *testing.T) {
+	res, err := handleMathConstants(context.Background(), &mcp.ReadResourceRequest{
+		Params: &mcp.ReadResourceParams{URI: "math://constants"},
+	})
+	if err != nil {
+		t.Fatalf("handleMathConstants failed: %v", err)
+	}
+
+	var published map[string]float64
+	if err := json.Unmarshal([]byte(res.Contents[0].Text), &published); err != nil {
+		t.Fatalf("invalid constants JSON: %v", err)
+	}
+	if len(published) != len(mathConstants) {
+		t.Errorf("resource publishes %d constants, registry has %d", len(published), len(mathConstants))
+	}
+
+	for name, want := range published {
+		got, err := evaluateExpression(name)
+		if err != nil {
+			t.Errorf("constant %q is published but not usable in expressions: %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("constant %q: resource has %v, evaluator has %v", name, want, got)
+		}
+	}
+}
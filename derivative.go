@@ -0,0 +1,302 @@
+package main
+
+import "fmt"
+
+// differentiator computes symbolic derivatives with respect to the variable x. Calls of the
+// session's user-defined functions in funcs are expanded into their bodies; depth counts nested
+// expansions and site is the outermost expanded call, where errors inside a body are reported.
+type differentiator struct {
+	x     string
+	funcs map[string]*userFunction
+	depth int
+	site  *callNode
+}
+
+// differentiate returns the simplified derivative of n with respect to x. Other identifiers are
+// treated as constants.
+func differentiate(n node, x string, funcs map[string]*userFunction) (node, error) {
+	d := &differentiator{x: x, funcs: funcs}
+	return d.diff(n)
+}
+
+// fail reports an error at n, or at the user-defined function call being expanded
+func (d *differentiator) fail(kind exprErrorKind, n node, format string, args ...any) error {
+	if d.site != nil {
+		n = d.site
+	}
+	return nodeError(kind, n, format, args...)
+}
+
+// constant reports whether n certainly does not depend on x. Calls of user-defined functions
+// are not constant, since their bodies may refer to x.
+func (d *differentiator) constant(n node) bool {
+	constant := true
+	walk(n, func(n node) {
+		switch n := n.(type) {
+		case *identNode:
+			if n.name == d.x {
+				constant = false
+			}
+		case *callNode:
+			if _, ok := d.funcs[n.name]; ok {
+				constant = false
+			}
+		}
+	})
+	return constant
+}
+
+func (d *differentiator) diff(n node) (node, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return literal(0), nil
+
+	case *identNode:
+		if n.name == d.x {
+			return literal(1), nil
+		}
+		return literal(0), nil
+
+	case *unaryNode:
+		if n.op == "not" {
+			return nil, d.fail(errKindUnsupported, n, "cannot differentiate the logical expression %s", formatNode(n))
+		}
+		du, err := d.diff(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "-" {
+			return symNeg(du), nil
+		}
+		return du, nil
+
+	case *percentNode:
+		du, err := d.diff(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		return symDiv(du, literal(100)), nil
+
+	case *factorialNode:
+		if d.constant(n) {
+			return literal(0), nil
+		}
+		return nil, d.fail(errKindUnsupported, n, "cannot differentiate the factorial %s with respect to %s", formatNode(n), d.x)
+
+	case *conditionalNode:
+		// Piecewise: the derivative of each branch, selected by the same condition
+		then, err := d.diff(n.then)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := d.diff(n.otherwise)
+		if err != nil {
+			return nil, err
+		}
+		if sameNode(then, otherwise) {
+			return then, nil
+		}
+		return &conditionalNode{cond: n.cond, then: then, otherwise: otherwise}, nil
+
+	case *binaryNode:
+		return d.diffBinary(n)
+
+	case *callNode:
+		return d.diffCall(n)
+	}
+
+	start, end := n.span()
+	return nil, newExprError(errKindSyntax, start, end, "unsupported expression node %T", n)
+}
+
+func (d *differentiator) diffBinary(n *binaryNode) (node, error) {
+	if isLogicalOperator(n.op) {
+		return nil, d.fail(errKindUnsupported, n, "cannot differentiate the logical expression %s", formatNode(n))
+	}
+	if relativePercent(n) {
+		// a + b% = a * (1 + b/100)
+		pct := n.right.(*percentNode)
+		factor := &binaryNode{op: n.op, left: literal(1), right: &binaryNode{op: "/", left: pct.operand, right: literal(100)}}
+		return d.diff(&binaryNode{op: "*", left: n.left, right: factor})
+	}
+	if n.op == "//" || n.op == "%" {
+		if d.constant(n) {
+			return literal(0), nil
+		}
+		return nil, d.fail(errKindUnsupported, n, "cannot differentiate %s with respect to %s: '%s' is not differentiable where it jumps", formatNode(n), d.x, n.op)
+	}
+
+	a, b := n.left, n.right
+	da, err := d.diff(a)
+	if err != nil {
+		return nil, err
+	}
+	db, err := d.diff(b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "+":
+		return symAdd(da, db), nil
+	case "-":
+		return symSub(da, db), nil
+	case "*":
+		return symAdd(symMul(da, b), symMul(a, db)), nil
+	case "/":
+		if isNumber(db, 0) {
+			return symDiv(da, b), nil
+		}
+		return symDiv(symSub(symMul(da, b), symMul(a, db)), symPow(b, literal(2))), nil
+	case "^":
+		switch {
+		case isNumber(db, 0):
+			// Power rule: (a^c)' = c * a^(c-1) * a'
+			return symMul(symMul(b, symPow(a, symSub(b, literal(1)))), da), nil
+		case isNumber(da, 0):
+			// Exponential rule: (c^b)' = c^b * ln(c) * b'
+			if id, ok := a.(*identNode); ok && id.name == "e" {
+				return symMul(n, db), nil
+			}
+			return symMul(symMul(n, symCall("ln", a)), db), nil
+		}
+		// (a^b)' = a^b * (b' * ln(a) + b * a' / a)
+		return symMul(n, symAdd(symMul(db, symCall("ln", a)), symDiv(symMul(b, da), a))), nil
+	}
+	return nil, d.fail(errKindUnsupported, n, "cannot differentiate the operator '%s'", n.op)
+}
+
+func (d *differentiator) diffCall(n *callNode) (node, error) {
+	fn, ok := builtinFunctions[n.name]
+	if !ok {
+		userFn, ok := d.funcs[n.name]
+		if !ok {
+			return nil, d.fail(errKindUnknownFunction, n, "unknown function '%s'%s", n.name, suggestion(n.name, append(builtinFunctionNames(), sortedKeys(d.funcs)...)))
+		}
+		return d.diffUser(n, userFn)
+	}
+	if err := fn.checkArity(n.name, len(n.args)); err != nil {
+		return nil, d.fail(errKindArity, n, "%v", err)
+	}
+	if d.constant(n) {
+		return literal(0), nil
+	}
+
+	u := n.args[0]
+	du, err := d.diff(u)
+	if err != nil {
+		return nil, err
+	}
+	one, two := literal(1), literal(2)
+
+	// chain multiplies the derivative of the function at u by u'
+	chain := func(outer node) (node, error) { return symMul(outer, du), nil }
+	switch n.name {
+	case "sqrt":
+		return symDiv(du, symMul(two, n)), nil
+	case "cbrt":
+		return symDiv(du, symMul(literal(3), symPow(n, two))), nil
+	case "abs":
+		return chain(symDiv(u, n))
+	case "exp":
+		return chain(n)
+	case "ln":
+		return symDiv(du, u), nil
+	case "log10":
+		return symDiv(du, symMul(u, symCall("ln", literal(10)))), nil
+	case "log":
+		if len(n.args) == 1 {
+			return symDiv(du, u), nil
+		}
+		// log(u, b) = ln(u) / ln(b)
+		return d.diff(&binaryNode{op: "/", left: symCall("ln", u), right: symCall("ln", n.args[1])})
+	case "sin":
+		return chain(symCall("cos", u))
+	case "cos":
+		return chain(symNeg(symCall("sin", u)))
+	case "tan":
+		return symDiv(du, symPow(symCall("cos", u), two)), nil
+	case "asin":
+		return symDiv(du, symCall("sqrt", symSub(one, symPow(u, two)))), nil
+	case "acos":
+		return symNeg(symDiv(du, symCall("sqrt", symSub(one, symPow(u, two))))), nil
+	case "atan":
+		return symDiv(du, symAdd(one, symPow(u, two))), nil
+	case "atan2":
+		// atan2(y, x)' = (x*y' - y*x') / (x^2 + y^2)
+		x := n.args[1]
+		dx, err := d.diff(x)
+		if err != nil {
+			return nil, err
+		}
+		return symDiv(symSub(symMul(x, du), symMul(u, dx)), symAdd(symPow(x, two), symPow(u, two))), nil
+	case "sinh":
+		return chain(symCall("cosh", u))
+	case "cosh":
+		return chain(symCall("sinh", u))
+	case "tanh":
+		return symDiv(du, symPow(symCall("cosh", u), two)), nil
+	case "asinh":
+		return symDiv(du, symCall("sqrt", symAdd(symPow(u, two), one))), nil
+	case "acosh":
+		return symDiv(du, symCall("sqrt", symSub(symPow(u, two), one))), nil
+	case "atanh":
+		return symDiv(du, symSub(one, symPow(u, two))), nil
+	case "floor", "ceil", "round":
+		return nil, d.fail(errKindUnsupported, n, "cannot differentiate %s: it is piecewise constant and jumps where its argument crosses an integer", formatNode(n))
+	}
+	return nil, d.fail(errKindUnsupported, n, "cannot differentiate %s with respect to %s", formatNode(n), d.x)
+}
+
+// diffUser differentiates a call of a user-defined function by expanding its body with the
+// arguments in place of the parameters
+func (d *differentiator) diffUser(n *callNode, fn *userFunction) (node, error) {
+	if len(n.args) != len(fn.params) {
+		return nil, d.fail(errKindArity, n, "function '%s' expects %s, got %d", fn.signature(), pluralArgs(len(fn.params)), len(n.args))
+	}
+	if d.depth >= maxCallDepth {
+		return nil, d.fail(errKindRecursionLimit, n, "maximum call depth of %d exceeded expanding %s; recursive functions can only be differentiated where the recursion is bounded", maxCallDepth, fn.signature())
+	}
+
+	values := make(map[string]node, len(fn.params))
+	for i, param := range fn.params {
+		values[param] = n.args[i]
+	}
+	if d.site == nil {
+		d.site = n
+		defer func() { d.site = nil }()
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	return d.diff(substitute(fn.body, values))
+}
+
+// derivativeLabel names the order-th derivative with respect to x, e.g. d/dx or d^2/dx^2
+func derivativeLabel(x string, order int) string {
+	if order == 1 {
+		return "d/d" + x
+	}
+	return fmt.Sprintf("d^%d/d%s^%d", order, x, order)
+}
+
+// checkVariable validates the name of the variable a symbolic or numeric method works on
+func checkVariable(name string) error {
+	if name == "" || !isIdentStart(name[0]) {
+		return fmt.Errorf("variable '%s' must be an identifier such as x or t", name)
+	}
+	for i := 1; i < len(name); i++ {
+		if !isIdentPart(name[i]) {
+			return fmt.Errorf("variable '%s' must be an identifier such as x or t", name)
+		}
+	}
+	if keywords[name] {
+		return fmt.Errorf("'%s' is a keyword, not a variable", name)
+	}
+	if _, ok := mathConstants[name]; ok {
+		return fmt.Errorf("'%s' is a constant, not a variable", name)
+	}
+	if _, ok := builtinFunctions[name]; ok {
+		return fmt.Errorf("'%s' is a function, not a variable", name)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDifferentiate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"x^3 + 2x", "3*x^2+2"},
+		{"5", "0"},
+		{"a*x^2 + b*x + c", "2*a*x+b"},
+		{"-x^2", "-2*x"},
+		{"1/x", "-1/x^2"},
+		{"5/x^2", "-10/x^3"},
+		{"x/3", "1/3"},
+		{"sin(x)*exp(2x)", "cos(x)*exp(2*x)+2*sin(x)*exp(2*x)"},
+		{"ln(x)/x", "(1-ln(x))/x^2"},
+		{"sqrt(x^2+1)", "x/sqrt(x^2+1)"},
+		{"cos(x)^2", "-2*cos(x)*sin(x)"},
+		{"tan(x)", "1/cos(x)^2"},
+		{"2^x", "2^x*ln(2)"},
+		{"e^(3x)", "3*e^(3*x)"},
+		{"x^x", "x^x*(ln(x)+1)"},
+		{"log(x, 2)", "1/(x*ln(2))"},
+		{"atan(x)", "1/(1+x^2)"},
+		{"x > 0 ? x^2 : -x", "x > 0 ? 2*x : -1"},
+		{"200 + x%", "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := parseExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			d, err := differentiate(n, "x", nil)
+			if err != nil {
+				t.Fatalf("differentiate: %v", err)
+			}
+			if got := formatNode(d); got != tt.want {
+				t.Errorf("d/dx %s = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDifferentiateMatchesFiniteDifferences checks derivatives numerically against a central
+// difference quotient
+func TestDifferentiateMatchesFiniteDifferences(t *testing.T) {
+	exprs := []string{
+		"x^4 - 3x^2 + x", "sin(2x)*cos(x)", "exp(-x^2)", "ln(x^2 + 1)", "x/(1 + x^2)",
+		"sqrt(x)", "cbrt(x + 2)", "abs(x - 3)", "asin(x/2)", "acos(x/3)", "atan2(x, 2)",
+		"sinh(x)*cosh(x)", "tanh(x)", "asinh(x)", "acosh(x + 2)", "atanh(x/2)",
+		"log10(x)", "x^sin(x)", "2^(x^2)", "(x^2 - 1)/(x + 3)", "tan(x/2)",
+	}
+	const h = 1e-6
+	for _, expr := range exprs {
+		n, err := parseExpression(expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", expr, err)
+		}
+		d, err := differentiate(n, "x", nil)
+		if err != nil {
+			t.Fatalf("differentiate %s: %v", expr, err)
+		}
+		for _, x := range []float64{0.4, 1.3} {
+			at := func(n node, x float64) float64 {
+				v, err := (&evaluator{vars: map[string]float64{"x": x}}).eval(n)
+				if err != nil {
+					t.Fatalf("evaluating %s at %v: %v", formatNode(n), x, err)
+				}
+				return v
+			}
+			want := (at(n, x+h) - at(n, x-h)) / (2 * h)
+			if got := at(d, x); math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+				t.Errorf("d/dx %s at %v = %v (%s), finite difference %v", expr, x, got, formatNode(d), want)
+			}
+		}
+	}
+}
+
+func TestDifferentiateUserFunctions(t *testing.T) {
+	f, _, err := parseDefinition("f(t) = t^2 + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := parseExpression("f(3x)")
+	d, err := differentiate(n, "x", map[string]*userFunction{"f": f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatNode(d); got != "18*x" {
+		t.Errorf("d/dx f(3x) = %s, want 18*x", got)
+	}
+}
+
+func TestDifferentiateErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		msg  string
+	}{
+		{"floor(x)", errKindUnsupported, "piecewise constant"},
+		{"x!", errKindUnsupported, "factorial"},
+		{"x % 2", errKindUnsupported, "not differentiable"},
+		{"x > 1", errKindUnsupported, "logical expression"},
+		{"sinn(x)", errKindUnknownFunction, "did you mean 'sin'"},
+		{"atan2(x)", errKindArity, "expects"},
+	}
+	for _, tt := range tests {
+		n, err := parseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.expr, err)
+		}
+		_, err = differentiate(n, "x", nil)
+		e := asExprError(err, errKindSyntax)
+		if err == nil || e.Kind != tt.kind || !strings.Contains(e.Message, tt.msg) {
+			t.Errorf("d/dx %s: got %v, want %s error containing %q", tt.expr, err, tt.kind, tt.msg)
+		}
+	}
+
+	// Constant subexpressions are not rejected
+	n, _ := parseExpression("floor(2.5)*x + 4!")
+	if d, err := differentiate(n, "x", nil); err != nil || formatNode(d) != "floor(2.5)" {
+		t.Errorf("d/dx floor(2.5)*x + 4! = %v, %v; want floor(2.5)", d, err)
+	}
+}
+
+func TestDifferentiateTool(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out differentiateOutput
+	callTool(t, cs, "differentiate", map[string]any{"expression": "x^3 + 2x", "at": 2}, &out)
+	if out.Derivative != "3*x^2+2" || out.Value == nil || *out.Value != 14 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = differentiateOutput{}
+	callTool(t, cs, "differentiate", map[string]any{"expression": "t^4", "variable": "t", "order": 2}, &out)
+	if out.Derivative != "12*t^2" || !strings.HasPrefix(out.Result, "d^2/dt^2 (t^4) = ") {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	// Session functions are expanded
+	callTool(t, cs, "calculate", map[string]any{"expression": "g(u) = sin(u)^2"}, nil)
+	out = differentiateOutput{}
+	callTool(t, cs, "differentiate", map[string]any{"expression": "g(x)"}, &out)
+	if out.Derivative != "2*cos(x)*sin(x)" {
+		t.Errorf("d/dx g(x) = %s, want 2*cos(x)*sin(x)", out.Derivative)
+	}
+
+	// Like terms left by the product rule are combined
+	out = differentiateOutput{}
+	callTool(t, cs, "differentiate", map[string]any{"expression": "(x+1)*(x-1)"}, &out)
+	if out.Derivative != "2*x" {
+		t.Errorf("d/dx (x+1)*(x-1) = %s, want 2*x", out.Derivative)
+	}
+
+	res := callTool(t, cs, "differentiate", map[string]any{"expression": "ln(x)", "at": 0}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "division by zero") {
+		t.Errorf("expected an evaluation error at 0, got %q", resultText(res))
+	}
+
+	for _, args := range []map[string]any{
+		{"expression": "x^2", "variable": "pi"},
+		{"expression": "x^2", "variable": "2x"},
+		{"expression": "x^2", "order": 11},
+		{"expression": "round(x)"},
+	} {
+		if res := callTool(t, cs, "differentiate", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v, got %q", args, resultText(res))
+		}
+	}
+}
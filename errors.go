@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// exprErrorKind classifies expression errors so clients can react without parsing messages
+type exprErrorKind string
+
+const (
+	errKindSyntax            exprErrorKind = "syntax"
+	errKindInvalidCharacter  exprErrorKind = "invalid_character"
+	errKindUnknownIdentifier exprErrorKind = "unknown_identifier"
+	errKindUnknownFunction   exprErrorKind = "unknown_function"
+	errKindArity             exprErrorKind = "arity"
+	errKindDomain            exprErrorKind = "domain"
+	errKindDivisionByZero    exprErrorKind = "division_by_zero"
+	errKindInvalidAssignment exprErrorKind = "invalid_assignment"
+	errKindInvalidResult     exprErrorKind = "invalid_result"
+	errKindUnsupported       exprErrorKind = "unsupported"
+	errKindInvalidDefinition exprErrorKind = "invalid_definition"
+	errKindRecursionLimit    exprErrorKind = "recursion_limit"
+	errKindDimension         exprErrorKind = "dimension"
+	errKindSingular          exprErrorKind = "singular"
+)
+
+// exprError is an error located in the original expression. Start and End are byte offsets
+// (End exclusive); a zero-width error such as an unexpected end of input has Start == End.
+type exprError struct {
+	Kind     exprErrorKind `json:"kind" jsonschema:"Error category: syntax, invalid_character, unknown_identifier, unknown_function, arity, domain, division_by_zero, invalid_assignment, invalid_result, unsupported, invalid_definition, recursion_limit, dimension or singular"`
+	Message  string        `json:"message" jsonschema:"Human-readable description of the problem"`
+	Start    int           `json:"start" jsonschema:"Byte offset in the expression where the problem starts"`
+	End      int           `json:"end" jsonschema:"Byte offset in the expression where the problem ends (exclusive)"`
+	Expected []string      `json:"expected,omitempty" jsonschema:"Tokens that would have been valid at this position, for syntax errors"`
+}
+
+func (e *exprError) Error() string {
+	return e.Message
+}
+
+// newExprError creates an error covering [start, end) of the expression
+func newExprError(kind exprErrorKind, start, end int, format string, args ...any) *exprError {
+	return &exprError{Kind: kind, Message: fmt.Sprintf(format, args...), Start: start, End: end}
+}
+
+// nodeError creates an error covering the source span of n
+func nodeError(kind exprErrorKind, n node, format string, args ...any) *exprError {
+	start, end := n.span()
+	return newExprError(kind, start, end, format, args...)
+}
+
+// tokenError creates an error covering a single token
+func tokenError(kind exprErrorKind, t token, format string, args ...any) *exprError {
+	return newExprError(kind, t.pos, t.pos+len(t.text), format, args...)
+}
+
+// withExpected records the tokens that would have been accepted
+func (e *exprError) withExpected(expected ...string) *exprError {
+	e.Expected = expected
+	return e
+}
+
+// asExprError returns err as an *exprError, wrapping other errors as an unlocated error of the given kind
+func asExprError(err error, kind exprErrorKind) *exprError {
+	var e *exprError
+	if errors.As(err, &e) {
+		return e
+	}
+	return &exprError{Kind: kind, Message: err.Error()}
+}
+
+// render formats the error with the expression and a caret line marking the problem:
+//
+//	unexpected '*' at position 4
+//	  2 + * 3
+//	      ^
+func (e *exprError) render(expr string) string {
+	// Tabs and newlines would misalign the caret, so show them as spaces
+	line := strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, expr)
+
+	start := min(max(e.Start, 0), len(expr))
+	end := min(max(e.End, start), len(expr))
+	col := utf8.RuneCountInString(expr[:start])
+	width := max(utf8.RuneCountInString(expr[start:end]), 1)
+
+	return fmt.Sprintf("%s\n  %s\n  %s%s", e.Message, line, strings.Repeat(" ", col), strings.Repeat("^", width))
+}
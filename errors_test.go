@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExprErrorLocations(t *testing.T) {
+	tests := []struct {
+		expr     string
+		kind     exprErrorKind
+		text     string // the part of expr covered by [Start, End)
+		expected []string
+	}{
+		{"2 + * 3", errKindSyntax, "*", expectedOperand},
+		{"(1 + (2 & 3))", errKindInvalidCharacter, "&", nil},
+		{"(1+2))", errKindSyntax, ")", []string{"operator", "end of expression"}},
+		{"sqrt(4", errKindSyntax, "", []string{")"}},
+		{"2 +", errKindSyntax, "+", expectedOperand},
+		{"1 + ()", errKindSyntax, "()", expectedOperand},
+		{"1 + 2*pii", errKindUnknownIdentifier, "pii", nil},
+		{"sqr(4) + 1", errKindUnknownFunction, "sqr", nil},
+		{"1 + sqrt(1, 2)", errKindArity, "sqrt(1, 2)", nil},
+		{"2 * ln(0)", errKindDomain, "ln(0)", nil},
+		{"1 + 5/(3-3)", errKindDivisionByZero, "3-3", nil},
+		{"7 % 0", errKindDivisionByZero, "0", nil},
+		{"pi = 3", errKindInvalidAssignment, "pi", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := evaluateStatement(tt.expr, nil)
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q [%d:%d]", tt.text, got, e.Start, e.End)
+			}
+			if !reflect.DeepEqual(e.Expected, tt.expected) {
+				t.Errorf("expected tokens %v, got %v", tt.expected, e.Expected)
+			}
+		})
+	}
+}
+
+func TestExprErrorRender(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"2 + * 3", "unexpected '*' at position 4\n  2 + * 3\n      ^"},
+		{"1 + 5/(3-3)", "division by zero is not allowed\n  1 + 5/(3-3)\n         ^^^"},
+		{"sqrt(4", "mismatched parentheses: missing closing parenthesis\n  sqrt(4\n        ^"},
+		{"1 + π", "invalid character 'π' at position 4\n  1 + π\n      ^"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := evaluateStatement(tt.expr, nil)
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if got := e.render(tt.expr); got != tt.expected {
+				t.Errorf("unexpected rendering:\n%s\nwant:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCalculateStructuredError(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	res := callTool(t, cs, "calculate", map[string]any{"expression": "2 + * 3"}, &out)
+	if !res.IsError {
+		t.Fatalf("expected an error result")
+	}
+	if out.Error == nil {
+		t.Fatalf("expected structured error in output")
+	}
+	if out.Error.Kind != errKindSyntax || out.Error.Start != 4 || out.Error.End != 5 {
+		t.Errorf("unexpected structured error: %+v", out.Error)
+	}
+	if want := "Calculation error: unexpected '*' at position 4\n  2 + * 3\n      ^"; resultText(res) != want {
+		t.Errorf("unexpected text content:\n%s", resultText(res))
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// evaluator walks an expression AST. vars holds session variables and may be nil.
+// Inside a user-defined function, locals holds the parameters and depth the call depth; calls
+// counts the function calls of the whole evaluation. Calls stop once ctx, if set, is cancelled.
+// tolerance is the largest difference for which == considers two numbers equal.
+type evaluator struct {
+	ctx       context.Context
+	vars      map[string]float64
+	locals    map[string]float64
+	funcs     map[string]*userFunction
+	depth     int
+	calls     *int
+	tolerance float64
+}
+
+// boundEvaluator evaluates expressions at values of one variable x, such as the unknown of solve
+// or the variable of integration, on top of the session variables in vars, which it updates.
+// It counts the evaluations and stops once ctx is cancelled.
+type boundEvaluator struct {
+	ctx         context.Context
+	x           string
+	vars        map[string]float64
+	funcs       map[string]*userFunction
+	evaluations int
+}
+
+// eval evaluates n with x set to v
+func (b *boundEvaluator) eval(n node, v float64) (float64, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	b.vars[b.x] = v
+	b.evaluations++
+	return (&evaluator{ctx: b.ctx, vars: b.vars, funcs: b.funcs}).eval(n)
+}
+
+// evalFinite is eval for methods that need a finite value at every point, such as integration:
+// errors and results that are not finite are reported together with the value of x
+func (b *boundEvaluator) evalFinite(n node, v float64) (float64, error) {
+	result, err := b.eval(n, v)
+	if err != nil {
+		var e *exprError
+		if errors.As(err, &e) {
+			located := *e
+			located.Message = fmt.Sprintf("at %s = %s: %s", b.x, formatResult(v), e.Message)
+			return 0, &located
+		}
+		return 0, err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, nodeError(errKindInvalidResult, n, "%s is not finite at %s = %s", formatNode(n), b.x, formatResult(v))
+	}
+	return result, nil
+}
+
+// evaluateExpression evaluates a mathematical expression with proper operator precedence and parentheses support
+func evaluateExpression(expr string) (float64, error) {
+	n, err := parseExpression(expr)
+	if err != nil {
+		return 0, err
+	}
+	return (&evaluator{}).eval(n)
+}
+
+// evaluateStatement evaluates either an expression or an assignment of the form "name = expression"
+// against the given variables. It returns the assigned name, or "" for a plain expression.
+// vars is only read; storing the assignment is left to the caller.
+func evaluateStatement(expr string, vars map[string]float64) (string, float64, error) {
+	target, result, _, err := evaluateSessionStatement(context.Background(), expr, vars, nil, 0)
+	return target, result, err
+}
+
+// evaluateSessionStatement is evaluateStatement with the session's user-defined functions and
+// the tolerance for ==, until ctx is cancelled. It also reports whether the result is a truth
+// value (1 or 0).
+func evaluateSessionStatement(ctx context.Context, expr string, vars map[string]float64, funcs map[string]*userFunction, tolerance float64) (string, float64, bool, error) {
+	stmt, err := parseStatement(expr)
+	if err != nil {
+		return "", 0, false, err
+	}
+	result, err := (&evaluator{ctx: ctx, vars: vars, funcs: funcs, tolerance: tolerance}).eval(stmt.expr)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return stmt.target, result, isBoolean(stmt.expr), nil
+}
+
+// eval computes the value of n
+func (ev *evaluator) eval(n node) (float64, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return n.value, nil
+
+	case *identNode:
+		return ev.lookupIdentifier(n)
+
+	case *unaryNode:
+		val, err := ev.eval(n.operand)
+		if err != nil {
+			return 0, err
+		}
+		switch n.op {
+		case "-":
+			return -val, nil
+		case "not":
+			return truth(val == 0), nil
+		}
+		return val, nil
+
+	case *conditionalNode:
+		return ev.evalConditional(n)
+
+	case *percentNode:
+		val, err := ev.eval(n.operand)
+		return val / 100, err
+
+	case *factorialNode:
+		val, err := ev.eval(n.operand)
+		if err != nil {
+			return 0, err
+		}
+		result, err := factorialFloat(val, n.double)
+		if err != nil {
+			return 0, nodeError(errKindDomain, n, "%v", err)
+		}
+		return result, nil
+
+	case *binaryNode:
+		if isLogicalOperator(n.op) {
+			return ev.evalLogical(n)
+		}
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return 0, err
+		}
+		if relativePercent(n) {
+			right *= left
+		}
+		result, err := applyBinary(n.op, left, right)
+		if err != nil {
+			// Division by zero points at the divisor, anything else at the operator
+			if errors.Is(err, errDivisionByZero) || errors.Is(err, errModuloByZero) {
+				return 0, nodeError(errKindDivisionByZero, n.right, "%v", err)
+			}
+			return 0, newExprError(errKindSyntax, n.opPos, n.opPos+len(n.op), "%v", err)
+		}
+		return result, nil
+
+	case *callNode:
+		fn, ok := builtinFunctions[n.name]
+		if !ok {
+			if userFn, ok := ev.funcs[n.name]; ok {
+				return ev.callUser(n, userFn)
+			}
+			// A name followed by '(' is always a call, so x(x+1) needs an explicit '*'
+			_, isVar := ev.vars[n.name]
+			_, isLocal := ev.locals[n.name]
+			if isVar || isLocal {
+				return 0, newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+					"'%s' is a variable, not a function; write %s*(...) to multiply", n.name, n.name)
+			}
+			return 0, newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+				"unknown function '%s' at position %d%s", n.name, n.start, suggestion(n.name, append(builtinFunctionNames(), sortedKeys(ev.funcs)...)))
+		}
+		if err := fn.checkArity(n.name, len(n.args)); err != nil {
+			return 0, nodeError(errKindArity, n, "%v", err)
+		}
+		args := make([]float64, len(n.args))
+		for i, arg := range n.args {
+			val, err := ev.eval(arg)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = val
+		}
+		result, err := fn.apply(args)
+		if err != nil {
+			return 0, nodeError(errKindDomain, n, "%s: %v", n.name, err)
+		}
+		return result, nil
+	}
+
+	start, end := n.span()
+	return 0, newExprError(errKindSyntax, start, end, "unsupported expression node %T", n)
+}
+
+var (
+	errDivisionByZero = errors.New("division by zero is not allowed")
+	errModuloByZero   = errors.New("modulo by zero is not allowed")
+)
+
+// applyBinary applies an arithmetic operator to two operands
+func applyBinary(op string, left, right float64) (float64, error) {
+	switch op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, errDivisionByZero
+		}
+		return left / right, nil
+	case "//":
+		if right == 0 {
+			return 0, errDivisionByZero
+		}
+		return math.Floor(left / right), nil
+	case "%":
+		if right == 0 {
+			return 0, errModuloByZero
+		}
+		return floorMod(left, right), nil
+	case "^":
+		if left == 0 && right < 0 {
+			return 0, errDivisionByZero
+		}
+		return math.Pow(left, right), nil
+	}
+	return 0, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// floorMod returns the remainder of a / b with the sign of b, so that a == floor(a/b)*b + floorMod(a, b)
+func floorMod(a, b float64) float64 {
+	m := math.Mod(a, b)
+	if m != 0 && (m < 0) != (b < 0) {
+		m += b
+	}
+	return m
+}
+
+// lookupIdentifier resolves a session variable or named constant, suggesting the closest known name when it is unknown
+func (ev *evaluator) lookupIdentifier(n *identNode) (float64, error) {
+	name := n.name
+	if val, ok := ev.locals[name]; ok {
+		return val, nil
+	}
+	if val, ok := ev.vars[name]; ok {
+		return val, nil
+	}
+	if val, ok := mathConstants[name]; ok {
+		return val, nil
+	}
+	if _, ok := builtinFunctions[name]; ok {
+		return 0, nodeError(errKindUnknownIdentifier, n, "function '%s' must be called with arguments, e.g. %s(x)", name, name)
+	}
+
+	candidates := constantNames()
+	for v := range ev.vars {
+		candidates = append(candidates, v)
+	}
+	for v := range ev.locals {
+		candidates = append(candidates, v)
+	}
+	sort.Strings(candidates)
+	hint := suggestion(name, candidates)
+	if imaginaryUnits[name] {
+		hint = " (set mode 'complex' to use it as the imaginary unit)"
+	}
+	return 0, nodeError(errKindUnknownIdentifier, n, "unknown variable or constant '%s'%s", name, hint)
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxPrecisionDigits bounds the precision argument of calculate
+	maxPrecisionDigits = 1000
+	// maxExactIntBits bounds exact integer results; larger results overflow to ±Inf like float64 does
+	maxExactIntBits = 1 << 16
+	// maxBigExponent is the exponent range of precision arithmetic, as ±1024 is that of float64:
+	// a result of magnitude 2^maxBigExponent or more overflows to ±Inf, and one below
+	// 2^-maxBigExponent underflows to 0, so that e.g. exp(10^8) does not take minutes to print
+	maxBigExponent = 1 << 16
+	// precisionGuardBits are carried beyond the requested precision to absorb rounding in intermediate steps
+	precisionGuardBits = 32
+)
+
+// bigValue is a number in arbitrary-precision mode: an exact integer when i is set, otherwise f
+type bigValue struct {
+	i *big.Int
+	f *big.Float
+}
+
+// bigEvaluator evaluates an AST with math/big. Integer-only arithmetic stays exact;
+// everything else is computed with prec bits of mantissa. It stops once ctx is cancelled.
+type bigEvaluator struct {
+	ctx   context.Context
+	prec  uint
+	vars  map[string]float64
+	funcs map[string]*userFunction // only to report that they are unsupported
+}
+
+// newBigEvaluator creates an evaluator for the given number of significant decimal digits
+func newBigEvaluator(digits int, vars map[string]float64) *bigEvaluator {
+	return &bigEvaluator{
+		ctx:  context.Background(),
+		prec: uint(math.Ceil(float64(digits)*math.Log2(10))) + precisionGuardBits,
+		vars: vars,
+	}
+}
+
+// evaluateStatementBig is the arbitrary-precision counterpart of evaluateStatement. It returns the
+// assigned name, the result as a decimal string with the requested significant digits (or all digits
+// for exact integers) and the float64 nearest to that string, for storing in session variables.
+func evaluateStatementBig(ctx context.Context, expr string, vars map[string]float64, funcs map[string]*userFunction, digits int) (string, string, float64, error) {
+	stmt, err := parseStatement(expr)
+	if err == nil {
+		err = rejectLogical(stmt.expr)
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	ev := newBigEvaluator(digits, vars)
+	ev.ctx, ev.funcs = ctx, funcs
+	v, err := ev.evalTop(stmt.expr)
+	if errors.Is(err, errNaNResult) {
+		return "", "", 0, newExprError(errKindInvalidResult, 0, len(expr), "%v", err)
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	if v.i != nil {
+		f, _ := new(big.Float).SetInt(v.i).Float64()
+		return stmt.target, v.i.String(), f, nil
+	}
+	v.f = ev.bounded(v.f)
+	// The float64 is read back from the digits, so that it does not carry the guard bits' rounding
+	// error: 1/3 to 5 digits gives 0.33333, not 0.333333333333333
+	text := v.f.Text('g', digits)
+	f, _ := strconv.ParseFloat(text, 64)
+	return stmt.target, text, f, nil
+}
+
+// errNaNResult reports a result that is not a number, e.g. Inf - Inf
+var errNaNResult = errors.New("Calculation resulted in an invalid number (NaN)")
+
+// evalTop evaluates n, converting the NaN panics of math/big into errNaNResult
+func (ev *bigEvaluator) evalTop(n node) (v bigValue, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			err = errNaNResult
+		}
+	}()
+	return ev.eval(n)
+}
+
+// bounded returns f, or ±Inf or 0 if its binary exponent is beyond maxBigExponent
+func (ev *bigEvaluator) bounded(f *big.Float) *big.Float {
+	if f.IsInf() || f.Sign() == 0 {
+		return f
+	}
+	switch e := f.MantExp(nil); {
+	case e > maxBigExponent:
+		return ev.newFloat().SetInf(f.Sign() < 0)
+	case e < -maxBigExponent:
+		return ev.newFloat()
+	}
+	return f
+}
+
+func (ev *bigEvaluator) newFloat() *big.Float {
+	return new(big.Float).SetPrec(ev.prec)
+}
+
+// float returns v as a big.Float at the evaluator's precision
+func (ev *bigEvaluator) float(v bigValue) *big.Float {
+	if v.i != nil {
+		return ev.newFloat().SetInt(v.i)
+	}
+	return v.f
+}
+
+// intValue wraps an exact integer, overflowing to ±Inf when it exceeds maxExactIntBits
+func (ev *bigEvaluator) intValue(i *big.Int) bigValue {
+	if i.BitLen() > maxExactIntBits {
+		return bigValue{f: ev.newFloat().SetInf(i.Sign() < 0)}
+	}
+	return bigValue{i: i}
+}
+
+func (ev *bigEvaluator) eval(n node) (bigValue, error) {
+	if err := ev.ctx.Err(); err != nil {
+		return bigValue{}, err
+	}
+	switch n := n.(type) {
+	case *numberNode:
+		if i, ok := new(big.Int).SetString(n.text, 10); ok {
+			return ev.intValue(i), nil
+		}
+		f, _, err := big.ParseFloat(n.text, 10, ev.prec, big.ToNearestEven)
+		if err != nil {
+			return bigValue{}, nodeError(errKindSyntax, n, "invalid number format: %s", n.text)
+		}
+		return bigValue{f: f}, nil
+
+	case *identNode:
+		return ev.lookupIdentifier(n)
+
+	case *unaryNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return bigValue{}, err
+		}
+		if n.op == "+" {
+			return v, nil
+		}
+		if v.i != nil {
+			return bigValue{i: new(big.Int).Neg(v.i)}, nil
+		}
+		return bigValue{f: ev.newFloat().Neg(v.f)}, nil
+
+	case *percentNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return bigValue{}, err
+		}
+		return ev.applyBinary("/", v, bigValue{i: big.NewInt(100)})
+
+	case *factorialNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return bigValue{}, err
+		}
+		return ev.factorial(n, v)
+
+	case *binaryNode:
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return bigValue{}, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return bigValue{}, err
+		}
+		if relativePercent(n) {
+			if right, err = ev.applyBinary("*", left, right); err != nil {
+				return bigValue{}, nodeError(errKindDomain, n, "%v", err)
+			}
+		}
+		result, err := ev.applyBinary(n.op, left, right)
+		if err != nil {
+			if errors.Is(err, errDivisionByZero) || errors.Is(err, errModuloByZero) {
+				return bigValue{}, nodeError(errKindDivisionByZero, n.right, "%v", err)
+			}
+			return bigValue{}, newExprError(errKindSyntax, n.opPos, n.opPos+len(n.op), "%v", err)
+		}
+		return result, nil
+
+	case *callNode:
+		return ev.call(n)
+	}
+
+	start, end := n.span()
+	return bigValue{}, newExprError(errKindSyntax, start, end, "unsupported expression node %T", n)
+}
+
+// isZero reports whether v is zero
+func isZero(v bigValue) bool {
+	if v.i != nil {
+		return v.i.Sign() == 0
+	}
+	return v.f.Sign() == 0
+}
+
+func (ev *bigEvaluator) applyBinary(op string, left, right bigValue) (bigValue, error) {
+	exact := left.i != nil && right.i != nil
+
+	switch op {
+	case "+", "-", "*":
+		if exact {
+			r := new(big.Int)
+			switch op {
+			case "+":
+				r.Add(left.i, right.i)
+			case "-":
+				r.Sub(left.i, right.i)
+			default:
+				r.Mul(left.i, right.i)
+			}
+			return ev.intValue(r), nil
+		}
+		a, b, r := ev.float(left), ev.float(right), ev.newFloat()
+		switch op {
+		case "+":
+			r.Add(a, b)
+		case "-":
+			r.Sub(a, b)
+		default:
+			r.Mul(a, b)
+		}
+		return bigValue{f: ev.bounded(r)}, nil
+
+	case "/":
+		if isZero(right) {
+			return bigValue{}, errDivisionByZero
+		}
+		if exact {
+			q, m := new(big.Int).QuoRem(left.i, right.i, new(big.Int))
+			if m.Sign() == 0 {
+				return bigValue{i: q}, nil
+			}
+		}
+		return bigValue{f: ev.bounded(ev.newFloat().Quo(ev.float(left), ev.float(right)))}, nil
+
+	case "//":
+		if isZero(right) {
+			return bigValue{}, errDivisionByZero
+		}
+		if exact {
+			return bigValue{i: floorDivInt(left.i, right.i)}, nil
+		}
+		return ev.floor(bigValue{f: ev.newFloat().Quo(ev.float(left), ev.float(right))}), nil
+
+	case "%":
+		if isZero(right) {
+			return bigValue{}, errModuloByZero
+		}
+		if exact {
+			q := floorDivInt(left.i, right.i)
+			return bigValue{i: q.Sub(left.i, q.Mul(q, right.i))}, nil
+		}
+		// a - b*floor(a/b), which takes the sign of b like floorMod
+		a, b := ev.float(left), ev.float(right)
+		q := ev.float(ev.floor(bigValue{f: ev.newFloat().Quo(a, b)}))
+		return bigValue{f: ev.newFloat().Sub(a, q.Mul(q, b))}, nil
+
+	case "^":
+		return ev.pow(left, right)
+	}
+	return bigValue{}, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// floorDivInt divides rounding toward negative infinity (big.Int.Div rounds toward -Inf only for positive divisors)
+func floorDivInt(a, b *big.Int) *big.Int {
+	q, m := new(big.Int).QuoRem(a, b, new(big.Int))
+	if m.Sign() != 0 && (m.Sign() < 0) != (b.Sign() < 0) {
+		q.Sub(q, big.NewInt(1))
+	}
+	return q
+}
+
+// pow computes base^exponent, exactly for integer base and non-negative integer exponent
+func (ev *bigEvaluator) pow(base, exponent bigValue) (bigValue, error) {
+	if isZero(base) && exponent.sign() < 0 {
+		return bigValue{}, errDivisionByZero
+	}
+
+	n, integral := ev.integer(exponent)
+	if integral {
+		if base.i != nil && n.Sign() >= 0 {
+			// Estimate the size before computing, since e.g. 10^(10^9) would exhaust memory
+			if base.i.BitLen() > 1 && (!n.IsInt64() || n.Int64() > maxExactIntBits || int64(base.i.BitLen()-1)*n.Int64() > maxExactIntBits) {
+				return bigValue{f: ev.newFloat().SetInf(base.i.Sign() < 0 && n.Bit(0) == 1)}, nil
+			}
+			return ev.intValue(new(big.Int).Exp(base.i, n, nil)), nil
+		}
+		if n.IsInt64() {
+			return bigValue{f: ev.powInt(ev.float(base), n.Int64())}, nil
+		}
+	}
+
+	b := ev.float(base)
+	switch b.Sign() {
+	case 0:
+		return bigValue{i: new(big.Int)}, nil
+	case -1:
+		// A negative base with a fractional exponent has no real result, as with math.Pow
+		panic(big.ErrNaN{})
+	}
+	e := ev.newFloat().Mul(ev.float(exponent), ev.ln(b))
+	return bigValue{f: ev.exp(e)}, nil
+}
+
+// sign returns -1, 0 or +1
+func (v bigValue) sign() int {
+	if v.i != nil {
+		return v.i.Sign()
+	}
+	return v.f.Sign()
+}
+
+// integer returns v as a big.Int if it has no fractional part
+func (ev *bigEvaluator) integer(v bigValue) (*big.Int, bool) {
+	if v.i != nil {
+		return v.i, true
+	}
+	if v.f.IsInf() || !v.f.IsInt() {
+		return nil, false
+	}
+	i, _ := v.f.Int(nil)
+	return i, true
+}
+
+// powInt computes x^n by repeated squaring. A result beyond maxBigExponent is known from
+// log2|x| * n before squaring, and returned as ±Inf or 0 at once.
+func (ev *bigEvaluator) powInt(x *big.Float, n int64) *big.Float {
+	if x.Sign() != 0 && !x.IsInf() {
+		mant := new(big.Float)
+		e := x.MantExp(mant) // |mant| in [0.5, 1)
+		m, _ := mant.Float64()
+		switch bits := (float64(e) + math.Log2(math.Abs(m))) * float64(n); {
+		case bits > maxBigExponent:
+			return ev.newFloat().SetInf(x.Sign() < 0 && n%2 != 0)
+		case bits < -maxBigExponent:
+			return ev.newFloat()
+		}
+	}
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	result := ev.newFloat().SetInt64(1)
+	sq := ev.newFloat().Set(x)
+	for n > 0 {
+		if n&1 == 1 {
+			result.Mul(result, sq)
+		}
+		sq.Mul(sq, sq)
+		n >>= 1
+	}
+	if neg {
+		result.Quo(ev.newFloat().SetInt64(1), result)
+	}
+	return result
+}
+
+// floor rounds toward negative infinity
+func (ev *bigEvaluator) floor(v bigValue) bigValue {
+	if v.i != nil || v.f.IsInf() {
+		return v
+	}
+	i, acc := v.f.Int(nil) // truncates toward zero
+	if v.f.Sign() < 0 && acc != big.Exact {
+		i.Sub(i, big.NewInt(1))
+	}
+	return ev.intValue(i)
+}
+
+// lookupIdentifier resolves variables and constants; constants are computed at the working precision
+func (ev *bigEvaluator) lookupIdentifier(n *identNode) (bigValue, error) {
+	if val, ok := ev.vars[n.name]; ok {
+		return bigValue{f: ev.newFloat().SetFloat64(val)}, nil
+	}
+	if f := ev.constant(n.name); f != nil {
+		return bigValue{f: f}, nil
+	}
+	// Constants without an arbitrary-precision definition, and errors, come from the float evaluator
+	val, err := (&evaluator{vars: ev.vars}).lookupIdentifier(n)
+	if err != nil {
+		return bigValue{}, err
+	}
+	return bigValue{f: ev.newFloat().SetFloat64(val)}, nil
+}
+
+// constant computes a named constant from mathConstants at the working precision
+func (ev *bigEvaluator) constant(name string) *big.Float {
+	switch name {
+	case "pi":
+		// Machin's formula: pi = 16*atan(1/5) - 4*atan(1/239)
+		a := ev.atanInv(5)
+		a.Mul(a, big.NewFloat(16))
+		b := ev.atanInv(239)
+		b.Mul(b, big.NewFloat(4))
+		return a.Sub(a, b)
+	case "e":
+		return ev.exp(ev.newFloat().SetInt64(1))
+	case "phi":
+		r := ev.newFloat().Sqrt(ev.newFloat().SetInt64(5))
+		r.Add(r, big.NewFloat(1))
+		return r.Quo(r, big.NewFloat(2))
+	case "sqrt2":
+		return ev.newFloat().Sqrt(ev.newFloat().SetInt64(2))
+	case "ln2":
+		return ev.ln2()
+	case "ln10":
+		return ev.ln(ev.newFloat().SetInt64(10))
+	}
+	return nil
+}
+
+// converged reports whether term no longer affects sum at the working precision
+func (ev *bigEvaluator) converged(sum, term *big.Float) bool {
+	return term.Sign() == 0 || (sum.Sign() != 0 && term.MantExp(nil) < sum.MantExp(nil)-int(ev.prec)-2)
+}
+
+// atanInv computes atan(1/k) for an integer k > 1 by its Taylor series
+func (ev *bigEvaluator) atanInv(k int64) *big.Float {
+	kf := ev.newFloat().SetInt64(k)
+	k2 := ev.newFloat().Mul(kf, kf)
+	power := ev.newFloat().Quo(ev.newFloat().SetInt64(1), kf) // 1/k^(2n+1)
+	sum := ev.newFloat().Set(power)
+	term := ev.newFloat()
+	for n := int64(1); ; n++ {
+		power.Quo(power, k2)
+		term.Quo(power, ev.newFloat().SetInt64(2*n+1))
+		if ev.converged(sum, term) {
+			return sum
+		}
+		if n%2 == 1 {
+			sum.Sub(sum, term)
+		} else {
+			sum.Add(sum, term)
+		}
+	}
+}
+
+// atanh computes atanh(z) for |z| <= 1/3 by its Taylor series
+func (ev *bigEvaluator) atanh(z *big.Float) *big.Float {
+	z2 := ev.newFloat().Mul(z, z)
+	power := ev.newFloat().Set(z)
+	sum := ev.newFloat().Set(z)
+	term := ev.newFloat()
+	for n := int64(1); ; n++ {
+		power.Mul(power, z2)
+		term.Quo(power, ev.newFloat().SetInt64(2*n+1))
+		if ev.converged(sum, term) {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// ln2 computes ln(2) = 2*atanh(1/3)
+func (ev *bigEvaluator) ln2() *big.Float {
+	r := ev.atanh(ev.newFloat().Quo(ev.newFloat().SetInt64(1), ev.newFloat().SetInt64(3)))
+	return r.Mul(r, big.NewFloat(2))
+}
+
+// ln computes the natural logarithm of x > 0 as 2*atanh((m-1)/(m+1)) + e*ln(2), where x = m * 2^e
+func (ev *bigEvaluator) ln(x *big.Float) *big.Float {
+	if x.IsInf() {
+		return ev.newFloat().SetInf(false)
+	}
+	m := ev.newFloat()
+	e := x.MantExp(m) // m in [0.5, 1)
+	one := ev.newFloat().SetInt64(1)
+	z := ev.newFloat().Quo(ev.newFloat().Sub(m, one), ev.newFloat().Add(m, one))
+	r := ev.atanh(z)
+	r.Mul(r, big.NewFloat(2))
+	if e != 0 {
+		l2 := ev.ln2()
+		r.Add(r, l2.Mul(l2, ev.newFloat().SetInt64(int64(e))))
+	}
+	return r
+}
+
+// exp computes e^x by reducing x = n*ln(2) + r, summing the Taylor series of r/2^8 and squaring back
+func (ev *bigEvaluator) exp(x *big.Float) *big.Float {
+	if x.IsInf() {
+		if x.Sign() > 0 {
+			return ev.newFloat().SetInf(false)
+		}
+		return ev.newFloat()
+	}
+	l2 := ev.ln2()
+	nf := ev.newFloat().Quo(x, l2)
+	n, _ := nf.Int64()
+	// Results beyond maxBigExponent overflow to +Inf or underflow to 0
+	if nf.Cmp(big.NewFloat(maxBigExponent)) > 0 {
+		return ev.newFloat().SetInf(false)
+	}
+	if nf.Cmp(big.NewFloat(-maxBigExponent)) < 0 {
+		return ev.newFloat()
+	}
+
+	const halvings = 8
+	r := ev.newFloat().Sub(x, l2.Mul(l2, ev.newFloat().SetInt64(n)))
+	r.SetMantExp(r, -halvings)
+
+	sum := ev.newFloat().SetInt64(1)
+	term := ev.newFloat().SetInt64(1)
+	for k := int64(1); ; k++ {
+		term.Mul(term, r)
+		term.Quo(term, ev.newFloat().SetInt64(k))
+		if ev.converged(sum, term) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < halvings; i++ {
+		sum.Mul(sum, sum)
+	}
+	return sum.SetMantExp(sum, int(n))
+}
+
+// bigFunctions are the built-ins available in arbitrary-precision mode. Arity comes from builtinFunctions.
+var bigFunctions = map[string]func(ev *bigEvaluator, args []bigValue) (bigValue, error){
+	"sqrt": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		if args[0].sign() < 0 {
+			return bigValue{}, fmt.Errorf("argument must be non-negative")
+		}
+		if args[0].i != nil {
+			if r := new(big.Int).Sqrt(args[0].i); new(big.Int).Mul(r, r).Cmp(args[0].i) == 0 {
+				return bigValue{i: r}, nil
+			}
+		}
+		return bigValue{f: ev.newFloat().Sqrt(ev.float(args[0]))}, nil
+	},
+	"cbrt": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		x := ev.float(args[0])
+		if x.Sign() == 0 {
+			return bigValue{i: new(big.Int)}, nil
+		}
+		abs := ev.newFloat().Abs(x)
+		r := ev.exp(ev.newFloat().Quo(ev.ln(abs), big.NewFloat(3)))
+		if x.Sign() < 0 {
+			r.Neg(r)
+		}
+		return bigValue{f: r}, nil
+	},
+	"abs": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		if args[0].i != nil {
+			return bigValue{i: new(big.Int).Abs(args[0].i)}, nil
+		}
+		return bigValue{f: ev.newFloat().Abs(args[0].f)}, nil
+	},
+	"floor": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		return ev.floor(args[0]), nil
+	},
+	"ceil": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		// ceil(x) = -floor(-x)
+		neg := ev.floor(bigValue{f: ev.newFloat().Neg(ev.float(args[0]))})
+		if neg.i == nil {
+			return bigValue{f: ev.newFloat().Neg(neg.f)}, nil
+		}
+		return bigValue{i: neg.i.Neg(neg.i)}, nil
+	},
+	"round": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		// Half away from zero, as math.Round
+		x := ev.float(args[0])
+		half := ev.newFloat().SetFloat64(0.5)
+		if x.Sign() < 0 {
+			half.Neg(half)
+		}
+		if x.IsInf() {
+			return bigValue{f: x}, nil
+		}
+		i, _ := ev.newFloat().Add(x, half).Int(nil) // truncation toward zero completes the rounding
+		return ev.intValue(i), nil
+	},
+	"exp": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		return bigValue{f: ev.exp(ev.float(args[0]))}, nil
+	},
+	"ln": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		if args[0].sign() <= 0 {
+			return bigValue{}, fmt.Errorf("argument must be positive")
+		}
+		return bigValue{f: ev.ln(ev.float(args[0]))}, nil
+	},
+	"log10": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		if args[0].sign() <= 0 {
+			return bigValue{}, fmt.Errorf("argument must be positive")
+		}
+		r := ev.ln(ev.float(args[0]))
+		return bigValue{f: r.Quo(r, ev.ln(ev.newFloat().SetInt64(10)))}, nil
+	},
+	"log": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		if args[0].sign() <= 0 {
+			return bigValue{}, fmt.Errorf("argument must be positive")
+		}
+		r := ev.ln(ev.float(args[0]))
+		if len(args) == 1 {
+			return bigValue{f: r}, nil
+		}
+		base := ev.float(args[1])
+		if base.Sign() <= 0 || base.Cmp(big.NewFloat(1)) == 0 {
+			return bigValue{}, fmt.Errorf("base must be positive and not equal to 1")
+		}
+		return bigValue{f: r.Quo(r, ev.ln(base))}, nil
+	},
+	"nPr": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		return ev.counting("nPr", args, permutationsExact)
+	},
+	"nCr": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		return ev.counting("nCr", args, combinationsExact)
+	},
+	"min": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		return ev.extreme(args, -1), nil
+	},
+	"max": func(ev *bigEvaluator, args []bigValue) (bigValue, error) {
+		return ev.extreme(args, 1), nil
+	},
+}
+
+// counting computes nPr or nCr exactly, overflowing to +Inf beyond maxExactIntBits
+func (ev *bigEvaluator) counting(name string, args []bigValue, exact func(n, r int64) (*big.Int, bool)) (bigValue, error) {
+	n, okN := ev.integer(args[0])
+	r, okR := ev.integer(args[1])
+	if !okN || !okR || !n.IsInt64() || !r.IsInt64() || n.Sign() < 0 || r.Sign() < 0 {
+		return bigValue{}, fmt.Errorf("%s requires non-negative integer arguments", name)
+	}
+	v, ok := exact(n.Int64(), r.Int64())
+	if !ok {
+		return bigValue{f: ev.newFloat().SetInf(false)}, nil
+	}
+	return ev.intValue(v), nil
+}
+
+// factorial computes n! or n!! exactly. Non-integers need the gamma function, which is only
+// available in float64.
+func (ev *bigEvaluator) factorial(n *factorialNode, v bigValue) (bigValue, error) {
+	i, ok := ev.integer(v)
+	if !ok {
+		return bigValue{}, nodeError(errKindUnsupported, n, "factorial of a non-integer is not supported with precision; omit precision to evaluate it with the gamma function")
+	}
+	step, least := int64(1), int64(0)
+	if n.double {
+		step, least = 2, -1
+	}
+	if !i.IsInt64() || i.Int64() < least {
+		if i.Sign() < 0 {
+			return bigValue{}, nodeError(errKindDomain, n, "factorial is undefined for %s", i)
+		}
+		return bigValue{f: ev.newFloat().SetInf(false)}, nil
+	}
+	result, ok := factorialExact(i.Int64(), step)
+	if !ok {
+		return bigValue{f: ev.newFloat().SetInf(false)}, nil
+	}
+	return ev.intValue(result), nil
+}
+
+// extreme returns the smallest (dir < 0) or largest (dir > 0) argument
+func (ev *bigEvaluator) extreme(args []bigValue, dir int) bigValue {
+	best := args[0]
+	for _, v := range args[1:] {
+		if ev.float(v).Cmp(ev.float(best)) == dir {
+			best = v
+		}
+	}
+	return best
+}
+
+// bigFunctionNames returns the functions supported in arbitrary-precision mode in sorted order
+func bigFunctionNames() []string {
+	names := make([]string, 0, len(bigFunctions))
+	for name := range bigFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ev *bigEvaluator) call(n *callNode) (bigValue, error) {
+	builtin, ok := builtinFunctions[n.name]
+	if _, isUser := ev.funcs[n.name]; !ok && isUser {
+		return bigValue{}, newExprError(errKindUnsupported, n.start, n.start+len(n.name),
+			"user-defined function '%s' is not supported with precision; omit precision to evaluate it with float64", n.name)
+	}
+	if !ok {
+		return bigValue{}, newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+			"unknown function '%s' at position %d%s", n.name, n.start, suggestion(n.name, builtinFunctionNames()))
+	}
+	fn, ok := bigFunctions[n.name]
+	if !ok {
+		return bigValue{}, newExprError(errKindUnsupported, n.start, n.start+len(n.name),
+			"function '%s' is not supported with precision (supported: %s); omit precision to evaluate it with float64", n.name, strings.Join(bigFunctionNames(), ", "))
+	}
+	if err := builtin.checkArity(n.name, len(n.args)); err != nil {
+		return bigValue{}, nodeError(errKindArity, n, "%v", err)
+	}
+
+	args := make([]bigValue, len(n.args))
+	for i, arg := range n.args {
+		v, err := ev.eval(arg)
+		if err != nil {
+			return bigValue{}, err
+		}
+		args[i] = v
+	}
+	result, err := fn(ev, args)
+	if err != nil {
+		return bigValue{}, nodeError(errKindDomain, n, "%s: %v", n.name, err)
+	}
+	return result, nil
+}
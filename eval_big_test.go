@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateStatementBig(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		digits   int
+		expected string
+	}{
+		{"decimal_sum", "0.1+0.2", 30, "0.3"},
+		{"large_integer_product", "12345678901234567890*98765", 10, "1219320976680432097655850"},
+		{"integer_power", "2^100", 5, "1267650600228229401496703205376"},
+		{"exact_division", "10/4*2", 10, "5"},
+		{"inexact_division", "1/3", 25, "0.3333333333333333333333333"},
+		{"floor_division", "-7//2", 10, "-4"},
+		{"modulo", "-7%3", 10, "2"},
+		{"decimal_modulo", "5.5%2", 10, "1.5"},
+		{"negative_exponent", "2^-3", 10, "0.125"},
+		{"scientific", "1.5e3*2", 10, "3000"},
+		{"pi", "pi", 40, "3.141592653589793238462643383279502884197"},
+		{"e", "e", 40, "2.718281828459045235360287471352662497757"},
+		{"phi", "phi", 30, "1.61803398874989484820458683437"},
+		{"ln2", "ln2", 30, "0.693147180559945309417232121458"},
+		{"ln10", "ln10", 30, "2.30258509299404568401799145468"},
+		{"sqrt_exact", "sqrt(144)", 10, "12"},
+		{"sqrt2", "sqrt(2)", 30, "1.41421356237309504880168872421"},
+		{"fractional_power", "2^0.5", 20, "1.4142135623730950488"},
+		{"exp_ln", "exp(ln(7))", 20, "7"},
+		{"log_base", "log(1024, 2)", 20, "10"},
+		{"cbrt", "cbrt(-27)", 20, "-3"},
+		{"round", "round(-2.5)", 10, "-3"},
+		{"ceil", "ceil(1.000000000000000000001)", 30, "2"},
+		{"max", "max(1/3, 0.3, 1/4)", 10, "0.3333333333"},
+		{"overflow", "10^(10^9)", 10, "+Inf"},
+		{"negative_overflow", "(-10)^(10^9+1)", 10, "-Inf"},
+		{"exp_overflow", "exp(10^8)", 10, "+Inf"},
+		{"exp_underflow", "exp(-10^9)", 10, "0"},
+		{"decimal_power_overflow", "1.5^(10^9)", 10, "+Inf"},
+		{"negative_decimal_power_overflow", "(-1.5)^(10^9+1)", 10, "-Inf"},
+		{"decimal_power_underflow", "0.5^(10^9)", 10, "0"},
+		{"product_overflow", "exp(40000) * exp(40000)", 10, "+Inf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result, _, err := evaluateStatementBig(context.Background(), tt.expr, nil, nil, tt.digits)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if result != tt.expected {
+				t.Errorf("%q at %d digits: expected %s, got %s", tt.expr, tt.digits, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatementBigErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"5/(2-2)", errKindDivisionByZero, "2-2"},
+		{"5 % 0", errKindDivisionByZero, "0"},
+		{"0^-1", errKindDivisionByZero, "-1"},
+		{"sqrt(-1)", errKindDomain, "sqrt(-1)"},
+		{"sin(1)", errKindUnsupported, "sin"},
+		{"(-8)^(1/3)", errKindInvalidResult, "(-8)^(1/3)"},
+		{"sqrt2 + (-8)^0.5", errKindInvalidResult, "sqrt2 + (-8)^0.5"},
+		{"10^(10^9) - 10^(10^9)", errKindInvalidResult, "10^(10^9) - 10^(10^9)"},
+		{"2*pii", errKindUnknownIdentifier, "pii"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, _, err := evaluateStatementBig(context.Background(), tt.expr, nil, nil, 20)
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatementBigCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := evaluateStatementBig(ctx, "2+2", nil, nil, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestCalculatePrecision(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "0.1+0.2", "precision": 20}, &out)
+	if out.Result != "Result: 0.1+0.2 = 0.3" {
+		t.Errorf("unexpected result: %q", out.Result)
+	}
+
+	res := callTool(t, cs, "calculate", map[string]any{"expression": "1+1", "precision": 0}, nil)
+	if !res.IsError {
+		t.Errorf("expected an error for precision 0")
+	}
+
+	// User-defined functions are reported as unsupported, not unknown
+	callTool(t, cs, "calculate", map[string]any{"expression": "f(x) = x^2"}, nil)
+	res = callTool(t, cs, "calculate", map[string]any{"expression": "f(3)", "precision": 20}, &out)
+	if !res.IsError || out.Error == nil || out.Error.Kind != errKindUnsupported || !strings.Contains(out.Error.Message, "user-defined function 'f'") {
+		t.Errorf("expected an unsupported error for f, got %q", resultText(res))
+	}
+}
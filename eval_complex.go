@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+)
+
+// imaginaryUnits are the identifiers that denote sqrt(-1) in complex mode. A coefficient is an
+// implicit multiplication like any other, so 4i = 4*i and 2i^2 = 2*i^2 = -2.
+var imaginaryUnits = map[string]bool{"i": true, "j": true}
+
+// errRealOperands reports an operator that is only defined for real numbers
+var errRealOperands = errors.New("requires real operands")
+
+// complexEvaluator evaluates an AST over complex128
+type complexEvaluator struct {
+	vars map[string]complex128
+}
+
+// evaluateStatementComplex is the complex counterpart of evaluateStatement
+func evaluateStatementComplex(expr string, vars map[string]complex128) (string, complex128, error) {
+	stmt, err := parseStatement(expr)
+	if err == nil {
+		err = rejectLogical(stmt.expr)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if imaginaryUnits[stmt.target] {
+		start := strings.Index(expr, stmt.target)
+		return "", 0, newExprError(errKindInvalidAssignment, start, start+len(stmt.target),
+			"cannot assign to '%s', it is the imaginary unit in complex mode", stmt.target)
+	}
+	result, err := (&complexEvaluator{vars: vars}).eval(stmt.expr)
+	if err != nil {
+		return "", 0, err
+	}
+	if cmplx.IsNaN(result) {
+		return "", 0, newExprError(errKindInvalidResult, 0, len(expr), "Calculation resulted in an invalid number (NaN)")
+	}
+	return stmt.target, result, nil
+}
+
+func (ev *complexEvaluator) eval(n node) (complex128, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return complex(n.value, 0), nil
+
+	case *identNode:
+		if imaginaryUnits[n.name] {
+			return 1i, nil
+		}
+		if v, ok := ev.vars[n.name]; ok {
+			return v, nil
+		}
+		// Constants and the error for unknown names come from the real evaluator
+		names := make(map[string]float64, len(ev.vars))
+		for name := range ev.vars {
+			names[name] = 0
+		}
+		v, err := (&evaluator{vars: names}).lookupIdentifier(n)
+		return complex(v, 0), err
+
+	case *unaryNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return 0, err
+		}
+		if n.op == "-" {
+			// 0 - v rather than -v: negating 4+0i must not give -4-0i, which lies on the other
+			// side of the branch cut of sqrt and ln
+			return 0 - v, nil
+		}
+		return v, nil
+
+	case *percentNode:
+		v, err := ev.eval(n.operand)
+		return v / 100, err
+
+	case *factorialNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return 0, err
+		}
+		if imag(v) != 0 {
+			return 0, nodeError(errKindUnsupported, n, "factorial requires a real operand")
+		}
+		result, err := factorialFloat(real(v), n.double)
+		if err != nil {
+			return 0, nodeError(errKindDomain, n, "%v", err)
+		}
+		return complex(result, 0), nil
+
+	case *binaryNode:
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return 0, err
+		}
+		if relativePercent(n) {
+			right *= left
+		}
+		result, err := applyBinaryComplex(n.op, left, right)
+		switch {
+		case errors.Is(err, errDivisionByZero) || errors.Is(err, errModuloByZero):
+			return 0, nodeError(errKindDivisionByZero, n.right, "%v", err)
+		case errors.Is(err, errRealOperands):
+			return 0, nodeError(errKindUnsupported, n, "%v", err)
+		case err != nil:
+			return 0, nodeError(errKindSyntax, n, "%v", err)
+		}
+		return result, nil
+
+	case *callNode:
+		return ev.call(n)
+	}
+
+	start, end := n.span()
+	return 0, newExprError(errKindSyntax, start, end, "unsupported expression node %T", n)
+}
+
+// applyBinaryComplex applies an arithmetic operator to complex operands.
+// Floor division and modulo are only defined for real operands.
+func applyBinaryComplex(op string, left, right complex128) (complex128, error) {
+	switch op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, errDivisionByZero
+		}
+		return left / right, nil
+	case "//", "%":
+		if imag(left) != 0 || imag(right) != 0 {
+			return 0, fmt.Errorf("operator '%s' %w", op, errRealOperands)
+		}
+		v, err := applyBinary(op, real(left), real(right))
+		return complex(v, 0), err
+	case "^":
+		return powComplex(left, right)
+	}
+	return 0, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// powComplex computes the principal value of base^exponent. Real powers that have a real
+// result and integer powers are computed directly, so (-2)^2 is exactly 4 rather than
+// carrying a rounding error in the imaginary part.
+func powComplex(base, exponent complex128) (complex128, error) {
+	if base == 0 {
+		switch {
+		case real(exponent) < 0:
+			return 0, errDivisionByZero
+		case exponent == 0:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	e := real(exponent)
+	integer := imag(exponent) == 0 && e == math.Trunc(e)
+	if imag(base) == 0 && imag(exponent) == 0 && (real(base) >= 0 || integer) {
+		return complex(math.Pow(real(base), e), 0), nil
+	}
+	if integer && math.Abs(e) <= 1024 {
+		result := complex(1, 0)
+		b := base
+		for k := int(math.Abs(e)); k > 0; k >>= 1 {
+			if k&1 == 1 {
+				result *= b
+			}
+			b *= b
+		}
+		if e < 0 {
+			result = 1 / result
+		}
+		return result, nil
+	}
+	return cmplx.Pow(base, exponent), nil
+}
+
+// complexFunction is a function over complex arguments.
+// maxArgs < 0 means the function is variadic with at least minArgs arguments.
+type complexFunction struct {
+	minArgs int
+	maxArgs int
+	apply   func(args []complex128) (complex128, error)
+}
+
+func (f complexFunction) checkArity(name string, n int) error {
+	return builtinFunction{minArgs: f.minArgs, maxArgs: f.maxArgs}.checkArity(name, n)
+}
+
+// complexFunctions are the complex-aware functions of complex mode. Built-ins that are not
+// listed here (floor, round, min, atan2, ...) are still available for real arguments.
+var complexFunctions = map[string]complexFunction{
+	"sqrt": cunary(cmplx.Sqrt),
+	"cbrt": {minArgs: 1, maxArgs: 1, apply: func(args []complex128) (complex128, error) {
+		// Real arguments keep the real cube root, so cbrt(-8) is -2
+		if imag(args[0]) == 0 {
+			return complex(math.Cbrt(real(args[0])), 0), nil
+		}
+		return cmplx.Pow(args[0], 1.0/3), nil
+	}},
+	"abs":   cunary(func(z complex128) complex128 { return complex(cmplx.Abs(z), 0) }),
+	"exp":   cunary(cmplx.Exp),
+	"ln":    cunary(cmplx.Log),
+	"log10": cunary(cmplx.Log10),
+	"log": {minArgs: 1, maxArgs: 2, apply: func(args []complex128) (complex128, error) {
+		if len(args) == 1 {
+			return cmplx.Log(args[0]), nil
+		}
+		if args[1] == 1 {
+			return 0, fmt.Errorf("base must not be 1")
+		}
+		return cmplx.Log(args[0]) / cmplx.Log(args[1]), nil
+	}},
+
+	"sin":  cunary(cmplx.Sin),
+	"cos":  cunary(cmplx.Cos),
+	"tan":  cunary(cmplx.Tan),
+	"asin": cunary(cmplx.Asin),
+	"acos": cunary(cmplx.Acos),
+	"atan": cunary(cmplx.Atan),
+
+	"sinh":  cunary(cmplx.Sinh),
+	"cosh":  cunary(cmplx.Cosh),
+	"tanh":  cunary(cmplx.Tanh),
+	"asinh": cunary(cmplx.Asinh),
+	"acosh": cunary(cmplx.Acosh),
+	"atanh": cunary(cmplx.Atanh),
+
+	"re":   cunary(func(z complex128) complex128 { return complex(real(z), 0) }),
+	"im":   cunary(func(z complex128) complex128 { return complex(imag(z), 0) }),
+	"arg":  cunary(func(z complex128) complex128 { return complex(cmplx.Phase(z), 0) }),
+	"conj": cunary(cmplx.Conj),
+	"polar": {minArgs: 2, maxArgs: 2, apply: func(args []complex128) (complex128, error) {
+		if imag(args[0]) != 0 || imag(args[1]) != 0 {
+			return 0, fmt.Errorf("magnitude and angle must be real")
+		}
+		return cmplx.Rect(real(args[0]), real(args[1])), nil
+	}},
+}
+
+// cunary adapts a total complex function to the complexFunction signature
+func cunary(fn func(complex128) complex128) complexFunction {
+	return complexFunction{minArgs: 1, maxArgs: 1, apply: func(args []complex128) (complex128, error) {
+		return fn(args[0]), nil
+	}}
+}
+
+// complexFunctionNames returns every function callable in complex mode in sorted order
+func complexFunctionNames() []string {
+	names := builtinFunctionNames()
+	for name := range complexFunctions {
+		if _, ok := builtinFunctions[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ev *complexEvaluator) call(n *callNode) (complex128, error) {
+	fn, ok := complexFunctions[n.name]
+	builtin, isBuiltin := builtinFunctions[n.name]
+	if !ok && !isBuiltin {
+		return 0, newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+			"unknown function '%s' at position %d%s", n.name, n.start, suggestion(n.name, complexFunctionNames()))
+	}
+	var arityErr error
+	if ok {
+		arityErr = fn.checkArity(n.name, len(n.args))
+	} else {
+		arityErr = builtin.checkArity(n.name, len(n.args))
+	}
+	if arityErr != nil {
+		return 0, nodeError(errKindArity, n, "%v", arityErr)
+	}
+
+	args := make([]complex128, len(n.args))
+	for i, arg := range n.args {
+		v, err := ev.eval(arg)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+
+	if ok {
+		result, err := fn.apply(args)
+		if err == nil && (cmplx.IsInf(result) || cmplx.IsNaN(result)) {
+			err = fmt.Errorf("undefined for %s", formatComplex(args[0]))
+		}
+		if err != nil {
+			return 0, nodeError(errKindDomain, n, "%s: %v", n.name, err)
+		}
+		return result, nil
+	}
+
+	// Real-only built-in
+	reals := make([]float64, len(args))
+	for i, v := range args {
+		if imag(v) != 0 {
+			return 0, nodeError(errKindUnsupported, n.args[i], "function '%s' requires real arguments", n.name)
+		}
+		reals[i] = real(v)
+	}
+	result, err := builtin.apply(reals)
+	if err != nil {
+		return 0, nodeError(errKindDomain, n, "%s: %v", n.name, err)
+	}
+	return complex(result, 0), nil
+}
+
+// cleanComplex zeroes a component that is negligible next to the other one, so rounding
+// noise such as the 1.2e-16i in exp(i*pi) is not reported
+func cleanComplex(z complex128) complex128 {
+	tol := 1e-12 * cmplx.Abs(z)
+	re, im := real(z), imag(z)
+	// <= also turns -0 into 0
+	if math.Abs(re) <= tol {
+		re = 0
+	}
+	if math.Abs(im) <= tol {
+		im = 0
+	}
+	return complex(re, im)
+}
+
+// formatComplex formats z in rectangular notation, e.g. "3 - 4i", "2i" or "5"
+func formatComplex(z complex128) string {
+	z = cleanComplex(z)
+	re, im := real(z), imag(z)
+
+	imagText := formatResult(math.Abs(im)) + "i"
+	if math.Abs(im) == 1 {
+		imagText = "i"
+	}
+	switch {
+	case im == 0:
+		return formatResult(re)
+	case re == 0 && im < 0:
+		return "-" + imagText
+	case re == 0:
+		return imagText
+	case im < 0:
+		return formatResult(re) + " - " + imagText
+	}
+	return formatResult(re) + " + " + imagText
+}
+
+// formatPolar formats z as magnitude ∠ angle, with the angle in radians and degrees
+func formatPolar(z complex128) string {
+	z = cleanComplex(z)
+	phase := cmplx.Phase(z)
+	return fmt.Sprintf("%s ∠ %s rad (%s°)", formatResult(cmplx.Abs(z)), formatResult(phase), formatResult(phase*180/math.Pi))
+}
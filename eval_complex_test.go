@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateStatementComplex(t *testing.T) {
+	tests := []struct {
+		expr        string
+		rectangular string
+		polar       string
+	}{
+		{"sqrt(-4)", "2i", "2 ∠ 1.570796327 rad (90°)"},
+		{"(3+4i)*(1-2i)", "11 - 2i", "11.18033989 ∠ -0.1798534998 rad (-10.30484647°)"},
+		{"abs(3+4i)", "5", "5 ∠ 0 rad (0°)"},
+		{"i^2", "-1", "1 ∠ 3.141592654 rad (180°)"},
+		{"2j - 3", "-3 + 2i", "3.605551275 ∠ 2.55359005 rad (146.3099325°)"},
+		{"exp(i*pi)", "-1", "1 ∠ 3.141592654 rad (180°)"},
+		{"(1+i)^-2", "-0.5i", "0.5 ∠ -1.570796327 rad (-90°)"},
+		{"(-8)^(1/3)", "1 + 1.732050808i", "2 ∠ 1.047197551 rad (60°)"},
+		{"cbrt(-8)", "-2", "2 ∠ 3.141592654 rad (180°)"},
+		{"ln(-1)", "3.141592654i", "3.141592654 ∠ 1.570796327 rad (90°)"},
+		{"conj(1-i) + re(2+3i) + im(2+3i)", "6 + i", "6.08276253 ∠ 0.1651486774 rad (9.462322208°)"},
+		{"polar(2, pi/2)", "2i", "2 ∠ 1.570796327 rad (90°)"},
+		{"arg(-1)", "3.141592654", "3.141592654 ∠ 0 rad (0°)"},
+		{"max(2, 7//2) + 5%3", "5", "5 ∠ 0 rad (0°)"},
+		// A coefficient multiplies the imaginary unit implicitly, with the precedence of '*'
+		{"2i^2", "-2", "2 ∠ 3.141592654 rad (180°)"},
+		{"1/2i", "0.5i", "0.5 ∠ 1.570796327 rad (90°)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, result, err := evaluateStatementComplex(tt.expr, nil)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if got := formatComplex(result); got != tt.rectangular {
+				t.Errorf("%q: expected %s, got %s", tt.expr, tt.rectangular, got)
+			}
+			if got := formatPolar(result); got != tt.polar {
+				t.Errorf("%q: expected polar %s, got %s", tt.expr, tt.polar, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatementComplexErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"1/(i-i)", errKindDivisionByZero, "i-i"},
+		{"(1+i) % 2", errKindUnsupported, "1+i) % 2"},
+		{"floor(2.5i)", errKindUnsupported, "2.5i"},
+		{"ln(0)", errKindDomain, "ln(0)"},
+		{"i = 2", errKindInvalidAssignment, "i"},
+		{"2*k", errKindUnknownIdentifier, "k"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := evaluateStatementComplex(tt.expr, nil)
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestImaginaryUnitOutsideComplexMode(t *testing.T) {
+	for _, expr := range []string{"2 + 3i", "4j"} {
+		_, _, err := evaluateStatement(expr, nil)
+		var e *exprError
+		if !errors.As(err, &e) || e.Kind != errKindUnknownIdentifier || !strings.Contains(e.Message, "mode 'complex'") {
+			t.Errorf("%q: expected an unknown identifier error pointing to complex mode, got %v", expr, err)
+		}
+	}
+	// Outside complex mode i and j are ordinary names
+	if _, result, err := evaluateStatement("2i + 3j", map[string]float64{"i": 3, "j": 1}); err != nil || result != 9 {
+		t.Errorf("expected 9, got %v, %v", result, err)
+	}
+}
+
+func TestCalculateComplexMode(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "z = 3 + 4i", "mode": "complex"}, &out)
+	if out.Rectangular != "3 + 4i" || out.Polar != "5 ∠ 0.927295218 rad (53.13010235°)" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = calculateOutput{}
+	callTool(t, cs, "calculate", map[string]any{"expression": "z * conj(z)", "mode": "complex"}, &out)
+	if out.Rectangular != "25" {
+		t.Errorf("expected 25, got %+v", out)
+	}
+
+	var vars variablesOutput
+	callTool(t, cs, "variables", map[string]any{}, &vars)
+	if vars.ComplexVariables["z"] != "3 + 4i" || vars.Variables["ans"] != 25 {
+		t.Errorf("unexpected variables: %+v", vars)
+	}
+
+	res := callTool(t, cs, "calculate", map[string]any{"expression": "i", "mode": "complex", "precision": 10}, nil)
+	if !res.IsError {
+		t.Errorf("expected an error for precision in complex mode")
+	}
+}
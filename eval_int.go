@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// wordSizes are the integer widths supported in programmer mode
+var wordSizes = []int{8, 16, 32, 64}
+
+// intEvaluator evaluates an AST in programmer mode: fixed-width integers with two's complement
+// wraparound. Values are kept as the raw bit pattern, masked to the word size.
+type intEvaluator struct {
+	bits   int
+	signed bool
+	vars   map[string]float64
+}
+
+// intResult is the outcome of a programmer mode evaluation in each output base
+type intResult struct {
+	value   float64 // the decimal value, for session variables
+	decimal string
+	hex     string
+	binary  string
+	octal   string
+}
+
+// evaluateStatementInt is the programmer mode counterpart of evaluateStatement
+func evaluateStatementInt(expr string, vars map[string]float64, bits int, signed bool) (string, *intResult, error) {
+	stmt, err := parseStatementSyntax(expr, syntaxProgrammer)
+	if err == nil {
+		err = rejectLogical(stmt.expr)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	ev := &intEvaluator{bits: bits, signed: signed, vars: vars}
+	raw, err := ev.eval(stmt.expr)
+	if err != nil {
+		return "", nil, err
+	}
+	return stmt.target, ev.result(raw), nil
+}
+
+// mask truncates v to the word size
+func (ev *intEvaluator) mask(v uint64) uint64 {
+	if ev.bits == 64 {
+		return v
+	}
+	return v & (1<<ev.bits - 1)
+}
+
+// signedValue interprets the bit pattern v as a two's complement number
+func (ev *intEvaluator) signedValue(v uint64) int64 {
+	shift := 64 - ev.bits
+	return int64(v<<shift) >> shift
+}
+
+// decimal formats v in base 10 according to the signedness of the word
+func (ev *intEvaluator) decimal(v uint64) string {
+	if ev.signed {
+		return strconv.FormatInt(ev.signedValue(v), 10)
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// less compares bit patterns according to the signedness of the word
+func (ev *intEvaluator) less(a, b uint64) bool {
+	if ev.signed {
+		return ev.signedValue(a) < ev.signedValue(b)
+	}
+	return a < b
+}
+
+func (ev *intEvaluator) negative(v uint64) bool {
+	return ev.signed && ev.signedValue(v) < 0
+}
+
+// result formats the bit pattern v in every output base. Hexadecimal and binary are padded to
+// the word size, as register dumps usually are.
+func (ev *intEvaluator) result(v uint64) *intResult {
+	value := float64(v)
+	if ev.signed {
+		value = float64(ev.signedValue(v))
+	}
+	return &intResult{
+		value:   value,
+		decimal: ev.decimal(v),
+		hex:     fmt.Sprintf("0x%0*X", ev.bits/4, v),
+		binary:  fmt.Sprintf("0b%0*b", ev.bits, v),
+		octal:   fmt.Sprintf("0o%o", v),
+	}
+}
+
+func (ev *intEvaluator) eval(n node) (uint64, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return ev.parseLiteral(n)
+
+	case *identNode:
+		if val, ok := ev.vars[n.name]; ok {
+			if val != math.Trunc(val) || val < math.MinInt64 || val >= math.MaxUint64 {
+				return 0, nodeError(errKindUnsupported, n, "variable '%s' = %s is not a 64-bit integer", n.name, formatResult(val))
+			}
+			if val < 0 {
+				return ev.mask(uint64(int64(val))), nil
+			}
+			return ev.mask(uint64(val)), nil
+		}
+		if _, ok := mathConstants[n.name]; ok {
+			return 0, nodeError(errKindUnsupported, n, "constant '%s' is not an integer and cannot be used in programmer mode", n.name)
+		}
+		_, err := (&evaluator{vars: ev.vars}).lookupIdentifier(n)
+		return 0, err
+
+	case *unaryNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return 0, err
+		}
+		switch n.op {
+		case "-":
+			return ev.mask(-v), nil
+		case "~":
+			return ev.mask(^v), nil
+		}
+		return v, nil
+
+	case *binaryNode:
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return 0, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return 0, err
+		}
+		result, err := ev.applyBinary(n.op, left, right)
+		switch {
+		case errors.Is(err, errDivisionByZero) || errors.Is(err, errModuloByZero):
+			return 0, nodeError(errKindDivisionByZero, n.right, "%v", err)
+		case err != nil:
+			return 0, nodeError(errKindDomain, n.right, "%v", err)
+		}
+		return result, nil
+
+	case *callNode:
+		return ev.call(n)
+
+	case *factorialNode:
+		return 0, nodeError(errKindUnsupported, n, "factorials are not supported in programmer mode")
+	}
+
+	start, end := n.span()
+	return 0, newExprError(errKindSyntax, start, end, "unsupported expression node %T", n)
+}
+
+// parseLiteral converts an integer literal to a bit pattern. Literals wider than the word
+// wrap around, as a cast would: 0x1FF is 0xFF in an 8-bit word.
+func (ev *intEvaluator) parseLiteral(n *numberNode) (uint64, error) {
+	base := 0
+	if len(n.text) > 1 && n.text[0] == '0' && isDigit(n.text[1]) {
+		base = 10 // a leading zero does not make a literal octal; that takes 0o
+	}
+	v, err := strconv.ParseUint(n.text, base, 64)
+	if err == nil {
+		return ev.mask(v), nil
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, nodeError(errKindUnsupported, n, "number '%s' does not fit in 64 bits", n.text)
+	}
+	if strings.ContainsAny(n.text, ".eE") && !strings.HasPrefix(strings.ToLower(n.text), "0x") {
+		return 0, nodeError(errKindUnsupported, n, "number '%s' is not an integer; programmer mode only supports integers", n.text)
+	}
+	return 0, nodeError(errKindSyntax, n, "invalid number format: %s", n.text)
+}
+
+// applyBinary applies an operator to two bit patterns. '/' truncates toward zero and '%' takes
+// the sign of the dividend as in C, so that a == (a/b)*b + a%b, while '//' is floored as in the
+// default mode.
+func (ev *intEvaluator) applyBinary(op string, left, right uint64) (uint64, error) {
+	switch op {
+	case "+":
+		return ev.mask(left + right), nil
+	case "-":
+		return ev.mask(left - right), nil
+	case "*":
+		return ev.mask(left * right), nil
+	case "&":
+		return left & right, nil
+	case "|":
+		return left | right, nil
+	case "xor":
+		return left ^ right, nil
+	case "<<", ">>":
+		if ev.negative(right) {
+			return 0, fmt.Errorf("shift count must not be negative")
+		}
+		count := min(right, 64)
+		if op == "<<" {
+			return ev.mask(left << count), nil
+		}
+		if ev.signed {
+			// Arithmetic shift keeps the sign
+			return ev.mask(uint64(ev.signedValue(left) >> count)), nil
+		}
+		return left >> count, nil
+	case "/", "//", "%":
+		if right == 0 {
+			if op == "%" {
+				return 0, errModuloByZero
+			}
+			return 0, errDivisionByZero
+		}
+		return ev.divide(op, left, right), nil
+	case "^":
+		return ev.pow(left, right)
+	}
+	return 0, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// divide implements '/', '//' and '%' for a non-zero divisor
+func (ev *intEvaluator) divide(op string, left, right uint64) uint64 {
+	if !ev.signed {
+		if op == "%" {
+			return left % right
+		}
+		return left / right
+	}
+
+	// Go defines MinInt64 / -1 as MinInt64, which is the wraparound result
+	a, b := ev.signedValue(left), ev.signedValue(right)
+	q, r := a/b, a%b
+	if op == "%" {
+		return ev.mask(uint64(r))
+	}
+	if op == "//" && r != 0 && (r < 0) != (b < 0) {
+		q--
+	}
+	return ev.mask(uint64(q))
+}
+
+// pow computes base**exponent with wraparound by repeated squaring
+func (ev *intEvaluator) pow(base, exponent uint64) (uint64, error) {
+	if ev.negative(exponent) {
+		return 0, fmt.Errorf("exponent must not be negative in programmer mode")
+	}
+	result := uint64(1)
+	for e := exponent; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			result *= base
+		}
+		base *= base
+	}
+	return ev.mask(result), nil
+}
+
+// intFunctions are the built-ins available in programmer mode. Arity comes from builtinFunctions.
+var intFunctions = map[string]func(ev *intEvaluator, args []uint64) uint64{
+	"abs": func(ev *intEvaluator, args []uint64) uint64 {
+		if ev.negative(args[0]) {
+			return ev.mask(-args[0])
+		}
+		return args[0]
+	},
+	"min": func(ev *intEvaluator, args []uint64) uint64 {
+		best := args[0]
+		for _, v := range args[1:] {
+			if ev.less(v, best) {
+				best = v
+			}
+		}
+		return best
+	},
+	"max": func(ev *intEvaluator, args []uint64) uint64 {
+		best := args[0]
+		for _, v := range args[1:] {
+			if ev.less(best, v) {
+				best = v
+			}
+		}
+		return best
+	},
+}
+
+func (ev *intEvaluator) call(n *callNode) (uint64, error) {
+	builtin, ok := builtinFunctions[n.name]
+	if !ok {
+		return 0, newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+			"unknown function '%s' at position %d%s", n.name, n.start, suggestion(n.name, builtinFunctionNames()))
+	}
+	fn, ok := intFunctions[n.name]
+	if !ok {
+		return 0, newExprError(errKindUnsupported, n.start, n.start+len(n.name),
+			"function '%s' is not supported in programmer mode (supported: abs, max, min)", n.name)
+	}
+	if err := builtin.checkArity(n.name, len(n.args)); err != nil {
+		return 0, nodeError(errKindArity, n, "%v", err)
+	}
+
+	args := make([]uint64, len(n.args))
+	for i, arg := range n.args {
+		v, err := ev.eval(arg)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	return fn(ev, args), nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluateStatementInt(t *testing.T) {
+	tests := []struct {
+		expr    string
+		bits    int
+		signed  bool
+		decimal string
+		hex     string
+	}{
+		{"0xFF & 0b1010", 64, true, "10", "0x000000000000000A"},
+		{"1 << 12", 32, true, "4096", "0x00001000"},
+		{"0xF0 ^ 0x3C", 8, false, "204", "0xCC"},
+		{"~0", 16, false, "65535", "0xFFFF"},
+		{"~0", 16, true, "-1", "0xFFFF"},
+		{"127 + 1", 8, true, "-128", "0x80"},
+		{"255 + 1", 8, false, "0", "0x00"},
+		{"0x1FF", 8, false, "255", "0xFF"},
+		{"-8 >> 1", 8, true, "-4", "0xFC"},
+		{"0xF0 >> 4", 8, false, "15", "0x0F"},
+		{"1 << 64", 64, false, "0", "0x0000000000000000"},
+		{"-7 / 2", 32, true, "-3", "0xFFFFFFFD"},
+		{"-7 // 2", 32, true, "-4", "0xFFFFFFFC"},
+		{"-7 % 3", 32, true, "-1", "0xFFFFFFFF"},
+		{"7 % -3", 32, true, "1", "0x00000001"},
+		{"(-7 / 2) * 2 + -7 % 2", 32, true, "-7", "0xFFFFFFF9"},
+		{"-128 % -1", 8, true, "0", "0x00"},
+		{"-128 / -1", 8, true, "-128", "0x80"},
+		{"2**10 | 0o17", 16, true, "1039", "0x040F"},
+		{"3**40", 64, false, "12157665459056928801", "0xA8B8B452291FE821"},
+		{"010 + 1_000", 16, true, "1010", "0x03F2"},
+		{"max(-1, 1) + abs(-5)", 8, true, "6", "0x06"},
+		{"max(-1, 1)", 8, false, "255", "0xFF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, result, err := evaluateStatementInt(tt.expr, nil, tt.bits, tt.signed)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if result.decimal != tt.decimal || result.hex != tt.hex {
+				t.Errorf("%q (%d-bit, signed %v): expected %s %s, got %s %s", tt.expr, tt.bits, tt.signed, tt.decimal, tt.hex, result.decimal, result.hex)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatementIntErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"1 / (2 - 2)", errKindDivisionByZero, "2 - 2"},
+		{"1 << -1", errKindDomain, "-1"},
+		{"2 ** -1", errKindDomain, "-1"},
+		{"1.5 + 1", errKindUnsupported, "1.5"},
+		{"0x1_0000_0000_0000_0000", errKindUnsupported, "0x1_0000_0000_0000_0000"},
+		{"0b102", errKindSyntax, "0b102"},
+		{"pi & 1", errKindUnsupported, "pi"},
+		{"sqrt(4)", errKindUnsupported, "sqrt"},
+		{"1 $ 2", errKindInvalidCharacter, "$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := evaluateStatementInt(tt.expr, nil, 32, true)
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestCalculateProgrammerMode(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "reg = 0xA5 ^ 0xFF", "mode": "programmer", "wordSize": 8, "signed": false}, &out)
+	if out.Result != "Assigned: reg = 90 (hex 0x5A, bin 0b01011010, oct 0o132)" || out.Binary != "0b01011010" || out.Octal != "0o132" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = calculateOutput{}
+	callTool(t, cs, "calculate", map[string]any{"expression": "reg << 1", "mode": "programmer", "wordSize": 8, "signed": false}, &out)
+	if out.Decimal != "180" {
+		t.Errorf("expected 180, got %+v", out)
+	}
+
+	// ^ keeps its meaning of exponentiation outside programmer mode
+	out = calculateOutput{}
+	callTool(t, cs, "calculate", map[string]any{"expression": "2^3"}, &out)
+	if out.Result != "Result: 2^3 = 8" {
+		t.Errorf("unexpected default mode result: %q", out.Result)
+	}
+
+	for _, args := range []map[string]any{
+		{"expression": "1", "mode": "programmer", "wordSize": 12},
+		{"expression": "1", "wordSize": 8},
+	} {
+		if res := callTool(t, cs, "calculate", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// maxRootDegree bounds q in x^(p/q) for exact roots
+const maxRootDegree = 64
+
+// errNotExact reports an operation whose result is irrational or too large to represent as a fraction
+var errNotExact = errors.New("result cannot be represented exactly")
+
+// ratEvaluator evaluates an AST with exact rational arithmetic
+type ratEvaluator struct {
+	vars map[string]float64
+}
+
+// exactResult is the outcome of an exact evaluation
+type exactResult struct {
+	value       *big.Rat
+	fraction    string // reduced fraction, e.g. "7/3" or "4"
+	mixedNumber string // e.g. "2 1/3"
+}
+
+// evaluateStatementExact is the rational counterpart of evaluateStatement
+func evaluateStatementExact(expr string, vars map[string]float64) (string, *exactResult, error) {
+	stmt, err := parseStatement(expr)
+	if err == nil {
+		err = rejectLogical(stmt.expr)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	r, err := (&ratEvaluator{vars: vars}).eval(stmt.expr)
+	if err != nil {
+		return "", nil, err
+	}
+	return stmt.target, &exactResult{value: r, fraction: r.RatString(), mixedNumber: mixedNumber(r)}, nil
+}
+
+// isExactValue reports whether r is the exact value of the statement expr, as computed with
+// rational arithmetic. It is false when expr cannot be evaluated exactly, e.g. because it
+// calls sqrt(2) or a session function.
+func isExactValue(expr string, vars map[string]float64, r *big.Rat) bool {
+	if r == nil {
+		return false
+	}
+	_, exact, err := evaluateStatementExact(expr, vars)
+	return err == nil && exact.value.Cmp(r) == 0
+}
+
+// mixedNumber formats r as a whole part and a proper fraction, e.g. -7/3 as "-2 1/3"
+func mixedNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	whole, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int)) // truncated, so rem has the sign of r
+	if whole.Sign() == 0 {
+		return r.RatString()
+	}
+	return fmt.Sprintf("%s %s/%s", whole, rem.Abs(rem), r.Denom())
+}
+
+// checkSize rejects rationals whose numerator or denominator exceed maxExactIntBits
+func checkSize(r *big.Rat) (*big.Rat, error) {
+	if r.Num().BitLen() > maxExactIntBits || r.Denom().BitLen() > maxExactIntBits {
+		return nil, fmt.Errorf("result is too large to represent exactly")
+	}
+	return r, nil
+}
+
+func (ev *ratEvaluator) eval(n node) (*big.Rat, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		r, ok := new(big.Rat).SetString(n.text)
+		if !ok {
+			return nil, nodeError(errKindSyntax, n, "invalid number format: %s", n.text)
+		}
+		if _, err := checkSize(r); err != nil {
+			return nil, nodeError(errKindUnsupported, n, "%v", err)
+		}
+		return r, nil
+
+	case *identNode:
+		if val, ok := ev.vars[n.name]; ok {
+			// Variables are stored as float64, so they convert to their exact binary value
+			return new(big.Rat).SetFloat64(val), nil
+		}
+		if _, ok := mathConstants[n.name]; ok {
+			return nil, nodeError(errKindUnsupported, n, "constant '%s' is irrational and cannot be used in exact mode", n.name)
+		}
+		_, err := (&evaluator{vars: ev.vars}).lookupIdentifier(n)
+		return nil, err
+
+	case *unaryNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "-" {
+			return new(big.Rat).Neg(v), nil
+		}
+		return v, nil
+
+	case *percentNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Rat).Quo(v, big.NewRat(100, 1)), nil
+
+	case *factorialNode:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		return factorialRat(n, v)
+
+	case *binaryNode:
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		if relativePercent(n) {
+			right = new(big.Rat).Mul(left, right)
+		}
+		result, err := applyBinaryRat(n.op, left, right)
+		switch {
+		case errors.Is(err, errDivisionByZero) || errors.Is(err, errModuloByZero):
+			return nil, nodeError(errKindDivisionByZero, n.right, "%v", err)
+		case err != nil:
+			return nil, nodeError(errKindUnsupported, n, "%v", err)
+		}
+		return result, nil
+
+	case *callNode:
+		return ev.call(n)
+	}
+
+	start, end := n.span()
+	return nil, newExprError(errKindSyntax, start, end, "unsupported expression node %T", n)
+}
+
+// applyBinaryRat applies an arithmetic operator with exact rational semantics
+func applyBinaryRat(op string, left, right *big.Rat) (*big.Rat, error) {
+	switch op {
+	case "+":
+		return checkSize(new(big.Rat).Add(left, right))
+	case "-":
+		return checkSize(new(big.Rat).Sub(left, right))
+	case "*":
+		return checkSize(new(big.Rat).Mul(left, right))
+	case "/":
+		if right.Sign() == 0 {
+			return nil, errDivisionByZero
+		}
+		return checkSize(new(big.Rat).Quo(left, right))
+	case "//":
+		if right.Sign() == 0 {
+			return nil, errDivisionByZero
+		}
+		return new(big.Rat).SetInt(floorRat(new(big.Rat).Quo(left, right))), nil
+	case "%":
+		if right.Sign() == 0 {
+			return nil, errModuloByZero
+		}
+		q := new(big.Rat).SetInt(floorRat(new(big.Rat).Quo(left, right)))
+		return checkSize(new(big.Rat).Sub(left, q.Mul(q, right)))
+	case "^":
+		return powRat(left, right)
+	}
+	return nil, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// floorRat rounds toward negative infinity
+func floorRat(r *big.Rat) *big.Int {
+	return floorDivInt(r.Num(), r.Denom())
+}
+
+// powRat computes base^(p/q) exactly, which requires the q-th root of base to be rational
+func powRat(base, exponent *big.Rat) (*big.Rat, error) {
+	if base.Sign() == 0 {
+		if exponent.Sign() < 0 {
+			return nil, errDivisionByZero
+		}
+		if exponent.Sign() == 0 {
+			return big.NewRat(1, 1), nil
+		}
+		return new(big.Rat), nil
+	}
+
+	p, q := exponent.Num(), exponent.Denom()
+	if !q.IsInt64() || q.Int64() > maxRootDegree {
+		return nil, fmt.Errorf("%w: exponent %s has too large a denominator", errNotExact, exponent.RatString())
+	}
+	root, ok := rootRat(base, q.Int64())
+	if !ok {
+		// Printed as an expression, so that the base keeps its parentheses: (1/3)^(1/2)
+		power := &binaryNode{op: "^", left: constPoly(base).node(), right: constPoly(exponent).node()}
+		return nil, fmt.Errorf("%w: %s is irrational", errNotExact, formatNode(power))
+	}
+	return powRatInt(root, p)
+}
+
+// powRatInt computes r^n for an integer n
+func powRatInt(r *big.Rat, n *big.Int) (*big.Rat, error) {
+	abs := new(big.Int).Abs(n)
+	bits := max(r.Num().BitLen(), r.Denom().BitLen())
+	if bits > 1 && (!abs.IsInt64() || abs.Int64() > maxExactIntBits || int64(bits-1)*abs.Int64() > maxExactIntBits) {
+		return nil, fmt.Errorf("result is too large to represent exactly")
+	}
+	num := new(big.Int).Exp(r.Num(), abs, nil)
+	den := new(big.Int).Exp(r.Denom(), abs, nil)
+	if n.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// rootRat returns the exact q-th root of r, if it is rational. Odd roots of negative numbers are negative.
+func rootRat(r *big.Rat, q int64) (*big.Rat, bool) {
+	if q == 1 {
+		return r, true
+	}
+	if r.Sign() < 0 && q%2 == 0 {
+		return nil, false
+	}
+	num, ok := rootInt(new(big.Int).Abs(r.Num()), q)
+	if !ok {
+		return nil, false
+	}
+	den, ok := rootInt(r.Denom(), q)
+	if !ok {
+		return nil, false
+	}
+	if r.Sign() < 0 {
+		num.Neg(num)
+	}
+	return new(big.Rat).SetFrac(num, den), true
+}
+
+// rootInt returns the exact q-th root of n >= 0 using Newton's method, if n is a perfect q-th power
+func rootInt(n *big.Int, q int64) (*big.Int, bool) {
+	if n.Sign() == 0 {
+		return new(big.Int), true
+	}
+	bq := big.NewInt(q)
+	qm1 := big.NewInt(q - 1)
+	// Start above the root so the iteration decreases monotonically
+	x := new(big.Int).Lsh(big.NewInt(1), uint(n.BitLen()/int(q)+1))
+	for {
+		// y = ((q-1)*x + n / x^(q-1)) / q
+		y := new(big.Int).Exp(x, qm1, nil)
+		y.Quo(n, y)
+		y.Add(y, new(big.Int).Mul(qm1, x))
+		y.Quo(y, bq)
+		if y.Cmp(x) >= 0 {
+			break
+		}
+		x = y
+	}
+	return x, new(big.Int).Exp(x, bq, nil).Cmp(n) == 0
+}
+
+// ratFunctions are the built-ins with exact rational results. Arity comes from builtinFunctions.
+var ratFunctions = map[string]func(args []*big.Rat) (*big.Rat, error){
+	"sqrt": func(args []*big.Rat) (*big.Rat, error) {
+		if args[0].Sign() < 0 {
+			return nil, fmt.Errorf("argument must be non-negative")
+		}
+		return exactRoot(args[0], 2, "sqrt")
+	},
+	"cbrt": func(args []*big.Rat) (*big.Rat, error) {
+		return exactRoot(args[0], 3, "cbrt")
+	},
+	"abs": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).Abs(args[0]), nil
+	},
+	"floor": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).SetInt(floorRat(args[0])), nil
+	},
+	"ceil": func(args []*big.Rat) (*big.Rat, error) {
+		f := floorRat(new(big.Rat).Neg(args[0]))
+		return new(big.Rat).SetInt(f.Neg(f)), nil
+	},
+	"round": func(args []*big.Rat) (*big.Rat, error) {
+		// Half away from zero, as math.Round
+		half := big.NewRat(1, 2)
+		if args[0].Sign() < 0 {
+			f := floorRat(new(big.Rat).Sub(half, args[0]))
+			return new(big.Rat).SetInt(f.Neg(f)), nil
+		}
+		return new(big.Rat).SetInt(floorRat(new(big.Rat).Add(args[0], half))), nil
+	},
+	"nPr": func(args []*big.Rat) (*big.Rat, error) {
+		return countingRat("nPr", args, permutationsExact)
+	},
+	"nCr": func(args []*big.Rat) (*big.Rat, error) {
+		return countingRat("nCr", args, combinationsExact)
+	},
+	"min": func(args []*big.Rat) (*big.Rat, error) {
+		return extremeRat(args, -1), nil
+	},
+	"max": func(args []*big.Rat) (*big.Rat, error) {
+		return extremeRat(args, 1), nil
+	},
+}
+
+// exactRoot returns the q-th root of r or a not-exact error naming the function
+func exactRoot(r *big.Rat, q int64, name string) (*big.Rat, error) {
+	root, ok := rootRat(r, q)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s(%s) is irrational", errNotExact, name, r.RatString())
+	}
+	return root, nil
+}
+
+// errTooLarge reports an exact result beyond maxExactIntBits
+var errTooLarge = fmt.Errorf("%w: it is too large", errNotExact)
+
+// countingRat computes nPr or nCr of integer arguments
+func countingRat(name string, args []*big.Rat, exact func(n, r int64) (*big.Int, bool)) (*big.Rat, error) {
+	for _, a := range args {
+		if !a.IsInt() || !a.Num().IsInt64() || a.Sign() < 0 {
+			return nil, fmt.Errorf("%s requires non-negative integer arguments", name)
+		}
+	}
+	v, ok := exact(args[0].Num().Int64(), args[1].Num().Int64())
+	if !ok {
+		return nil, errTooLarge
+	}
+	return new(big.Rat).SetInt(v), nil
+}
+
+// factorialRat computes n! or n!! of an integer; the gamma function of a non-integer is not exact
+func factorialRat(n *factorialNode, v *big.Rat) (*big.Rat, error) {
+	step, least := int64(1), int64(0)
+	if n.double {
+		step, least = 2, -1
+	}
+	if !v.IsInt() {
+		return nil, nodeError(errKindUnsupported, n, "%v: the factorial of %s is not rational", errNotExact, v.RatString())
+	}
+	if v.Cmp(big.NewRat(least, 1)) < 0 {
+		return nil, nodeError(errKindDomain, n, "factorial is undefined for %s", v.RatString())
+	}
+	if !v.Num().IsInt64() {
+		return nil, nodeError(errKindUnsupported, n, "%v", errTooLarge)
+	}
+	result, ok := factorialExact(v.Num().Int64(), step)
+	if !ok {
+		return nil, nodeError(errKindUnsupported, n, "%v", errTooLarge)
+	}
+	return new(big.Rat).SetInt(result), nil
+}
+
+// extremeRat returns the smallest (dir < 0) or largest (dir > 0) argument
+func extremeRat(args []*big.Rat, dir int) *big.Rat {
+	best := args[0]
+	for _, v := range args[1:] {
+		if v.Cmp(best) == dir {
+			best = v
+		}
+	}
+	return best
+}
+
+// ratFunctionNames returns the functions supported in exact mode in sorted order
+func ratFunctionNames() []string {
+	names := make([]string, 0, len(ratFunctions))
+	for name := range ratFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ev *ratEvaluator) call(n *callNode) (*big.Rat, error) {
+	builtin, ok := builtinFunctions[n.name]
+	if !ok {
+		return nil, newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+			"unknown function '%s' at position %d%s", n.name, n.start, suggestion(n.name, builtinFunctionNames()))
+	}
+	fn, ok := ratFunctions[n.name]
+	if !ok {
+		return nil, newExprError(errKindUnsupported, n.start, n.start+len(n.name),
+			"function '%s' has no exact result in exact mode (supported: %s); use the default mode for a decimal result", n.name, strings.Join(ratFunctionNames(), ", "))
+	}
+	if err := builtin.checkArity(n.name, len(n.args)); err != nil {
+		return nil, nodeError(errKindArity, n, "%v", err)
+	}
+
+	args := make([]*big.Rat, len(n.args))
+	for i, arg := range n.args {
+		v, err := ev.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	result, err := fn(args)
+	switch {
+	case errors.Is(err, errNotExact):
+		return nil, nodeError(errKindUnsupported, n, "%v", err)
+	case err != nil:
+		return nil, nodeError(errKindDomain, n, "%s: %v", n.name, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateStatementExact(t *testing.T) {
+	tests := []struct {
+		expr     string
+		fraction string
+		mixed    string
+	}{
+		{"1/3 + 1/6", "1/2", "1/2"},
+		{"7/3", "7/3", "2 1/3"},
+		{"-7/3", "-7/3", "-2 1/3"},
+		{"0.1+0.2", "3/10", "3/10"},
+		{"2.5e-1 * 4", "1", "1"},
+		{"8^(2/3)", "4", "4"},
+		{"(-8)^(1/3)", "-2", "-2"},
+		{"(4/9)^-0.5", "3/2", "1 1/2"},
+		{"sqrt(9/16) + cbrt(-1/8)", "1/4", "1/4"},
+		{"-7//2", "-4", "-4"},
+		{"-7%3", "2", "2"},
+		{"5.5 % 2", "3/2", "1 1/2"},
+		{"round(-5/2) + floor(7/2) + ceil(1/3)", "1", "1"},
+		{"max(1/3, 3/10)", "1/3", "1/3"},
+		{"2^100", "1267650600228229401496703205376", "1267650600228229401496703205376"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, result, err := evaluateStatementExact(tt.expr, nil)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if result.fraction != tt.fraction || result.mixedNumber != tt.mixed {
+				t.Errorf("%q: expected %s (%s), got %s (%s)", tt.expr, tt.fraction, tt.mixed, result.fraction, result.mixedNumber)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatementExactErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"1 + sqrt(2)", errKindUnsupported, "sqrt(2)"},
+		{"2^0.5", errKindUnsupported, "2^0.5"},
+		{"1 + 4^(1/2) + 2^(1/2)", errKindUnsupported, "2^(1/2"},
+		{"2*pi", errKindUnsupported, "pi"},
+		{"sin(1)", errKindUnsupported, "sin"},
+		{"sqrt(-4)", errKindDomain, "sqrt(-4)"},
+		{"1/(3-3)", errKindDivisionByZero, "3-3"},
+		{"0^-1", errKindDivisionByZero, "-1"},
+		{"2^10^9", errKindUnsupported, "2^10^9"},
+		{"x + 1", errKindUnknownIdentifier, "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := evaluateStatementExact(tt.expr, nil)
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+
+	// The base of an irrational power keeps its parentheses
+	for expr, want := range map[string]string{"(1/3)^(1/2)": "(1/3)^(1/2) is irrational", "(1/3)^0.25": "(1/3)^(1/4) is irrational", "2^0.5": "2^(1/2) is irrational"} {
+		_, _, err := evaluateStatementExact(expr, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", expr, want, err)
+		}
+	}
+}
+
+func TestCalculateExactMode(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "x = 7/3", "mode": "exact"}, &out)
+	if out.Result != "Assigned: x = 7/3" || out.Fraction != "7/3" || out.MixedNumber != "2 1/3" || out.Decimal != "2.333333333" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = calculateOutput{}
+	callTool(t, cs, "calculate", map[string]any{"expression": "1/7", "mode": "exact", "precision": 20}, &out)
+	if out.Decimal != "0.14285714285714285714" {
+		t.Errorf("unexpected decimal: %q", out.Decimal)
+	}
+
+	res := callTool(t, cs, "calculate", map[string]any{"expression": "1+1", "mode": "symbolic"}, nil)
+	if !res.IsError {
+		t.Errorf("expected an error for an unknown mode")
+	}
+}
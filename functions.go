@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// builtinFunction describes a function callable from expressions.
+// maxArgs < 0 means the function is variadic with at least minArgs arguments.
+type builtinFunction struct {
+	minArgs int
+	maxArgs int
+	apply   func(args []float64) (float64, error)
+}
+
+// builtinFunctions is the registry of functions available in expressions
+var builtinFunctions = map[string]builtinFunction{
+	"sqrt":  unary(domainCheck(math.Sqrt, func(x float64) bool { return x >= 0 }, "argument must be non-negative")),
+	"cbrt":  unary(plain(math.Cbrt)),
+	"abs":   unary(plain(math.Abs)),
+	"floor": unary(plain(math.Floor)),
+	"ceil":  unary(plain(math.Ceil)),
+	"round": unary(plain(math.Round)),
+	"exp":   unary(plain(math.Exp)),
+	"ln":    unary(domainCheck(math.Log, isPositive, "argument must be positive")),
+	"log10": unary(domainCheck(math.Log10, isPositive, "argument must be positive")),
+	"log":   {minArgs: 1, maxArgs: 2, apply: logBase},
+
+	"sin":   unary(plain(math.Sin)),
+	"cos":   unary(plain(math.Cos)),
+	"tan":   unary(plain(math.Tan)),
+	"asin":  unary(domainCheck(math.Asin, isUnitInterval, "argument must be between -1 and 1")),
+	"acos":  unary(domainCheck(math.Acos, isUnitInterval, "argument must be between -1 and 1")),
+	"atan":  unary(plain(math.Atan)),
+	"atan2": {minArgs: 2, maxArgs: 2, apply: func(args []float64) (float64, error) { return math.Atan2(args[0], args[1]), nil }},
+
+	"sinh":  unary(plain(math.Sinh)),
+	"cosh":  unary(plain(math.Cosh)),
+	"tanh":  unary(plain(math.Tanh)),
+	"asinh": unary(plain(math.Asinh)),
+	"acosh": unary(domainCheck(math.Acosh, func(x float64) bool { return x >= 1 }, "argument must be at least 1")),
+	"atanh": unary(domainCheck(math.Atanh, func(x float64) bool { return x > -1 && x < 1 }, "argument must be strictly between -1 and 1")),
+
+	"nPr": countingFunction("nPr", permutationsExact),
+	"nCr": countingFunction("nCr", combinationsExact),
+
+	"min": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) { return fold(args, math.Min), nil }},
+	"max": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) { return fold(args, math.Max), nil }},
+}
+
+// checkArity reports an error if n arguments are not accepted by the function
+func (f builtinFunction) checkArity(name string, n int) error {
+	switch {
+	case f.maxArgs < 0 && n < f.minArgs:
+		return fmt.Errorf("function '%s' expects at least %s, got %d", name, pluralArgs(f.minArgs), n)
+	case f.maxArgs < 0:
+		return nil
+	case f.minArgs == f.maxArgs && n != f.minArgs:
+		return fmt.Errorf("function '%s' expects %s, got %d", name, pluralArgs(f.minArgs), n)
+	case n < f.minArgs || n > f.maxArgs:
+		return fmt.Errorf("function '%s' expects %d to %d arguments, got %d", name, f.minArgs, f.maxArgs, n)
+	}
+	return nil
+}
+
+// builtinFunctionNames returns the registered function names in sorted order
+func builtinFunctionNames() []string {
+	names := make([]string, 0, len(builtinFunctions))
+	for name := range builtinFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func pluralArgs(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// unary wraps a single-argument function as a builtin
+func unary(fn func(float64) (float64, error)) builtinFunction {
+	return builtinFunction{minArgs: 1, maxArgs: 1, apply: func(args []float64) (float64, error) {
+		return fn(args[0])
+	}}
+}
+
+// plain adapts a total math function to the builtin signature
+func plain(fn func(float64) float64) func(float64) (float64, error) {
+	return func(x float64) (float64, error) {
+		return fn(x), nil
+	}
+}
+
+// domainCheck adapts a math function that is only defined where valid(x) holds
+func domainCheck(fn func(float64) float64, valid func(float64) bool, msg string) func(float64) (float64, error) {
+	return func(x float64) (float64, error) {
+		if !valid(x) {
+			return 0, fmt.Errorf("%s", msg)
+		}
+		return fn(x), nil
+	}
+}
+
+func isPositive(x float64) bool {
+	return x > 0
+}
+
+func isUnitInterval(x float64) bool {
+	return x >= -1 && x <= 1
+}
+
+// logBase computes log(x) as the natural logarithm, or log(x, base) in an arbitrary base
+func logBase(args []float64) (float64, error) {
+	if args[0] <= 0 {
+		return 0, fmt.Errorf("argument must be positive")
+	}
+	if len(args) == 1 {
+		return math.Log(args[0]), nil
+	}
+	base := args[1]
+	if base <= 0 || base == 1 {
+		return 0, fmt.Errorf("base must be positive and not equal to 1")
+	}
+	return math.Log(args[0]) / math.Log(base), nil
+}
+
+func fold(args []float64, fn func(a, b float64) float64) float64 {
+	result := args[0]
+	for _, x := range args[1:] {
+		result = fn(result, x)
+	}
+	return result
+}
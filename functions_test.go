@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected float64
+	}{
+		{"sqrt", "sqrt(16)", 4},
+		{"cbrt", "cbrt(-27)", -3},
+		{"abs", "abs(-2.5)", 2.5},
+		{"floor", "floor(-1.5)", -2},
+		{"ceil", "ceil(1.2)", 2},
+		{"round", "round(2.5)", 3},
+		{"exp_ln", "ln(exp(2))", 2},
+		{"log10", "log10(1000)", 3},
+		{"log_natural", "log(exp(1))", 1},
+		{"log_base", "log(8, 2)", 3},
+		{"sin", "sin(0)", 0},
+		{"cos", "cos(0)", 1},
+		{"atan2", "atan2(1, 1)*4", math.Pi},
+		{"hyperbolic", "cosh(0)+sinh(0)+tanh(0)", 1},
+		{"min_variadic", "min(3, -1, 2)", -1},
+		{"max_variadic", "max(3, 7, 2, 5)", 7},
+		{"max_single", "max(4)", 4},
+		{"nested_calls", "sqrt(abs(-16))+max(1, sqrt(4))", 6},
+		{"call_with_expressions", "max(2^3, 3*3)", 9},
+		{"call_in_power", "sqrt(4)^3", 8},
+		{"whitespace", " sqrt ( 9 ) ", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := evaluateExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error for expression %q: %v", tt.expr, err)
+			}
+			if math.Abs(result-tt.expected) > 1e-10 {
+				t.Errorf("expression %q: expected %v, got %v", tt.expr, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestBuiltinFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{"unknown_function", "foo(1)", "unknown function 'foo'"},
+		{"too_many_args", "sqrt(1, 2)", "function 'sqrt' expects 1 argument, got 2"},
+		{"too_few_args", "atan2(1)", "function 'atan2' expects 2 arguments, got 1"},
+		{"range_arity", "log(1, 2, 3)", "function 'log' expects 1 to 2 arguments, got 3"},
+		{"variadic_empty", "max()", "function 'max' expects at least 1 argument, got 0"},
+		{"domain_sqrt", "sqrt(-1)", "sqrt: argument must be non-negative"},
+		{"domain_ln", "ln(0)", "ln: argument must be positive"},
+		{"domain_log_base", "log(8, 1)", "log: base must be positive and not equal to 1"},
+		{"domain_asin", "asin(2)", "asin: argument must be between -1 and 1"},
+		{"missing_paren", "sqrt(4", "missing closing parenthesis"},
+		{"trailing_comma", "max(1,)", "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := evaluateExpression(tt.expr)
+			if err == nil {
+				t.Fatalf("expected error for expression %q", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expression %q: expected error containing %q, got %q", tt.expr, tt.wantErr, err)
+			}
+		})
+	}
+}
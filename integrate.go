@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Accuracy goals and limits of the adaptive integration
+const (
+	integrateRelTol       = 1e-10
+	integrateAbsTol       = 1e-12
+	maxIntegrateIntervals = 1000
+)
+
+// Nodes and weights of the 15-point Kronrod rule and the 7-point Gauss rule embedded in it, on
+// [-1, 1]. gaussKronrodNodes are the non-negative nodes in decreasing order, ending with the
+// centre; the Gauss rule uses the odd-numbered ones and the centre.
+var (
+	gaussKronrodNodes = [8]float64{
+		0.991455371120812639206854697526329, 0.949107912342758524526189684047851,
+		0.864864423359769072789712788640926, 0.741531185599394439863864773280788,
+		0.586087235467691130294144845693013, 0.405845151377397166906606412076961,
+		0.207784955007898467600689403773245, 0,
+	}
+	kronrodWeights = [8]float64{
+		0.022935322010529224963732008058970, 0.063092092629978553290700663189204,
+		0.104790010322250183839876322541518, 0.140653259715525918745189590510238,
+		0.169004726639267902826583426598550, 0.190350578064785409913256402421014,
+		0.204432940075298892414161999234649, 0.209482141084727828012999174891714,
+	}
+	gaussWeights = [4]float64{
+		0.129484966168869693270611432679082, 0.279705391489276667901467771423780,
+		0.381830050505118944950369775488975, 0.417959183673469387755102040816327,
+	}
+)
+
+// integration is the result of integrate
+type integration struct {
+	value, errorEstimate float64
+	subintervals         int
+	converged            bool
+}
+
+// subinterval is a piece of the range of integration with its Gauss–Kronrod estimate
+type subinterval struct {
+	a, b, value, err float64
+}
+
+// integrand evaluates the function being integrated. Infinite ranges are mapped onto finite
+// ones by a change of variable, and transform gives x and dx/dt for the new variable t.
+type integrand struct {
+	*boundEvaluator
+	body      node
+	transform func(t float64) (x, dxdt float64)
+}
+
+// at evaluates the integrand with respect to t
+func (f *integrand) at(t float64) (float64, error) {
+	if f.transform == nil {
+		return f.evalFinite(f.body, t)
+	}
+	// Close to the infinite end, the integrand must vanish faster than dx/dt grows
+	x, dxdt := f.transform(t)
+	if !math.IsInf(x, 0) {
+		v, err := f.evalFinite(f.body, x)
+		if err != nil || !math.IsInf(v*dxdt, 0) && !math.IsNaN(v*dxdt) {
+			return v * dxdt, err
+		}
+	}
+	start, end := f.body.span()
+	return 0, newExprError(errKindInvalidResult, start, end, "%s does not vanish fast enough as %s goes to infinity; the integral appears to diverge", formatNode(f.body), f.x)
+}
+
+// integrate computes the integral of body with respect to the evaluator's variable from a to b,
+// either of which may be infinite. It bisects the subinterval with the largest error estimate
+// until the total estimate meets the accuracy goal, the subinterval limit is reached or the
+// subintervals become too small to split.
+func integrate(ev *boundEvaluator, body node, a, b float64) (integration, error) {
+	if a == b {
+		return integration{converged: true}, nil
+	}
+	if a > b {
+		r, err := integrate(ev, body, b, a)
+		r.value = -r.value
+		return r, err
+	}
+
+	f := &integrand{boundEvaluator: ev, body: body}
+	lo, hi := a, b
+	switch {
+	case math.IsInf(a, -1) && math.IsInf(b, 1):
+		// x = t/(1-t^2) on (-1, 1)
+		lo, hi = -1, 1
+		f.transform = func(t float64) (float64, float64) {
+			d := 1 - t*t
+			return t / d, (1 + t*t) / (d * d)
+		}
+	case math.IsInf(b, 1):
+		// x = a + t/(1-t) on [0, 1)
+		lo, hi = 0, 1
+		f.transform = func(t float64) (float64, float64) {
+			return a + t/(1-t), 1 / ((1 - t) * (1 - t))
+		}
+	case math.IsInf(a, -1):
+		// x = b - (1-t)/t on (0, 1]
+		lo, hi = 0, 1
+		f.transform = func(t float64) (float64, float64) {
+			return b - (1-t)/t, 1 / (t * t)
+		}
+	}
+
+	first, err := f.gaussKronrod(lo, hi)
+	if err != nil {
+		return integration{}, err
+	}
+	intervals := []subinterval{first}
+	value, errorEstimate := first.value, first.err
+	for len(intervals) < maxIntegrateIntervals {
+		if errorEstimate <= math.Max(integrateAbsTol, integrateRelTol*math.Abs(value)) {
+			return integration{value: value, errorEstimate: errorEstimate, subintervals: len(intervals), converged: true}, nil
+		}
+		worst := 0
+		for i, s := range intervals {
+			if s.err > intervals[worst].err {
+				worst = i
+			}
+		}
+		s := intervals[worst]
+		mid := s.a + (s.b-s.a)/2
+		if mid <= s.a || mid >= s.b {
+			// The subinterval cannot be split any further in float64
+			break
+		}
+		left, err := f.gaussKronrod(s.a, mid)
+		if err != nil {
+			return integration{}, err
+		}
+		right, err := f.gaussKronrod(mid, s.b)
+		if err != nil {
+			return integration{}, err
+		}
+		intervals = slices.Replace(intervals, worst, worst+1, left, right)
+
+		// Re-add the estimates rather than updating them, so that rounding does not accumulate
+		value, errorEstimate = 0, 0
+		for _, s := range intervals {
+			value += s.value
+			errorEstimate += s.err
+		}
+	}
+	converged := errorEstimate <= math.Max(integrateAbsTol, integrateRelTol*math.Abs(value))
+	return integration{value: value, errorEstimate: errorEstimate, subintervals: len(intervals), converged: converged}, nil
+}
+
+// gaussKronrod applies the 15-point Gauss–Kronrod rule to [a, b]. The error estimate is the
+// difference from the embedded Gauss rule, scaled as in QUADPACK's QK15.
+func (f *integrand) gaussKronrod(a, b float64) (subinterval, error) {
+	const eps = 0x1p-52
+	centre, half := (a+b)/2, (b-a)/2
+	values := make([]float64, 0, 15)
+
+	fc, err := f.at(centre)
+	if err != nil {
+		return subinterval{}, err
+	}
+	kronrod, gauss := fc*kronrodWeights[7], fc*gaussWeights[3]
+	absolute := math.Abs(kronrod)
+	values = append(values, fc)
+	for j, node := range gaussKronrodNodes[:7] {
+		f1, err := f.at(centre - half*node)
+		if err != nil {
+			return subinterval{}, err
+		}
+		f2, err := f.at(centre + half*node)
+		if err != nil {
+			return subinterval{}, err
+		}
+		kronrod += kronrodWeights[j] * (f1 + f2)
+		absolute += kronrodWeights[j] * (math.Abs(f1) + math.Abs(f2))
+		if j%2 == 1 {
+			gauss += gaussWeights[j/2] * (f1 + f2)
+		}
+		values = append(values, f1, f2)
+	}
+
+	// The spread of the integrand around its mean, used to scale the raw error estimate
+	mean := kronrod / 2
+	spread := kronrodWeights[7] * math.Abs(values[0]-mean)
+	for j := range 7 {
+		spread += kronrodWeights[j] * (math.Abs(values[1+2*j]-mean) + math.Abs(values[2+2*j]-mean))
+	}
+
+	h := math.Abs(half)
+	err2 := math.Abs((kronrod - gauss) * half)
+	spread *= h
+	absolute *= h
+	if spread != 0 && err2 != 0 {
+		err2 = spread * math.Min(1, math.Pow(200*err2/spread, 1.5))
+	}
+	if absolute > math.SmallestNonzeroFloat64/(50*eps) {
+		err2 = math.Max(50*eps*absolute, err2)
+	}
+	return subinterval{a: a, b: b, value: kronrod * half, err: err2}, nil
+}
+
+// parseBound reads a limit of integrate, sum or product: a number, or an expression in calculate
+// syntax such as pi/2 evaluated with the session's variables and functions, or inf, -inf or
+// infinity for an unbounded side
+func parseBound(v any, vars map[string]float64, funcs map[string]*userFunction) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		s := strings.ToLower(strings.TrimSpace(v))
+		switch strings.TrimPrefix(s, "+") {
+		case "inf", "infinity", "∞":
+			return math.Inf(1), nil
+		}
+		switch s {
+		case "-inf", "-infinity", "-∞":
+			return math.Inf(-1), nil
+		}
+		n, err := parseExpression(v)
+		if err != nil {
+			return 0, err
+		}
+		value, err := (&evaluator{vars: vars, funcs: funcs}).eval(n)
+		if err != nil {
+			return 0, err
+		}
+		if isBoolean(n) {
+			return 0, nodeError(errKindUnsupported, n, "%s is a condition, not a number", formatNode(n))
+		}
+		return value, nil
+	case nil:
+		return 0, fmt.Errorf("a number or an expression is required")
+	}
+	return 0, fmt.Errorf("expected a number or an expression, got %v", v)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestIntegrate(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		expr string
+		a, b float64
+		want float64
+	}{
+		{"sin(x)", 0, math.Pi, 2},
+		{"x^2", 3, 0, -9},
+		{"x^2", 1, 1, 0},
+		{"abs(x)", -1, 2, 2.5},
+		{"exp(-x^2)", -inf, inf, math.Sqrt(math.Pi)},
+		{"1/(1+x^2)", 0, inf, math.Pi / 2},
+		{"exp(x)", -inf, 0, 1},
+		{"1/x^2", 1, inf, 1},
+		{"1/sqrt(x)", 0, 1, 2},
+		{"ln(x)", 0, 1, -1},
+		{"x > 1 ? 1 : 0", 0, 3, 2},
+	}
+	for _, tt := range tests {
+		n, err := parseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.expr, err)
+		}
+		ev := &boundEvaluator{ctx: context.Background(), x: "x", vars: map[string]float64{}}
+		r, err := integrate(ev, n, tt.a, tt.b)
+		if err != nil {
+			t.Errorf("integrating %s from %v to %v: %v", tt.expr, tt.a, tt.b, err)
+			continue
+		}
+		if !r.converged || math.Abs(r.value-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("integral of %s from %v to %v = %+v, want %v", tt.expr, tt.a, tt.b, r, tt.want)
+		}
+		if math.Abs(r.value-tt.want) > 10*r.errorEstimate+1e-15 {
+			t.Errorf("integral of %s from %v to %v: error %g exceeds the estimate %g", tt.expr, tt.a, tt.b, math.Abs(r.value-tt.want), r.errorEstimate)
+		}
+	}
+}
+
+func TestIntegrateErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		a, b float64
+		msg  string
+	}{
+		{"1/x", -1, 1, "at x = 0: division by zero"},
+		{"1/x", 1, math.Inf(1), "diverge"},
+		{"y*x", 0, 1, "unknown"},
+	}
+	for _, tt := range tests {
+		n, _ := parseExpression(tt.expr)
+		ev := &boundEvaluator{ctx: context.Background(), x: "x", vars: map[string]float64{}}
+		if _, err := integrate(ev, n, tt.a, tt.b); err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("integrating %s: got %v, want an error containing %q", tt.expr, err, tt.msg)
+		}
+	}
+
+	// Cancellation stops the integration
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, _ := parseExpression("sin(x)")
+	if _, err := integrate(&boundEvaluator{ctx: ctx, x: "x", vars: map[string]float64{}}, n, 0, 1); err != context.Canceled {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestParseBound(t *testing.T) {
+	vars := map[string]float64{"a": 2}
+	tests := []struct {
+		arg  any
+		want float64
+	}{
+		{1.5, 1.5},
+		{"pi/2", math.Pi / 2},
+		{"a + 1", 3},
+		{"inf", math.Inf(1)},
+		{"+Infinity", math.Inf(1)},
+		{"-inf", math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		if got, err := parseBound(tt.arg, vars, nil); err != nil || got != tt.want {
+			t.Errorf("parseBound(%v) = %v, %v; want %v", tt.arg, got, err, tt.want)
+		}
+	}
+	for _, arg := range []any{"b", "1 <", "1 < 2", true, nil} {
+		if _, err := parseBound(arg, vars, nil); err == nil {
+			t.Errorf("parseBound(%v): expected an error", arg)
+		}
+	}
+}
+
+func TestIntegrateTool(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out integrateOutput
+	callTool(t, cs, "integrate", map[string]any{"expression": "sin(x)", "from": 0, "to": "pi"}, &out)
+	if math.Abs(out.Value-2) > 1e-12 || !out.Converged || out.Evaluations != 15 || out.Subintervals != 1 ||
+		!strings.HasPrefix(out.Result, "∫ sin(x) dx from 0 to 3.141592654 = 2") {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	// Session variables and functions are available; the variable can be renamed
+	callTool(t, cs, "calculate", map[string]any{"expression": "k = 2"}, nil)
+	callTool(t, cs, "calculate", map[string]any{"expression": "g(t) = exp(-k*t)"}, nil)
+	out = integrateOutput{}
+	callTool(t, cs, "integrate", map[string]any{"expression": "g(t)", "variable": "t", "from": "0", "to": "inf"}, &out)
+	if math.Abs(out.Value-0.5) > 1e-10 || !out.Converged {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	for _, args := range []map[string]any{
+		{"expression": "", "from": 0, "to": 1},
+		{"expression": "1/x", "from": -1, "to": 1},
+		{"expression": "x", "from": "1 +", "to": 1},
+		{"expression": "x", "from": 0, "to": "oops"},
+		{"expression": "x", "from": 0, "to": 1, "variable": "sin"},
+	} {
+		if res := callTool(t, cs, "integrate", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v, got %q", args, resultText(res))
+		}
+	}
+}
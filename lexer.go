@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenEOF
+)
+
+// token is a lexical unit of an expression; pos is the byte offset in the original input
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// describe returns a short description of the token for error messages
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// syntax selects the grammar variant used by the lexer and parser
+type syntax int
+
+const (
+	syntaxStandard syntax = iota
+	// syntaxProgrammer adds 0x, 0b and 0o integer literals and the bitwise operators
+	// & | ~ << >>; '^' is XOR, so powers are written with '**'
+	syntaxProgrammer
+	// syntaxUnits lets a number be followed by units (5 km, 9.81 m/s^2) and adds the
+	// 'to' conversion operator
+	syntaxUnits
+)
+
+// tokenize splits an expression into numbers, identifiers, operators, parentheses and commas
+func tokenize(expr string, syn syntax) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case syn == syntaxProgrammer && isDigit(c):
+			end := scanInteger(expr, i)
+			tokens = append(tokens, token{kind: tokenNumber, text: expr[i:end], pos: i})
+			i = end
+		case isDigit(c) || c == '.':
+			end := scanNumber(expr, i)
+			tokens = append(tokens, token{kind: tokenNumber, text: expr[i:end], pos: i})
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(expr) && isIdentPart(expr[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[i:end], pos: i})
+			i = end
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: i})
+			i++
+		case strings.HasPrefix(expr[i:], "**") || strings.HasPrefix(expr[i:], "//"):
+			tokens = append(tokens, token{kind: tokenOperator, text: expr[i : i+2], pos: i})
+			i += 2
+		case isComparison(expr[i:]):
+			tokens = append(tokens, token{kind: tokenOperator, text: expr[i : i+2], pos: i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "!!"):
+			tokens = append(tokens, token{kind: tokenOperator, text: "!!", pos: i})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, token{kind: tokenOperator, text: "!", pos: i})
+			i++
+		case strings.IndexByte("+-*/%^=", c) >= 0:
+			tokens = append(tokens, token{kind: tokenOperator, text: expr[i : i+1], pos: i})
+			i++
+		case syn == syntaxProgrammer && (strings.HasPrefix(expr[i:], "<<") || strings.HasPrefix(expr[i:], ">>")):
+			tokens = append(tokens, token{kind: tokenOperator, text: expr[i : i+2], pos: i})
+			i += 2
+		case syn == syntaxProgrammer && strings.IndexByte("&|~", c) >= 0:
+			tokens = append(tokens, token{kind: tokenOperator, text: expr[i : i+1], pos: i})
+			i++
+		case strings.IndexByte("<>?:", c) >= 0:
+			tokens = append(tokens, token{kind: tokenOperator, text: expr[i : i+1], pos: i})
+			i++
+		default:
+			r, size := utf8.DecodeRuneInString(expr[i:])
+			return nil, newExprError(errKindInvalidCharacter, i, i+size, "invalid character '%c' at position %d", r, i)
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(expr)})
+	return tokens, nil
+}
+
+// scanNumber returns the end offset of the number starting at expr[start].
+// An exponent is only consumed when digits follow it, so "2e" lexes as the number 2 and the identifier e.
+func scanNumber(expr string, start int) int {
+	i := start
+	for i < len(expr) && (isDigit(expr[i]) || expr[i] == '.') {
+		i++
+	}
+	if i < len(expr) && (expr[i] == 'e' || expr[i] == 'E') {
+		j := i + 1
+		if j < len(expr) && (expr[j] == '+' || expr[j] == '-') {
+			j++
+		}
+		if j < len(expr) && isDigit(expr[j]) {
+			for j < len(expr) && isDigit(expr[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+// scanInteger returns the end offset of the integer literal starting at expr[start]: decimal,
+// or hexadecimal, binary or octal with a 0x, 0b or 0o prefix. Trailing letters and digits are
+// included so that a malformed literal such as 0b102 or 1.5 is reported as a whole.
+func scanInteger(expr string, start int) int {
+	i := start + 1
+	for i < len(expr) && (isIdentPart(expr[i]) || expr[i] == '.') {
+		i++
+	}
+	return i
+}
+
+// isComparison reports whether s starts with a two-character comparison operator
+func isComparison(s string) bool {
+	return strings.HasPrefix(s, "==") || strings.HasPrefix(s, "!=") || strings.HasPrefix(s, "<=") || strings.HasPrefix(s, ">=")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
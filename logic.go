@@ -0,0 +1,119 @@
+package main
+
+import "math"
+
+// isLogicalOperator reports whether op is a comparison or logical binary operator
+func isLogicalOperator(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "and", "or":
+		return true
+	}
+	return false
+}
+
+// isBoolean reports whether n produces a truth value rather than a number. Truth values are
+// carried as 1 and 0, so they can still be used in arithmetic (e.g. counting with (x > 0) + (y > 0)).
+func isBoolean(n node) bool {
+	switch n := n.(type) {
+	case *binaryNode:
+		return isLogicalOperator(n.op)
+	case *unaryNode:
+		return n.op == "not"
+	case *conditionalNode:
+		return isBoolean(n.then) && isBoolean(n.otherwise)
+	}
+	return false
+}
+
+// truth converts a truth value to its numeric representation
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compare applies a comparison operator. == and != treat values within tolerance as equal.
+func compare(op string, left, right, tolerance float64) bool {
+	switch op {
+	case "==":
+		return left == right || math.Abs(left-right) <= tolerance
+	case "!=":
+		return !(left == right || math.Abs(left-right) <= tolerance)
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	}
+	return left >= right
+}
+
+// evalLogical evaluates a comparison or a short-circuiting 'and'/'or'. Any non-zero number is true.
+func (ev *evaluator) evalLogical(n *binaryNode) (float64, error) {
+	left, err := ev.eval(n.left)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case n.op == "and" && left == 0:
+		return 0, nil
+	case n.op == "or" && left != 0:
+		return 1, nil
+	}
+	right, err := ev.eval(n.right)
+	if err != nil {
+		return 0, err
+	}
+	if n.op == "and" || n.op == "or" {
+		return truth(right != 0), nil
+	}
+	return truth(compare(n.op, left, right, ev.tolerance)), nil
+}
+
+// evalConditional evaluates only the selected branch, so a recursive user function can stop on
+// a base case such as fact(n) = if(n <= 1, 1, n * fact(n - 1))
+func (ev *evaluator) evalConditional(n *conditionalNode) (float64, error) {
+	cond, err := ev.eval(n.cond)
+	if err != nil {
+		return 0, err
+	}
+	if cond != 0 {
+		return ev.eval(n.then)
+	}
+	return ev.eval(n.otherwise)
+}
+
+// rejectLogical reports the first comparison, logical or conditional expression in n. They are
+// only evaluated in the default mode.
+func rejectLogical(n node) error {
+	switch n := n.(type) {
+	case *binaryNode:
+		if isLogicalOperator(n.op) {
+			return newExprError(errKindUnsupported, n.opPos, n.opPos+len(n.op), "operator '%s' is only supported in the default mode", n.op)
+		}
+		if err := rejectLogical(n.left); err != nil {
+			return err
+		}
+		return rejectLogical(n.right)
+	case *unaryNode:
+		if n.op == "not" {
+			return newExprError(errKindUnsupported, n.start, n.start+len(n.op), "operator 'not' is only supported in the default mode")
+		}
+		return rejectLogical(n.operand)
+	case *conditionalNode:
+		return nodeError(errKindUnsupported, n, "conditional expressions are only supported in the default mode")
+	case *percentNode:
+		return rejectLogical(n.operand)
+	case *factorialNode:
+		return rejectLogical(n.operand)
+	case *callNode:
+		for _, arg := range n.args {
+			if err := rejectLogical(arg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEvaluateLogical(t *testing.T) {
+	vars := map[string]float64{"x": -3}
+	tests := []struct {
+		expr      string
+		tolerance float64
+		expected  float64
+		boolean   bool
+	}{
+		{"3*7 > 20", 0, 1, true},
+		{"3*7 <= 20", 0, 0, true},
+		{"2 != 2", 0, 0, true},
+		{"0.1 + 0.2 == 0.3", 0, 0, true},
+		{"0.1 + 0.2 == 0.3", 1e-9, 1, true},
+		{"0.1 + 0.2 != 0.3", 1e-9, 0, true},
+		{"x < 0 and x > -5", 0, 1, true},
+		{"x > 0 or not x == -3", 0, 0, true},
+		{"x < 0 ? -x : x", 0, 3, false},
+		{"if(x > 0, 1, x < 0)", 0, 1, false},
+		{"if(x > 0, 1 == 1, x < 0)", 0, 1, true},
+		{"(x < 0) + (x < 1) + (x < -10)", 0, 2, false},
+		// Only the selected branch is evaluated
+		{"x == 0 ? 1/x : 2", 0, 2, false},
+		{"x < 0 or 1/0 > 1", 0, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, result, boolean, err := evaluateSessionStatement(context.Background(), tt.expr, vars, nil, tt.tolerance)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected || boolean != tt.boolean {
+				t.Errorf("expected (%v, boolean %v), got (%v, boolean %v)", tt.expected, tt.boolean, result, boolean)
+			}
+		})
+	}
+}
+
+func TestRecursiveUserFunctionWithConditional(t *testing.T) {
+	fn, _, err := parseDefinition("fact(n) = if(n <= 1, 1, n * fact(n - 1))")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	funcs := map[string]*userFunction{"fact": fn}
+	if err := validateDefinition("fact(n) = if(n <= 1, 1, n * fact(n - 1))", fn, nil, funcs); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	_, result, _, err := evaluateSessionStatement(context.Background(), "fact(10)", nil, funcs, 0)
+	if err != nil || result != 3628800 {
+		t.Errorf("expected 3628800, got %v (%v)", result, err)
+	}
+}
+
+func TestLogicalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"1 < x < 3", errKindSyntax, "<"},
+		{"x > 0 ? 1", errKindSyntax, ""},
+		{"if(1, 2)", errKindArity, "if(1, 2)"},
+		{"2 + if", errKindSyntax, "if"},
+		{"1 and", errKindSyntax, "and"},
+		{"not = 1", errKindInvalidAssignment, "not"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, _, err := evaluateStatement(tt.expr, map[string]float64{"x": 1})
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+
+	// Other modes reject truth values rather than misreading them
+	if _, _, err := evaluateStatementExact("1/2 < 1/3", nil); err == nil {
+		t.Errorf("expected exact mode to reject comparisons")
+	}
+	if _, _, err := evaluateStatementInt("x > 0 ? 1 : 2", map[string]float64{"x": 1}, 32, true); err == nil {
+		t.Errorf("expected programmer mode to reject conditionals")
+	}
+}
+
+func TestCalculateBoolean(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "3*7 > 20"}, &out)
+	if out.Result != "Result: 3*7 > 20 = true" || out.Boolean == nil || !*out.Boolean {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = calculateOutput{}
+	callTool(t, cs, "calculate", map[string]any{"expression": "0.1 + 0.2 == 0.3", "tolerance": 1e-12}, &out)
+	if out.Boolean == nil || !*out.Boolean {
+		t.Errorf("expected true within tolerance, got %+v", out)
+	}
+
+	out = calculateOutput{}
+	callTool(t, cs, "calculate", map[string]any{"expression": "ans + 1"}, &out)
+	if out.Result != "Result: ans + 1 = 2" || out.Boolean != nil {
+		t.Errorf("expected a number, got %+v", out)
+	}
+
+	if res := callTool(t, cs, "calculate", map[string]any{"expression": "1 == 1", "tolerance": -1}, nil); !res.IsError {
+		t.Errorf("expected an error for a negative tolerance")
+	}
+}
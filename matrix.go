@@ -0,0 +1,519 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Limits of the matrix tool
+const (
+	maxMatrixSize   = 100 // rows or columns
+	maxJacobiSweeps = 50
+)
+
+// matrix is a dense matrix stored as a slice of rows
+type matrix [][]float64
+
+// newMatrix returns a rows×cols matrix of zeros
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for i := range m {
+		m[i] = make([]float64, cols)
+	}
+	return m
+}
+
+// identity returns the n×n identity matrix
+func identity(n int) matrix {
+	m := newMatrix(n, n)
+	for i := range n {
+		m[i][i] = 1
+	}
+	return m
+}
+
+func (m matrix) rows() int { return len(m) }
+
+func (m matrix) cols() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return len(m[0])
+}
+
+// size describes the shape of m, e.g. 2×3
+func (m matrix) size() string {
+	return fmt.Sprintf("%d×%d", m.rows(), m.cols())
+}
+
+func (m matrix) clone() matrix {
+	c := make(matrix, len(m))
+	for i, row := range m {
+		c[i] = slices.Clone(row)
+	}
+	return c
+}
+
+// norm returns the largest absolute value of an entry, the scale for rounding tolerances
+func (m matrix) norm() float64 {
+	var norm float64
+	for _, row := range m {
+		for _, v := range row {
+			norm = math.Max(norm, math.Abs(v))
+		}
+	}
+	return norm
+}
+
+func (m matrix) transpose() matrix {
+	t := newMatrix(m.cols(), m.rows())
+	for i, row := range m {
+		for j, v := range row {
+			t[j][i] = v
+		}
+	}
+	return t
+}
+
+// dimensionError reports operands whose shapes do not fit the operation
+func dimensionError(format string, args ...any) *exprError {
+	return newExprError(errKindDimension, 0, 0, format, args...)
+}
+
+// requireSquare checks that an operation that needs a square matrix got one
+func (m matrix) requireSquare(operation string) error {
+	if m.rows() != m.cols() {
+		return dimensionError("%s requires a square matrix, got %s", operation, m.size())
+	}
+	return nil
+}
+
+// add returns m + sign*o
+func (m matrix) add(o matrix, sign float64) (matrix, error) {
+	if m.rows() != o.rows() || m.cols() != o.cols() {
+		verb := "add"
+		if sign < 0 {
+			verb = "subtract"
+		}
+		return nil, dimensionError("cannot %s a %s matrix and a %s matrix: the shapes must match", verb, m.size(), o.size())
+	}
+	r := newMatrix(m.rows(), m.cols())
+	for i := range r {
+		for j := range r[i] {
+			r[i][j] = m[i][j] + sign*o[i][j]
+		}
+	}
+	return r, nil
+}
+
+// mul returns the matrix product mo
+func (m matrix) mul(o matrix) (matrix, error) {
+	if m.cols() != o.rows() {
+		return nil, dimensionError("cannot multiply a %s matrix by a %s matrix: the columns of a (%d) must match the rows of b (%d)", m.size(), o.size(), m.cols(), o.rows())
+	}
+	r := newMatrix(m.rows(), o.cols())
+	for i := range r {
+		for k, mik := range m[i] {
+			for j, okj := range o[k] {
+				r[i][j] += mik * okj
+			}
+		}
+	}
+	return r, nil
+}
+
+// luDecomposition is the factorization PA = LU of a square matrix by Gaussian elimination with
+// partial pivoting. L is unit lower triangular and stored below the diagonal of lu, U on and
+// above it; row i of PA is row perm[i] of A.
+type luDecomposition struct {
+	lu       matrix
+	perm     []int
+	sign     float64 // the determinant of P
+	singular int     // the 1-based column of the first negligible pivot, or 0
+}
+
+// lu factorizes the square matrix m. A pivot no larger than rounding in the elimination is
+// treated as zero, and the matrix is then singular.
+func (m matrix) lu() luDecomposition {
+	const eps = 0x1p-52
+	n := m.rows()
+	d := luDecomposition{lu: m.clone(), perm: make([]int, n), sign: 1}
+	for i := range d.perm {
+		d.perm[i] = i
+	}
+	a := d.lu
+	tolerance := float64(n) * eps * m.norm()
+	for k := range n {
+		p := k
+		for i := k + 1; i < n; i++ {
+			if math.Abs(a[i][k]) > math.Abs(a[p][k]) {
+				p = i
+			}
+		}
+		if p != k {
+			a[p], a[k] = a[k], a[p]
+			d.perm[p], d.perm[k] = d.perm[k], d.perm[p]
+			d.sign = -d.sign
+		}
+		if math.Abs(a[k][k]) <= tolerance && d.singular == 0 {
+			d.singular = k + 1
+		}
+		if a[k][k] == 0 {
+			// The column is already zero below the diagonal
+			continue
+		}
+		for i := k + 1; i < n; i++ {
+			a[i][k] /= a[k][k]
+			for j := k + 1; j < n; j++ {
+				a[i][j] -= a[i][k] * a[k][j]
+			}
+		}
+	}
+	return d
+}
+
+// determinant returns the product of the pivots, with the sign of the row permutation
+func (d luDecomposition) determinant() float64 {
+	det := d.sign
+	for i, row := range d.lu {
+		det *= row[i]
+	}
+	return det
+}
+
+// factors returns P, L and U as separate matrices
+func (d luDecomposition) factors() (p, l, u matrix) {
+	n := len(d.lu)
+	p, l, u = newMatrix(n, n), identity(n), newMatrix(n, n)
+	for i, row := range d.lu {
+		p[i][d.perm[i]] = 1
+		copy(l[i][:i], row[:i])
+		copy(u[i][i:], row[i:])
+	}
+	return p, l, u
+}
+
+// solve returns X with AX = B by forward and back substitution
+func (d luDecomposition) solve(b matrix) (matrix, error) {
+	n := len(d.lu)
+	if b.rows() != n {
+		return nil, dimensionError("cannot solve a system with a %d×%d matrix and a right-hand side with %d rows", n, n, b.rows())
+	}
+	if d.singular != 0 {
+		return nil, newExprError(errKindSingular, 0, 0, "the matrix is singular (pivot %d is zero), so the system has no unique solution", d.singular)
+	}
+	x := newMatrix(n, b.cols())
+	for i, p := range d.perm {
+		copy(x[i], b[p])
+	}
+	for j := range b.cols() {
+		for i := range n {
+			for k := range i {
+				x[i][j] -= d.lu[i][k] * x[k][j]
+			}
+		}
+		for i := n - 1; i >= 0; i-- {
+			for k := i + 1; k < n; k++ {
+				x[i][j] -= d.lu[i][k] * x[k][j]
+			}
+			x[i][j] /= d.lu[i][i]
+		}
+	}
+	return x, nil
+}
+
+// rank counts the pivots of Gaussian elimination with complete pivoting that are larger than
+// rounding in the elimination
+func (m matrix) rank() int {
+	const eps = 0x1p-52
+	a := m.clone()
+	rows, cols := m.rows(), m.cols()
+	tolerance := float64(max(rows, cols)) * eps * m.norm()
+	for k := range min(rows, cols) {
+		p, q := k, k
+		for i := k; i < rows; i++ {
+			for j := k; j < cols; j++ {
+				if math.Abs(a[i][j]) > math.Abs(a[p][q]) {
+					p, q = i, j
+				}
+			}
+		}
+		if math.Abs(a[p][q]) <= tolerance {
+			return k
+		}
+		a[p], a[k] = a[k], a[p]
+		for _, row := range a {
+			row[q], row[k] = row[k], row[q]
+		}
+		for i := k + 1; i < rows; i++ {
+			f := a[i][k] / a[k][k]
+			for j := k; j < cols; j++ {
+				a[i][j] -= f * a[k][j]
+			}
+		}
+	}
+	return min(rows, cols)
+}
+
+// qr factorizes m as QR with Householder reflections, where Q is orthogonal and R upper
+// triangular with a non-negative diagonal
+func (m matrix) qr() (q, r matrix) {
+	rows, cols := m.rows(), m.cols()
+	q, r = identity(rows), m.clone()
+	v := make([]float64, rows)
+	for k := range min(rows-1, cols) {
+		// The reflection maps column k on and below the diagonal onto a multiple of e_k
+		var norm float64
+		for i := k; i < rows; i++ {
+			norm = math.Hypot(norm, r[i][k])
+		}
+		if norm == 0 {
+			continue
+		}
+		alpha := -math.Copysign(norm, r[k][k])
+		var vv float64
+		for i := k; i < rows; i++ {
+			v[i] = r[i][k]
+			if i == k {
+				v[i] -= alpha
+			}
+			vv += v[i] * v[i]
+		}
+
+		// R = HR and Q = QH with H = I - 2vv'/v'v
+		for j := k; j < cols; j++ {
+			var s float64
+			for i := k; i < rows; i++ {
+				s += v[i] * r[i][j]
+			}
+			s *= 2 / vv
+			for i := k; i < rows; i++ {
+				r[i][j] -= s * v[i]
+			}
+		}
+		for _, row := range q {
+			var s float64
+			for i := k; i < rows; i++ {
+				s += row[i] * v[i]
+			}
+			s *= 2 / vv
+			for i := k; i < rows; i++ {
+				row[i] -= s * v[i]
+			}
+		}
+		for i := k + 1; i < rows; i++ {
+			r[i][k] = 0
+		}
+	}
+
+	// Flip signs so that the diagonal of R is non-negative, which makes the factorization unique
+	// for a matrix of full column rank
+	for k := range min(rows, cols) {
+		if r[k][k] < 0 {
+			for j := range r[k] {
+				r[k][j] = -r[k][j]
+			}
+			for _, row := range q {
+				row[k] = -row[k]
+			}
+		}
+	}
+	return q, r
+}
+
+// checkSymmetric reports the first pair of entries that differ by more than rounding
+func (m matrix) checkSymmetric() error {
+	const eps = 0x1p-52
+	tolerance := 64 * eps * m.norm()
+	for i := range m {
+		for j := range i {
+			if math.Abs(m[i][j]-m[j][i]) > tolerance {
+				return newExprError(errKindUnsupported, 0, 0, "eigenvalues are only computed for symmetric matrices, but a[%d][%d] = %s and a[%d][%d] = %s", i, j, formatResult(m[i][j]), j, i, formatResult(m[j][i]))
+			}
+		}
+	}
+	return nil
+}
+
+// symmetricEigen computes the eigenvalues of the symmetric matrix m, in ascending order, and
+// unit eigenvectors (returned as rows) with the cyclic Jacobi method, which rotates away the
+// off-diagonal entries until they are negligible. The largest component of each eigenvector is
+// made positive.
+func (m matrix) symmetricEigen() (values []float64, vectors matrix, sweeps int, converged bool) {
+	const eps = 0x1p-52
+	n := m.rows()
+	a, v := m.clone(), identity(n)
+	var frobenius float64
+	for _, row := range m {
+		for _, x := range row {
+			frobenius = math.Hypot(frobenius, x)
+		}
+	}
+
+	for sweeps = 0; sweeps < maxJacobiSweeps; sweeps++ {
+		var off float64
+		for p := range n {
+			for q := p + 1; q < n; q++ {
+				off = math.Hypot(off, a[p][q])
+			}
+		}
+		if off <= eps*frobenius {
+			converged = true
+			break
+		}
+		for p := range n {
+			for q := p + 1; q < n; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				// The rotation through the angle that zeroes a[p][q], as in Numerical Recipes
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if math.IsInf(theta*theta, 0) {
+					t = 1 / (2 * math.Abs(theta))
+				}
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := range n {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := range n {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				a[p][q], a[q][p] = 0, 0
+				for _, row := range v {
+					vp, vq := row[p], row[q]
+					row[p], row[q] = c*vp-s*vq, s*vp+c*vq
+				}
+			}
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(i, j int) int {
+		return cmp.Compare(a[i][i], a[j][j])
+	})
+	values, vectors = make([]float64, n), newMatrix(n, n)
+	for i, k := range order {
+		values[i] = a[k][k]
+		largest := 0
+		for j := range n {
+			vectors[i][j] = v[j][k]
+			if math.Abs(v[j][k]) > math.Abs(v[largest][k]) {
+				largest = j
+			}
+		}
+		if v[largest][k] < 0 {
+			for j := range vectors[i] {
+				vectors[i][j] = -vectors[i][j]
+			}
+		}
+	}
+	return values, vectors, sweeps, converged
+}
+
+// matrixOperand is a matrix argument of the matrix tool. A vector is held as a column.
+type matrixOperand struct {
+	matrix
+	vector bool
+}
+
+// parseMatrix reads a matrix argument: an array of rows, or an array of entries for a vector.
+// Entries are numbers or expressions in calculate syntax such as sqrt(2), evaluated with the
+// session's variables and functions.
+func parseMatrix(v any, vars map[string]float64, funcs map[string]*userFunction) (matrixOperand, error) {
+	items, ok := v.([]any)
+	if !ok || len(items) == 0 {
+		return matrixOperand{}, fmt.Errorf("expected a non-empty array of rows such as [[1, 2], [3, 4]], or of entries for a vector")
+	}
+	if len(items) > maxMatrixSize {
+		return matrixOperand{}, fmt.Errorf("%d rows is more than the limit of %d", len(items), maxMatrixSize)
+	}
+
+	entry := func(x any, at string) (float64, error) {
+		value, err := parseBound(x, vars, funcs)
+		if err != nil {
+			return 0, fmt.Errorf("entry %s: %v", at, err)
+		}
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return 0, fmt.Errorf("entry %s is not a finite number", at)
+		}
+		return value, nil
+	}
+
+	if _, isRow := items[0].([]any); !isRow {
+		m := newMatrix(len(items), 1)
+		for i, x := range items {
+			if _, isRow := x.([]any); isRow {
+				return matrixOperand{}, fmt.Errorf("entry [%d] is an array, but entry [0] is a number", i)
+			}
+			value, err := entry(x, fmt.Sprintf("[%d]", i))
+			if err != nil {
+				return matrixOperand{}, err
+			}
+			m[i][0] = value
+		}
+		return matrixOperand{matrix: m, vector: true}, nil
+	}
+
+	m := make(matrix, len(items))
+	for i, item := range items {
+		row, ok := item.([]any)
+		if !ok {
+			return matrixOperand{}, fmt.Errorf("row %d is not an array", i)
+		}
+		if len(row) == 0 || len(row) > maxMatrixSize {
+			return matrixOperand{}, fmt.Errorf("row %d has %d entries; rows need 1 to %d", i, len(row), maxMatrixSize)
+		}
+		if i > 0 && len(row) != len(m[0]) {
+			return matrixOperand{}, fmt.Errorf("row %d has %d entries, but row 0 has %d", i, len(row), len(m[0]))
+		}
+		m[i] = make([]float64, len(row))
+		for j, x := range row {
+			value, err := entry(x, fmt.Sprintf("[%d][%d]", i, j))
+			if err != nil {
+				return matrixOperand{}, err
+			}
+			m[i][j] = value
+		}
+	}
+	return matrixOperand{matrix: m}, nil
+}
+
+// column returns the single column of m as a vector
+func (m matrix) column() []float64 {
+	v := make([]float64, len(m))
+	for i, row := range m {
+		v[i] = row[0]
+	}
+	return v
+}
+
+// formatMatrix prints m as nested arrays, e.g. [[1, 2], [3, 4]]
+func formatMatrix(m matrix) string {
+	rows := make([]string, len(m))
+	for i, row := range m {
+		rows[i] = formatVector(row)
+	}
+	return "[" + strings.Join(rows, ", ") + "]"
+}
+
+// formatVector prints v as an array, e.g. [1, 2]
+func formatVector(v []float64) string {
+	entries := make([]string, len(v))
+	for i, x := range v {
+		entries[i] = formatResult(x)
+	}
+	return "[" + strings.Join(entries, ", ") + "]"
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// closeMatrices reports whether a and b have the same shape and agree to within tol
+func closeMatrices(a, b matrix, tol float64) bool {
+	if a.rows() != b.rows() || a.cols() != b.cols() {
+		return false
+	}
+	for i := range a {
+		for j := range a[i] {
+			if math.Abs(a[i][j]-b[i][j]) > tol {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestMatrixArithmetic(t *testing.T) {
+	a := matrix{{1, 2}, {3, 4}}
+	b := matrix{{5, 6}, {7, 8}}
+	if sum, err := a.add(b, 1); err != nil || !closeMatrices(sum, matrix{{6, 8}, {10, 12}}, 0) {
+		t.Errorf("a + b = %v, %v", sum, err)
+	}
+	if diff, err := a.add(b, -1); err != nil || !closeMatrices(diff, matrix{{-4, -4}, {-4, -4}}, 0) {
+		t.Errorf("a - b = %v, %v", diff, err)
+	}
+	if product, err := a.mul(b); err != nil || !closeMatrices(product, matrix{{19, 22}, {43, 50}}, 0) {
+		t.Errorf("ab = %v, %v", product, err)
+	}
+	if product, err := (matrix{{1, 2, 3}}).mul(matrix{{1}, {1}, {1}}); err != nil || !closeMatrices(product, matrix{{6}}, 0) {
+		t.Errorf("row times column = %v, %v", product, err)
+	}
+	if tr := (matrix{{1, 2, 3}, {4, 5, 6}}).transpose(); !closeMatrices(tr, matrix{{1, 4}, {2, 5}, {3, 6}}, 0) {
+		t.Errorf("transpose = %v", tr)
+	}
+
+	for _, err := range []error{
+		func() error { _, err := a.add(matrix{{1, 2, 3}}, 1); return err }(),
+		func() error { _, err := a.mul(matrix{{1, 2, 3}}); return err }(),
+		(matrix{{1, 2, 3}}).requireSquare("determinant"),
+	} {
+		if e, ok := err.(*exprError); !ok || e.Kind != errKindDimension {
+			t.Errorf("expected a dimension error, got %v", err)
+		}
+	}
+}
+
+func TestLU(t *testing.T) {
+	tests := []struct {
+		a        matrix
+		det      float64
+		singular int
+	}{
+		{matrix{{4, 3}, {6, 3}}, -6, 0},
+		{matrix{{0, 1}, {1, 0}}, -1, 0},
+		{matrix{{2, -1, 0}, {-1, 2, -1}, {0, -1, 2}}, 4, 0},
+		{matrix{{1, 2}, {2, 4}}, 0, 2},
+		{matrix{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}, 0, 3},
+		{matrix{{0, 0}, {0, 0}}, 0, 1},
+	}
+	for _, tt := range tests {
+		d := tt.a.lu()
+		if det := d.determinant(); math.Abs(det-tt.det) > 1e-12 {
+			t.Errorf("det(%v) = %v, want %v", tt.a, det, tt.det)
+		}
+		if d.singular != tt.singular {
+			t.Errorf("%v: singular = %d, want %d", tt.a, d.singular, tt.singular)
+		}
+		p, l, u := d.factors()
+		pa, _ := p.mul(tt.a)
+		lu, _ := l.mul(u)
+		if !closeMatrices(pa, lu, 1e-12) {
+			t.Errorf("%v: PA = %v but LU = %v", tt.a, pa, lu)
+		}
+	}
+}
+
+func TestSolveAndInverse(t *testing.T) {
+	a := matrix{{2, 1, -1}, {-3, -1, 2}, {-2, 1, 2}}
+	x, err := a.lu().solve(matrix{{8}, {-11}, {-3}})
+	if err != nil || !closeMatrices(x, matrix{{2}, {3}, {-1}}, 1e-12) {
+		t.Errorf("solve = %v, %v", x, err)
+	}
+	inverse, err := a.lu().solve(identity(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product, _ := a.mul(inverse); !closeMatrices(product, identity(3), 1e-12) {
+		t.Errorf("a times its inverse = %v", product)
+	}
+
+	_, err = (matrix{{1, 2}, {2, 4}}).lu().solve(matrix{{1}, {2}})
+	if e, ok := err.(*exprError); !ok || e.Kind != errKindSingular {
+		t.Errorf("expected a singular error, got %v", err)
+	}
+	_, err = a.lu().solve(matrix{{1}, {2}})
+	if e, ok := err.(*exprError); !ok || e.Kind != errKindDimension {
+		t.Errorf("expected a dimension error, got %v", err)
+	}
+}
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		a    matrix
+		want int
+	}{
+		{matrix{{1, 2}, {3, 4}}, 2},
+		{matrix{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}, 2},
+		{matrix{{1, 2, 3}, {2, 4, 6}}, 1},
+		{matrix{{0, 0}, {0, 0}}, 0},
+		{matrix{{1}, {2}, {3}}, 1},
+		{matrix{{1, 0}, {0, 1e-20}}, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.a.rank(); got != tt.want {
+			t.Errorf("rank(%v) = %d, want %d", tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestQR(t *testing.T) {
+	for _, a := range []matrix{
+		{{12, -51, 4}, {6, 167, -68}, {-4, 24, -41}},
+		{{1, 2}, {3, 4}, {5, 6}},
+		{{1, 2, 3}, {4, 5, 6}},
+		{{0, 1}, {0, 0}},
+	} {
+		q, r := a.qr()
+		if qr, _ := q.mul(r); !closeMatrices(qr, a, 1e-12*math.Max(1, a.norm())) {
+			t.Errorf("%v: QR = %v", a, qr)
+		}
+		if qtq, _ := q.transpose().mul(q); !closeMatrices(qtq, identity(a.rows()), 1e-12) {
+			t.Errorf("%v: Q is not orthogonal: %v", a, q)
+		}
+		for i := range r {
+			for j := range min(i, r.cols()) {
+				if r[i][j] != 0 {
+					t.Errorf("%v: R is not upper triangular: %v", a, r)
+				}
+			}
+			if i < r.cols() && r[i][i] < 0 {
+				t.Errorf("%v: R has a negative diagonal entry: %v", a, r)
+			}
+		}
+	}
+
+	q, r := (matrix{{12, -51, 4}, {6, 167, -68}, {-4, 24, -41}}).qr()
+	if !closeMatrices(r, matrix{{14, 21, -14}, {0, 175, -70}, {0, 0, 35}}, 1e-12) || math.Abs(q[0][0]-6.0/7) > 1e-15 {
+		t.Errorf("unexpected factors: Q = %v, R = %v", q, r)
+	}
+}
+
+func TestSymmetricEigen(t *testing.T) {
+	tests := []struct {
+		a    matrix
+		want []float64
+	}{
+		{matrix{{2, 1}, {1, 2}}, []float64{1, 3}},
+		{matrix{{2, -1, 0}, {-1, 2, -1}, {0, -1, 2}}, []float64{2 - math.Sqrt2, 2, 2 + math.Sqrt2}},
+		{matrix{{5, 0}, {0, -1}}, []float64{-1, 5}},
+		{matrix{{1, 1, 1}, {1, 1, 1}, {1, 1, 1}}, []float64{0, 0, 3}},
+	}
+	for _, tt := range tests {
+		values, vectors, _, converged := tt.a.symmetricEigen()
+		if !converged {
+			t.Errorf("%v: did not converge", tt.a)
+		}
+		for i, want := range tt.want {
+			if math.Abs(values[i]-want) > 1e-12 {
+				t.Errorf("eigenvalues of %v = %v, want %v", tt.a, values, tt.want)
+				break
+			}
+		}
+		for i, v := range vectors {
+			var norm float64
+			for j := range v {
+				var s float64
+				for k := range v {
+					s += tt.a[j][k] * v[k]
+				}
+				if math.Abs(s-values[i]*v[j]) > 1e-12 {
+					t.Errorf("%v: %v is not an eigenvector for %v", tt.a, v, values[i])
+				}
+				norm = math.Hypot(norm, v[j])
+			}
+			if math.Abs(norm-1) > 1e-12 {
+				t.Errorf("%v: eigenvector %v is not a unit vector", tt.a, v)
+			}
+		}
+	}
+
+	if e, ok := (matrix{{1, 2}, {3, 4}}).checkSymmetric().(*exprError); !ok || e.Kind != errKindUnsupported {
+		t.Errorf("expected an unsymmetric matrix to be rejected, got %v", e)
+	}
+}
+
+func TestParseMatrix(t *testing.T) {
+	m, err := parseMatrix([]any{[]any{1.0, "sqrt(4)"}, []any{"a", 4.0}}, map[string]float64{"a": 3}, nil)
+	if err != nil || m.vector || !closeMatrices(m.matrix, matrix{{1, 2}, {3, 4}}, 0) {
+		t.Errorf("parseMatrix = %+v, %v", m, err)
+	}
+	v, err := parseMatrix([]any{1.0, 2.0}, nil, nil)
+	if err != nil || !v.vector || !closeMatrices(v.matrix, matrix{{1}, {2}}, 0) {
+		t.Errorf("parseMatrix vector = %+v, %v", v, err)
+	}
+
+	tests := []struct {
+		arg any
+		msg string
+	}{
+		{nil, "non-empty array"},
+		{[]any{}, "non-empty array"},
+		{"[[1]]", "non-empty array"},
+		{[]any{[]any{1.0, 2.0}, []any{3.0}}, "row 1 has 1 entries, but row 0 has 2"},
+		{[]any{[]any{1.0}, 2.0}, "row 1 is not an array"},
+		{[]any{1.0, []any{2.0}}, "entry [1] is an array"},
+		{[]any{[]any{}}, "row 0 has 0 entries"},
+		{[]any{"1/0"}, "entry [0]"},
+		{[]any{"inf"}, "entry [0] is not a finite number"},
+		{make([]any, maxMatrixSize+1), "limit"},
+	}
+	for _, tt := range tests {
+		if _, err := parseMatrix(tt.arg, nil, nil); err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("parseMatrix(%v): got %v, want an error containing %q", tt.arg, err, tt.msg)
+		}
+	}
+}
+
+func TestMatrixTool(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out matrixOutput
+	callTool(t, cs, "matrix", map[string]any{"operation": "multiply", "a": [][]float64{{1, 2}, {3, 4}}, "b": [][]float64{{5, 6}, {7, 8}}}, &out)
+	if out.Result != "ab = [[19, 22], [43, 50]]" || !closeMatrices(out.Matrix, matrix{{19, 22}, {43, 50}}, 0) {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = matrixOutput{}
+	callTool(t, cs, "matrix", map[string]any{"operation": "solve", "a": [][]float64{{2, 1}, {1, 3}}, "b": []float64{3, 5}}, &out)
+	if out.Matrix != nil || len(out.Vector) != 2 || math.Abs(out.Vector[0]-0.8) > 1e-15 || math.Abs(out.Vector[1]-1.4) > 1e-15 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = matrixOutput{}
+	callTool(t, cs, "matrix", map[string]any{"operation": "determinant", "a": []any{[]any{"cos(pi/3)", 1}, []any{0, 2}}}, &out)
+	if out.Value == nil || math.Abs(*out.Value-1) > 1e-15 || out.Result != "det(a) = 1" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = matrixOutput{}
+	callTool(t, cs, "matrix", map[string]any{"operation": "rank", "a": [][]float64{{0, 0}, {0, 0}}}, &out)
+	if out.Value == nil || *out.Value != 0 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = matrixOutput{}
+	callTool(t, cs, "matrix", map[string]any{"operation": "LU", "a": [][]float64{{1, 2}, {3, 4}}}, &out)
+	if !closeMatrices(out.P, matrix{{0, 1}, {1, 0}}, 0) || !closeMatrices(out.U, matrix{{3, 4}, {0, 2.0 / 3}}, 1e-15) || out.L[1][0] != 1.0/3 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = matrixOutput{}
+	callTool(t, cs, "matrix", map[string]any{"operation": "eigenvalues", "a": [][]float64{{2, 1}, {1, 2}}}, &out)
+	if len(out.Eigenvalues) != 2 || math.Abs(out.Eigenvalues[0]-1) > 1e-15 || math.Abs(out.Eigenvalues[1]-3) > 1e-15 || len(out.Eigenvectors) != 2 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	// Dimension mismatches and singular matrices come back as structured errors
+	for _, tt := range []struct {
+		args map[string]any
+		kind exprErrorKind
+	}{
+		{map[string]any{"operation": "add", "a": [][]float64{{1, 2}}, "b": [][]float64{{1}, {2}}}, errKindDimension},
+		{map[string]any{"operation": "multiply", "a": [][]float64{{1, 2}}, "b": []float64{1, 2, 3}}, errKindDimension},
+		{map[string]any{"operation": "determinant", "a": [][]float64{{1, 2, 3}, {4, 5, 6}}}, errKindDimension},
+		{map[string]any{"operation": "inverse", "a": [][]float64{{1, 2}, {2, 4}}}, errKindSingular},
+		{map[string]any{"operation": "solve", "a": [][]float64{{1, 2}, {2, 4}}, "b": []float64{1, 2}}, errKindSingular},
+		{map[string]any{"operation": "eigenvalues", "a": [][]float64{{1, 2}, {3, 4}}}, errKindUnsupported},
+	} {
+		out = matrixOutput{}
+		res := callTool(t, cs, "matrix", tt.args, &out)
+		if !res.IsError || out.Error == nil || out.Error.Kind != tt.kind || !strings.HasPrefix(resultText(res), "Matrix error: ") {
+			t.Errorf("%v: expected a %s error, got %q (%+v)", tt.args, tt.kind, resultText(res), out.Error)
+		}
+	}
+
+	for _, args := range []map[string]any{
+		{"operation": "invert", "a": [][]float64{{1}}},
+		{"operation": "add", "a": [][]float64{{1}}},
+		{"operation": "transpose", "a": [][]any{{1, "x +"}}},
+	} {
+		if res := callTool(t, cs, "matrix", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v, got %q", args, resultText(res))
+		}
+	}
+}
@@ -0,0 +1,770 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// node is an expression AST node. Offsets are byte positions in the original input,
+// with end exclusive.
+type node interface {
+	span() (start, end int)
+}
+
+// numberNode is a numeric literal; text keeps the literal as written
+type numberNode struct {
+	value      float64
+	text       string
+	start, end int
+}
+
+// identNode is a reference to a variable or named constant
+type identNode struct {
+	name       string
+	start, end int
+}
+
+// unaryNode is a prefix '+', '-' or '~' applied to operand
+type unaryNode struct {
+	op      string
+	operand node
+	start   int
+}
+
+// binaryNode is an infix operator; opPos is the offset of the operator token. An implicit
+// multiplication such as 2x or 2(3+4) has op "*", implicit set and opPos at its right operand.
+type binaryNode struct {
+	op          string
+	left, right node
+	opPos       int
+	implicit    bool
+}
+
+// percentNode is a postfix percentage, b%. As the right operand of + or - it is relative to the
+// left operand, so a + b% = a * (1 + b/100); anywhere else it is b/100.
+type percentNode struct {
+	operand    node
+	start, end int
+}
+
+// factorialNode is a postfix factorial, n!, or double factorial, n!!
+type factorialNode struct {
+	operand    node
+	double     bool
+	start, end int
+}
+
+// conditionalNode selects then or otherwise by cond; it is written cond ? then : otherwise or
+// if(cond, then, otherwise)
+type conditionalNode struct {
+	cond, then, otherwise node
+	start, end            int
+}
+
+// callNode is a function call spanning from its name to the closing parenthesis
+type callNode struct {
+	name       string
+	args       []node
+	start, end int
+}
+
+func (n *numberNode) span() (int, int) { return n.start, n.end }
+func (n *identNode) span() (int, int)  { return n.start, n.end }
+func (n *callNode) span() (int, int)   { return n.start, n.end }
+
+func (n *conditionalNode) span() (int, int) { return n.start, n.end }
+func (n *percentNode) span() (int, int)     { return n.start, n.end }
+func (n *factorialNode) span() (int, int)   { return n.start, n.end }
+
+func (n *unaryNode) span() (int, int) {
+	_, end := n.operand.span()
+	return n.start, end
+}
+
+func (n *binaryNode) span() (int, int) {
+	start, _ := n.left.span()
+	_, end := n.right.span()
+	return start, end
+}
+
+// statement is a parsed calculate input: an expression, optionally assigned to a variable
+type statement struct {
+	target string // "" for a plain expression
+	expr   node
+}
+
+// expectedOperand lists what may start an operand, for syntax error reporting
+var expectedOperand = []string{"number", "identifier", "(", "+", "-"}
+
+// maxNestingDepth bounds the nesting of parentheses, unary operators and other operands, so that
+// a deeply nested input is rejected before the recursion of the parser overflows the stack. It
+// admits every parenthesization that fits in the 500 characters of a calculate expression.
+const maxNestingDepth = 250
+
+// parser is a recursive-descent parser producing an AST from a token stream
+type parser struct {
+	tokens []token
+	pos    int
+	syntax syntax
+	depth  int // operands being parsed, one inside the other
+}
+
+// nest counts one more level of nesting at the next token, failing beyond maxNestingDepth.
+// The caller undoes it with p.depth-- when the level is parsed.
+func (p *parser) nest() error {
+	if p.depth++; p.depth > maxNestingDepth {
+		t := p.peek()
+		return tokenError(errKindUnsupported, t, "expression is nested more than %d levels deep at position %d", maxNestingDepth, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// peekKeyword reports whether the next token is the given keyword
+func (p *parser) peekKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.text == keyword
+}
+
+// peekOperator reports whether the next token is one of the given operators
+func (p *parser) peekOperator(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExpression parses a complete expression
+func parseExpression(expr string) (node, error) {
+	p, err := newParser(expr, syntaxStandard)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseExpression()
+}
+
+// parseStatement parses either an expression or an assignment of the form "name = expression"
+func parseStatement(expr string) (*statement, error) {
+	return parseStatementSyntax(expr, syntaxStandard)
+}
+
+// parseStatementSyntax is parseStatement for a given grammar variant
+func parseStatementSyntax(expr string, syn syntax) (*statement, error) {
+	p, err := newParser(expr, syn)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := p.tokens
+	if len(tokens) < 3 || tokens[0].kind != tokenIdent || tokens[1].kind != tokenOperator || tokens[1].text != "=" {
+		n, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		return &statement{expr: n}, nil
+	}
+
+	name := tokens[0].text
+	if err := checkAssignable(name); err != nil {
+		return nil, tokenError(errKindInvalidAssignment, tokens[0], "%v", err)
+	}
+	p.pos = 2
+	if p.peek().kind == tokenEOF {
+		return nil, tokenError(errKindInvalidAssignment, p.peek(), "missing value in assignment to '%s'", name).withExpected(expectedOperand...)
+	}
+	n, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &statement{target: name, expr: n}, nil
+}
+
+func newParser(expr string, syn syntax) (*parser, error) {
+	tokens, err := tokenize(expr, syn)
+	if err != nil {
+		return nil, err
+	}
+	if tokens[0].kind == tokenEOF {
+		return nil, newExprError(errKindSyntax, 0, len(expr), "empty expression").withExpected(expectedOperand...)
+	}
+	return &parser{tokens: tokens, syntax: syn}, nil
+}
+
+// parseExpression parses an expression that must consume all remaining input
+func (p *parser) parseExpression() (node, error) {
+	n, err := p.parseLowest()
+	if err != nil {
+		return nil, err
+	}
+	// A unit conversion applies to the whole expression: 5 km / 20 min to m/s
+	if p.syntax == syntaxUnits && p.peekKeyword("to") {
+		op := p.next()
+		target, err := p.parseOperand(op, p.parseLowest)
+		if err != nil {
+			return nil, err
+		}
+		n = &binaryNode{op: "to", left: n, right: target, opPos: op.pos}
+	}
+	// Check for leftover tokens (e.g., unmatched closing parentheses)
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, tokenError(errKindSyntax, t, "unexpected %s at position %d", t.describe(), t.pos).withExpected("operator", "end of expression")
+	}
+	return n, nil
+}
+
+// parseLowest parses an expression at the loosest precedence level of the grammar
+func (p *parser) parseLowest() (node, error) {
+	return p.parseConditional()
+}
+
+// parseConditional handles cond ? a : b (right-associative, loosest of all operators)
+func (p *parser) parseConditional() (node, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekOperator("?") {
+		return cond, nil
+	}
+
+	question := p.next()
+	then, err := p.parseOperand(question, p.parseConditional)
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekOperator(":") {
+		t := p.peek()
+		return nil, tokenError(errKindSyntax, t, "unexpected %s at position %d, expected ':' of the conditional started at position %d", t.describe(), t.pos, question.pos).withExpected(":")
+	}
+	colon := p.next()
+	otherwise, err := p.parseOperand(colon, p.parseConditional)
+	if err != nil {
+		return nil, err
+	}
+
+	start, _ := cond.span()
+	_, end := otherwise.span()
+	return &conditionalNode{cond: cond, then: then, otherwise: otherwise, start: start, end: end}, nil
+}
+
+// parseOr handles the logical 'or' keyword
+func (p *parser) parseOr() (node, error) {
+	return p.parseKeywordChain(p.parseAnd, "or")
+}
+
+// parseAnd handles the logical 'and' keyword, which binds tighter than 'or'
+func (p *parser) parseAnd() (node, error) {
+	return p.parseKeywordChain(p.parseNot, "and")
+}
+
+// parseKeywordChain parses a left-associative chain of a keyword operator
+func (p *parser) parseKeywordChain(next func() (node, error), keyword string) (node, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekKeyword(keyword) {
+		op := p.next()
+		right, err := p.parseOperand(op, next)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: keyword, left: left, right: right, opPos: op.pos}
+	}
+
+	return left, nil
+}
+
+// parseNot handles the logical 'not' keyword, which binds looser than comparisons: not a < b = not (a < b)
+func (p *parser) parseNot() (node, error) {
+	if !p.peekKeyword("not") {
+		return p.parseComparison()
+	}
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	op := p.next()
+	operand, err := p.parseOperand(op, p.parseNot)
+	if err != nil {
+		return nil, err
+	}
+	return &unaryNode{op: "not", operand: operand, start: op.pos}, nil
+}
+
+// comparisonOperators are the binary operators with a truth value
+var comparisonOperators = []string{"==", "!=", "<", "<=", ">", ">="}
+
+// parseComparison handles a single comparison. Chains such as 1 < x < 3 are rejected rather
+// than given a surprising meaning.
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseArithmetic()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekOperator(comparisonOperators...) {
+		return left, nil
+	}
+
+	op := p.next()
+	right, err := p.parseOperand(op, p.parseArithmetic)
+	if err != nil {
+		return nil, err
+	}
+	if p.peekOperator(comparisonOperators...) {
+		t := p.peek()
+		return nil, tokenError(errKindSyntax, t, "comparisons cannot be chained; combine them with 'and', e.g. a < b and b < c")
+	}
+	return &binaryNode{op: op.text, left: left, right: right, opPos: op.pos}, nil
+}
+
+// parseArithmetic parses the operands of comparisons: arithmetic, and bitwise operators in programmer syntax
+func (p *parser) parseArithmetic() (node, error) {
+	if p.syntax == syntaxProgrammer {
+		return p.parseBitOr()
+	}
+	return p.parseAddSub()
+}
+
+// parseBitOr handles the programmer-syntax bitwise operators. As in Python, they bind looser
+// than arithmetic, from loosest to tightest: | then ^ (XOR) then & then << and >>.
+func (p *parser) parseBitOr() (node, error) {
+	return p.parseLeftAssoc(p.parseBitXor, "|")
+}
+
+func (p *parser) parseBitXor() (node, error) {
+	return p.parseLeftAssoc(p.parseBitAnd, "^")
+}
+
+func (p *parser) parseBitAnd() (node, error) {
+	return p.parseLeftAssoc(p.parseShift, "&")
+}
+
+func (p *parser) parseShift() (node, error) {
+	return p.parseLeftAssoc(p.parseAddSub, "<<", ">>")
+}
+
+// parseLeftAssoc parses a left-associative chain of the given operators over operands parsed by next.
+// XOR is stored as op "xor", since "^" denotes exponentiation in the AST.
+func (p *parser) parseLeftAssoc(next func() (node, error), ops ...string) (node, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekOperator(ops...) {
+		op := p.next()
+		right, err := p.parseOperand(op, next)
+		if err != nil {
+			return nil, err
+		}
+		name := op.text
+		if name == "^" {
+			name = "xor"
+		}
+		left = &binaryNode{op: name, left: left, right: right, opPos: op.pos}
+	}
+
+	return left, nil
+}
+
+// parseAddSub handles addition and subtraction
+func (p *parser) parseAddSub() (node, error) {
+	left, err := p.parseMulDiv()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekOperator("+", "-") {
+		op := p.next()
+		right, err := p.parseOperand(op, p.parseMulDiv)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op.text, left: left, right: right, opPos: op.pos}
+	}
+
+	return left, nil
+}
+
+// parseMulDiv handles multiplication, division, modulo and floor division (higher precedence).
+// An operand directly followed by '(' or an identifier is multiplied implicitly, with the same
+// precedence as '*': 2(3+4), (1+2)(3+4) and 3pi, but also 1/2x = (1/2)*x.
+func (p *parser) parseMulDiv() (node, error) {
+	left, err := p.parseMulOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.peekOperator("*", "/", "//", "%") {
+			op := p.next()
+			right, err := p.parseOperand(op, p.parseMulOperand)
+			if err != nil {
+				return nil, err
+			}
+			left = &binaryNode{op: op.text, left: left, right: right, opPos: op.pos}
+			continue
+		}
+		if !p.peekImplicitOperand() {
+			return left, nil
+		}
+		pos := p.peek().pos
+		right, err := p.parseMulOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "*", left: left, right: right, opPos: pos, implicit: true}
+	}
+}
+
+// peekImplicitOperand reports whether the next token starts the right operand of an implicit
+// multiplication. Numbers do not, so a missing operator in "2 3" is still reported.
+func (p *parser) peekImplicitOperand() bool {
+	t := p.peek()
+	return t.kind == tokenLParen || (t.kind == tokenIdent && !keywords[t.text] && t.text != "to")
+}
+
+// parseMulOperand parses an operand of multiplication and division. In units syntax a number
+// may be followed by units, which bind tighter than * and /: 5 km / 20 min = (5 km) / (20 min).
+func (p *parser) parseMulOperand() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil || p.syntax != syntaxUnits || p.tokens[p.pos-1].kind != tokenNumber {
+		return left, err
+	}
+
+	for p.peekUnit() {
+		start := p.peek().pos
+		unit, err := p.parsePower()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "*", left: left, right: unit, opPos: start}
+	}
+
+	return left, nil
+}
+
+// peekUnit reports whether the next token is an identifier that can name a unit after a number,
+// rather than a keyword or a function call
+func (p *parser) peekUnit() bool {
+	t := p.peek()
+	if t.kind != tokenIdent || keywords[t.text] || t.text == "to" {
+		return false
+	}
+	return p.tokens[p.pos+1].kind != tokenLParen
+}
+
+// parseOperand parses the right-hand operand of a binary operator, reporting a dangling operator clearly
+func (p *parser) parseOperand(op token, parse func() (node, error)) (node, error) {
+	if p.peek().kind == tokenEOF {
+		return nil, tokenError(errKindSyntax, op, "operator '%s' at end of expression", op.text).withExpected(expectedOperand...)
+	}
+	return parse()
+}
+
+// parseUnary handles unary operators (+ and -, and ~ in programmer syntax).
+// Unary operators bind looser than exponentiation, so -2^2 = -(2^2) = -4.
+func (p *parser) parseUnary() (node, error) {
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	if p.peekOperator("+", "-") || (p.syntax == syntaxProgrammer && p.peekOperator("~")) {
+		op := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op.text, operand: operand, start: op.pos}, nil
+	}
+
+	return p.parsePower()
+}
+
+// parsePower handles exponentiation with '^' or '**' (right-associative, binds tighter than unary minus).
+// In programmer syntax only '**' is exponentiation.
+func (p *parser) parsePower() (node, error) {
+	base, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	base = p.parsePostfix(base)
+
+	if !p.peekOperator("**") && (p.syntax == syntaxProgrammer || !p.peekOperator("^")) {
+		return base, nil
+	}
+	op := p.next()
+
+	// The exponent may itself carry a sign and further powers: 2^-1, 2^3^2 = 2^(3^2)
+	exponent, err := p.parseOperand(op, p.parseUnary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &binaryNode{op: "^", left: base, right: exponent, opPos: op.pos}, nil
+}
+
+// parsePostfix applies postfix operators to a factor: the factorials n! and n!!, and percentages.
+// A '%' that is not followed by an operand is a percentage (15%, 200 + 15%, 15% * x), while
+// 17 % 5 is still modulo. A sign written directly against its operand is an operand, so 7 % -3 is
+// modulo but 15% - 3 subtracts from a percentage. In programmer syntax '%' is always modulo.
+func (p *parser) parsePostfix(n node) node {
+	for {
+		start, _ := n.span()
+		switch {
+		case p.peekOperator("!", "!!"):
+			t := p.next()
+			n = &factorialNode{operand: n, double: t.text == "!!", start: start, end: t.pos + len(t.text)}
+		case p.syntax != syntaxProgrammer && p.peekOperator("%") && !p.operandFollows(p.pos+1):
+			t := p.next()
+			n = &percentNode{operand: n, start: start, end: t.pos + 1}
+		default:
+			return n
+		}
+	}
+}
+
+// operandFollows reports whether the token at index i starts an operand
+func (p *parser) operandFollows(i int) bool {
+	t := p.tokens[i]
+	switch t.kind {
+	case tokenNumber, tokenLParen:
+		return true
+	case tokenIdent:
+		return t.text != "and" && t.text != "or" && t.text != "to"
+	case tokenOperator:
+		if t.text != "+" && t.text != "-" {
+			return false
+		}
+		next := p.tokens[i+1]
+		return next.pos == t.pos+1 && p.operandFollows(i+1)
+	}
+	return false
+}
+
+// relativePercent reports whether n is a + b% or a - b%, where the percentage is of a
+func relativePercent(n *binaryNode) bool {
+	_, ok := n.right.(*percentNode)
+	return ok && (n.op == "+" || n.op == "-")
+}
+
+// parseFactor handles numbers, identifiers, function calls and parentheses (highest precedence)
+func (p *parser) parseFactor() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNumber:
+		if p.syntax == syntaxProgrammer {
+			// Integer literals are interpreted by the programmer evaluator for its word size
+			return &numberNode{text: t.text, start: t.pos, end: t.pos + len(t.text)}, nil
+		}
+		val, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, tokenError(errKindSyntax, t, "invalid number format: %s", t.text)
+		}
+		return &numberNode{value: val, text: t.text, start: t.pos, end: t.pos + len(t.text)}, nil
+
+	case tokenLParen:
+		if closing := p.peek(); closing.kind == tokenRParen {
+			return nil, newExprError(errKindSyntax, t.pos, closing.pos+1, "empty parentheses are not allowed").withExpected(expectedOperand...)
+		}
+		n, err := p.parseLowest()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectClosingParen(); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	case tokenIdent:
+		if keywords[t.text] {
+			return p.parseKeywordFactor(t)
+		}
+		if p.peek().kind != tokenLParen {
+			return &identNode{name: t.text, start: t.pos, end: t.pos + len(t.text)}, nil
+		}
+		return p.parseCall(t)
+
+	case tokenEOF:
+		return nil, tokenError(errKindSyntax, t, "unexpected end of expression").withExpected(expectedOperand...)
+	}
+
+	return nil, tokenError(errKindSyntax, t, "unexpected %s at position %d", t.describe(), t.pos).withExpected(expectedOperand...)
+}
+
+// keywords are the reserved words of the grammar, which cannot name variables or functions
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "if": true}
+
+// parseKeywordFactor handles a keyword in operand position, where only if(cond, a, b) is valid
+func (p *parser) parseKeywordFactor(t token) (node, error) {
+	if t.text != "if" {
+		return nil, tokenError(errKindSyntax, t, "unexpected '%s' at position %d", t.text, t.pos).withExpected(expectedOperand...)
+	}
+	if p.peek().kind != tokenLParen {
+		return nil, tokenError(errKindSyntax, t, "'if' must be called as if(condition, value if true, value if false)").withExpected("(")
+	}
+	n, err := p.parseCall(t)
+	if err != nil {
+		return nil, err
+	}
+	call := n.(*callNode)
+	if len(call.args) != 3 {
+		return nil, nodeError(errKindArity, call, "function 'if' expects 3 arguments (condition, value if true, value if false), got %d", len(call.args))
+	}
+	return &conditionalNode{cond: call.args[0], then: call.args[1], otherwise: call.args[2], start: call.start, end: call.end}, nil
+}
+
+// parseCall parses the argument list of a function call
+func (p *parser) parseCall(name token) (node, error) {
+	p.next() // consume '('
+
+	var args []node
+	if p.peek().kind != tokenRParen {
+		for {
+			arg, err := p.parseLowest()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	closing, err := p.expectClosingParen()
+	if err != nil {
+		return nil, err
+	}
+
+	return &callNode{name: name.text, args: args, start: name.pos, end: closing.pos + 1}, nil
+}
+
+// expectClosingParen consumes a ')' or reports the mismatch
+func (p *parser) expectClosingParen() (token, error) {
+	t := p.peek()
+	if t.kind == tokenRParen {
+		return p.next(), nil
+	}
+	if t.kind == tokenEOF {
+		return t, tokenError(errKindSyntax, t, "mismatched parentheses: missing closing parenthesis").withExpected(")")
+	}
+	return t, tokenError(errKindSyntax, t, "unexpected %s at position %d, expected ')'", t.describe(), t.pos).withExpected(")")
+}
+
+// walk calls visit for n and each of its descendants, parents first
+func walk(n node, visit func(node)) {
+	visit(n)
+	switch n := n.(type) {
+	case *unaryNode:
+		walk(n.operand, visit)
+	case *percentNode:
+		walk(n.operand, visit)
+	case *factorialNode:
+		walk(n.operand, visit)
+	case *binaryNode:
+		walk(n.left, visit)
+		walk(n.right, visit)
+	case *conditionalNode:
+		walk(n.cond, visit)
+		walk(n.then, visit)
+		walk(n.otherwise, visit)
+	case *callNode:
+		for _, arg := range n.args {
+			walk(arg, visit)
+		}
+	}
+}
+
+// implicitWarnings explains each implicit multiplication whose left operand is a quotient, such
+// as 1/2x, which is read as (1/2)*x although 1/(2x) may have been meant. It returns nil when expr
+// does not parse; the parse error is reported by evaluation.
+func implicitWarnings(expr string, syn syntax) []string {
+	stmt, err := parseStatementSyntax(expr, syn)
+	if err != nil {
+		return nil
+	}
+	var warnings []string
+	walk(stmt.expr, func(n node) {
+		mul, ok := n.(*binaryNode)
+		if !ok || !mul.implicit {
+			return
+		}
+		quo, ok := mul.left.(*binaryNode)
+		if !ok || (quo.op != "/" && quo.op != "//" && quo.op != "%") {
+			return
+		}
+		divisor := &binaryNode{op: "*", left: quo.right, right: mul.right}
+		meant := &binaryNode{op: quo.op, left: quo.left, right: divisor}
+		warnings = append(warnings, fmt.Sprintf("'%s' was read as %s, since implicit multiplication has the same precedence as %s; write %s to divide by %s",
+			sourceText(expr, mul), "("+formatNodeSyntax(quo, syn)+")*"+formatOperand(mul.right, precMultiplicative, true, syn), quo.op,
+			formatNodeSyntax(meant, syn), formatNodeSyntax(divisor, syn)))
+	})
+	return warnings
+}
+
+// sourceText returns the text of n in expr. Node spans leave out the parentheses around an
+// operand, so the span is widened to the parentheses it opens or closes without matching:
+// (1+2)/3(4) rather than 1+2)/3(4.
+func sourceText(expr string, n node) string {
+	start, end := n.span()
+	depth, lowest := 0, 0
+	for _, c := range expr[start:end] {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			lowest = min(lowest, depth)
+		}
+	}
+	for open := -lowest; open > 0 && start > 0; start-- {
+		if expr[start-1] == '(' {
+			open--
+		}
+	}
+	for closing := depth - lowest; closing > 0 && end < len(expr); end++ {
+		if expr[end] == ')' {
+			closing--
+		}
+	}
+	return strings.TrimSpace(expr[start:end])
+}
+
+// checkAssignable reports whether name may be used as a variable
+func checkAssignable(name string) error {
+	if keywords[name] {
+		return fmt.Errorf("cannot assign to keyword '%s'", name)
+	}
+	if _, ok := mathConstants[name]; ok {
+		return fmt.Errorf("cannot assign to constant '%s'", name)
+	}
+	if _, ok := builtinFunctions[name]; ok {
+		return fmt.Errorf("cannot assign to function '%s'", name)
+	}
+	if name == lastResultVariable {
+		return fmt.Errorf("cannot assign to '%s', it always holds the last result", name)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sexpr renders an AST as a fully parenthesized prefix expression for structural comparison
+func sexpr(n node) string {
+	switch n := n.(type) {
+	case *numberNode:
+		return n.text
+	case *identNode:
+		return n.name
+	case *unaryNode:
+		return fmt.Sprintf("(%s %s)", n.op, sexpr(n.operand))
+	case *binaryNode:
+		return fmt.Sprintf("(%s %s %s)", n.op, sexpr(n.left), sexpr(n.right))
+	case *percentNode:
+		return fmt.Sprintf("(pct %s)", sexpr(n.operand))
+	case *factorialNode:
+		if n.double {
+			return fmt.Sprintf("(!! %s)", sexpr(n.operand))
+		}
+		return fmt.Sprintf("(! %s)", sexpr(n.operand))
+	case *conditionalNode:
+		return fmt.Sprintf("(? %s %s %s)", sexpr(n.cond), sexpr(n.then), sexpr(n.otherwise))
+	case *callNode:
+		parts := []string{n.name}
+		for _, arg := range n.args {
+			parts = append(parts, sexpr(arg))
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	}
+	return fmt.Sprintf("<%T>", n)
+}
+
+func TestParseStructure(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"2+3*4", "(+ 2 (* 3 4))"},
+		{"(2+3)*4", "(* (+ 2 3) 4)"},
+		{"1-2-3", "(- (- 1 2) 3)"},
+		{"2^3^2", "(^ 2 (^ 3 2))"},
+		{"2**3", "(^ 2 3)"},
+		{"-2^2", "(- (^ 2 2))"},
+		{"2^-1", "(^ 2 (- 1))"},
+		{"100//7%4", "(% (// 100 7) 4)"},
+		{"max(1, 2+3, x)", "(max 1 (+ 2 3) x)"},
+		{"((((1))))", "1"},
+		{"1 + 2 > 3 * 4", "(> (+ 1 2) (* 3 4))"},
+		{"not x == 1 or y and z", "(or (not (== x 1)) (and y z))"},
+		{"x > 0 ? 1 : y < 0 ? -1 : 0", "(? (> x 0) 1 (? (< y 0) (- 1) 0))"},
+		{"if(x >= 0, x, -x) * 2", "(* (? (>= x 0) x (- x)) 2)"},
+		{"200 + 15%", "(+ 200 (pct 15))"},
+		{"15% * x - 3", "(- (* (pct 15) x) 3)"},
+		{"17 % 5", "(% 17 5)"},
+		{"7 % -3", "(% 7 (- 3))"},
+		{"2^50%", "(^ 2 (pct 50))"},
+		{"-3!^2", "(- (^ (! 3) 2))"},
+		{"5!! + 2!", "(+ (!! 5) (! 2))"},
+		{"2(3+4)", "(* 2 (+ 3 4))"},
+		{"(1+2)(3+4)", "(* (+ 1 2) (+ 3 4))"},
+		{"3pi", "(* 3 pi)"},
+		{"2x^2", "(* 2 (^ x 2))"},
+		{"1/2x", "(* (/ 1 2) x)"},
+		{"-2x", "(* (- 2) x)"},
+		{"2 sqrt(x) y", "(* (* 2 (sqrt x)) y)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := parseExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sexpr(n); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseProgrammerStructure(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"1 | 2 ^ 3 & 4", "(| 1 (xor 2 (& 3 4)))"},
+		{"1 << 2 + 3", "(<< 1 (+ 2 3))"},
+		{"x & 0xFF >> 4", "(& x (>> 0xFF 4))"},
+		{"~x ^ -1", "(xor (~ x) (- 1))"},
+		{"2**3**2", "(^ 2 (^ 3 2))"},
+		{"(1 | 2) & 3", "(& (| 1 2) 3)"},
+		{"max(1 | 2, 0b11)", "(max (| 1 2) 0b11)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			stmt, err := parseStatementSyntax(tt.expr, syntaxProgrammer)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sexpr(stmt.expr); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	expr := "1 + sqrt(16) * -x"
+	n, err := parseExpression(expr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sum := n.(*binaryNode)
+	product := sum.right.(*binaryNode)
+	call := product.left.(*callNode)
+	neg := product.right.(*unaryNode)
+
+	for _, tc := range []struct {
+		name string
+		n    node
+		text string
+	}{
+		{"sum", sum, "1 + sqrt(16) * -x"},
+		{"product", product, "sqrt(16) * -x"},
+		{"call", call, "sqrt(16)"},
+		{"negation", neg, "-x"},
+		{"argument", call.args[0], "16"},
+	} {
+		start, end := tc.n.span()
+		if got := expr[start:end]; got != tc.text {
+			t.Errorf("%s: expected span %q, got %q", tc.name, tc.text, got)
+		}
+	}
+	if sum.opPos != 2 || product.opPos != 13 {
+		t.Errorf("unexpected operator offsets: + at %d, * at %d", sum.opPos, product.opPos)
+	}
+}
+
+// TestParseErrorPositions checks that positions refer to the original input, not a parenthesized substring
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"(1+2))", "unexpected ')' at position 5"},
+		{"(1 + (2 & 3))", "invalid character '&' at position 8"},
+		{"(1 + (2 3))", "unexpected '3' at position 8, expected ')'"},
+		{"max(1, (2,))", "unexpected ',' at position 9, expected ')'"},
+		{"1 + (2 * )", "unexpected ')' at position 9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseExpression(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDeeplyNestedExpression(t *testing.T) {
+	const depth = 240
+	expr := strings.Repeat("(", depth) + "1+1" + strings.Repeat(")", depth)
+
+	result, err := evaluateExpression(expr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != 2 {
+		t.Errorf("expected 2, got %v", result)
+	}
+
+	// Deeper nesting is rejected before the recursion can exhaust the stack
+	for _, expr := range []string{
+		strings.Repeat("(", 100_000) + "1" + strings.Repeat(")", 100_000),
+		strings.Repeat("-", 100_000) + "1",
+		strings.Repeat("not ", 100_000) + "1",
+		strings.Repeat("2^", 100_000) + "1",
+	} {
+		if _, err := parseExpression(expr); err == nil || !strings.Contains(err.Error(), "nested more than 250 levels") {
+			t.Errorf("expected a nesting error, got %v", err)
+		}
+	}
+}
+
+func TestImplicitMultiplication(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"2(3+4)", 14},
+		{"(1+2)(3+4)", 21},
+		{"3pi", 3 * 3.141592653589793},
+		{"2x + 1", 7},
+		{"1/2x", 1.5},
+		{"2^2x", 12},
+		{"(x)(x+1)!", 72},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, result, err := evaluateStatement(tt.expr, map[string]float64{"x": 3})
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if abs(result-tt.expected) > 1e-10 {
+				t.Errorf("%q: expected %v, got %v", tt.expr, tt.expected, result)
+			}
+		})
+	}
+
+	for _, expr := range []string{"2 3", "2 and", "(1)2"} {
+		if _, err := parseExpression(expr); err == nil {
+			t.Errorf("expected %q to be a syntax error", expr)
+		}
+	}
+	if _, _, err := evaluateStatement("x(x+1)", map[string]float64{"x": 3}); err == nil || !strings.Contains(err.Error(), "write x*(...) to multiply") {
+		t.Errorf("expected a hint to multiply explicitly, got %v", err)
+	}
+}
+
+func TestImplicitWarnings(t *testing.T) {
+	for expr, want := range map[string]string{
+		"1/2x + 2x":  "'1/2x' was read as (1/2)*x, since implicit multiplication has the same precedence as /; write 1/(2*x) to divide by 2*x",
+		"6/2(1+2)":   "'6/2(1+2)' was read as (6/2)*(1+2), since implicit multiplication has the same precedence as /; write 6/(2*(1+2)) to divide by 2*(1+2)",
+		"1/2(3+4)":   "'1/2(3+4)' was read as (1/2)*(3+4), since implicit multiplication has the same precedence as /; write 1/(2*(3+4)) to divide by 2*(3+4)",
+		"(1+2)/3(4)": "'(1+2)/3(4)' was read as ((1+2)/3)*4, since implicit multiplication has the same precedence as /; write (1+2)/(3*4) to divide by 3*4",
+	} {
+		if warnings := implicitWarnings(expr, syntaxStandard); len(warnings) != 1 || warnings[0] != want {
+			t.Errorf("%q: unexpected warnings: %q", expr, warnings)
+		}
+	}
+	for _, expr := range []string{"2x/3", "1/(2x)", "1/2*x", "1/2 +"} {
+		if w := implicitWarnings(expr, syntaxStandard); w != nil {
+			t.Errorf("%q: expected no warnings, got %q", expr, w)
+		}
+	}
+}
+
+func TestCalculateImplicitWarning(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "1/2pi"}, &out)
+	if out.Result != "Result: 1/2pi = 1.570796327" || len(out.Warnings) != 1 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"200 + 15%", 230},
+		{"80 - 25%", 60},
+		{"15%", 0.15},
+		{"200 * 15%", 30},
+		{"50 / 25%", 200},
+		{"100 + 10% + 10%", 121},
+		{"(100 + 10%) - 5", 105},
+		{"200 + 15% - 10", 220},
+		{"-15%", -0.15},
+		{"17 % 5", 2},
+		{"7 % -3", -2},
+		{"2 + 17 % 5 * 3", 8},
+		{"max(10%, 5%)", 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := evaluateExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if math.Abs(result-tt.expected) > 1e-10 {
+				t.Errorf("%q: expected %v, got %v", tt.expr, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPercentInOtherModes(t *testing.T) {
+	if _, exact, err := evaluateStatementExact("1/3 + 50%", nil); err != nil || exact.fraction != "1/2" {
+		t.Errorf("exact: expected 1/2, got %v (%v)", exact, err)
+	}
+	if _, str, _, err := evaluateStatementBig(context.Background(), "0.1 + 0.2 - 10%", nil, nil, 20); err != nil || str != "0.27" {
+		t.Errorf("precise: expected 0.27, got %s (%v)", str, err)
+	}
+	if _, z, err := evaluateStatementComplex("(2+2i) + 50%", nil); err != nil || z != 3+3i {
+		t.Errorf("complex: expected 3+3i, got %v (%v)", z, err)
+	}
+	if result, err := evaluateStatementUnits("2 km + 10% to m", nil); err != nil || formatResult(result.value) != "2200" {
+		t.Errorf("units: expected 2200 m, got %v (%v)", result, err)
+	}
+	if _, result, err := evaluateStatementInt("17 % 5", nil, 8, true); err != nil || result.decimal != "2" {
+		t.Errorf("programmer: expected 17 %% 5 = 2, got %v (%v)", result, err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Binding strengths used to print an AST with the fewest parentheses that keep its meaning
+const (
+	precConditional = iota + 1
+	precOr
+	precAnd
+	precNot
+	precComparison
+	precBitOr
+	precBitXor
+	precBitAnd
+	precShift
+	precAdditive
+	precMultiplicative
+	precUnary
+	precPower
+	precPostfix
+	precAtom
+)
+
+// precedence returns how tightly n binds when printed
+func precedence(n node) int {
+	switch n := n.(type) {
+	case *numberNode:
+		if n.value < 0 || strings.HasPrefix(n.text, "-") {
+			return precUnary
+		}
+	case *conditionalNode:
+		return precConditional
+	case *unaryNode:
+		if n.op == "not" {
+			return precNot
+		}
+		return precUnary
+	case *percentNode, *factorialNode:
+		return precPostfix
+	case *binaryNode:
+		return binaryPrecedence(n.op)
+	}
+	return precAtom
+}
+
+func binaryPrecedence(op string) int {
+	switch op {
+	case "or":
+		return precOr
+	case "and":
+		return precAnd
+	case "==", "!=", "<", "<=", ">", ">=":
+		return precComparison
+	case "|":
+		return precBitOr
+	case "xor":
+		return precBitXor
+	case "&":
+		return precBitAnd
+	case "<<", ">>":
+		return precShift
+	case "+", "-":
+		return precAdditive
+	case "^":
+		return precPower
+	case "to":
+		return precConditional
+	}
+	return precMultiplicative
+}
+
+// formatNode prints n in the calculate grammar, e.g. "2+3*4", "(1+2)*x^2" or "x > 0 ? x : -x".
+// Multiplication is always written with '*'.
+func formatNode(n node) string {
+	return formatNodeSyntax(n, syntaxStandard)
+}
+
+// formatNodeSyntax is formatNode for a given grammar variant: in programmer syntax powers are
+// written with '**', since '^' is XOR, and in units syntax a conversion is written "a to b".
+func formatNodeSyntax(n node, syn syntax) string {
+	switch n := n.(type) {
+	case *numberNode:
+		if n.text != "" {
+			return n.text
+		}
+		return formatResult(n.value)
+	case *identNode:
+		return n.name
+	case *unaryNode:
+		if n.op == "not" {
+			return "not " + formatOperand(n.operand, precNot, false, syn)
+		}
+		return n.op + formatOperand(n.operand, precUnary, false, syn)
+	case *percentNode:
+		return formatOperand(n.operand, precPostfix, false, syn) + "%"
+	case *factorialNode:
+		if n.double {
+			return formatOperand(n.operand, precPostfix, false, syn) + "!!"
+		}
+		return formatOperand(n.operand, precPostfix, false, syn) + "!"
+	case *binaryNode:
+		prec := binaryPrecedence(n.op)
+		// ^ is right-associative, comparisons do not chain and the other operators are left-associative
+		leftStrict, rightStrict := false, true
+		switch {
+		case n.op == "^":
+			leftStrict, rightStrict = true, false
+		case prec == precComparison:
+			leftStrict = true
+		}
+		op := n.op
+		switch op {
+		case "xor":
+			op = "^"
+		case "^":
+			if syn == syntaxProgrammer {
+				op = "**"
+			}
+		default:
+			if prec <= precComparison {
+				op = " " + op + " "
+			}
+		}
+		right := formatOperand(n.right, prec, rightStrict, syn)
+		if (n.op == "+" || n.op == "-") && strings.HasPrefix(right, "-") {
+			right = "(" + right + ")"
+		}
+		return formatOperand(n.left, prec, leftStrict, syn) + op + right
+	case *conditionalNode:
+		return formatOperand(n.cond, precConditional, true, syn) + " ? " + formatNodeSyntax(n.then, syn) + " : " + formatNodeSyntax(n.otherwise, syn)
+	case *callNode:
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			args[i] = formatNodeSyntax(arg, syn)
+		}
+		return n.name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return ""
+}
+
+// formatOperand prints an operand of an operator with precedence prec, parenthesizing it when it
+// binds more loosely, or equally loosely if strict
+func formatOperand(n node, prec int, strict bool, syn syntax) string {
+	p := precedence(n)
+	if p < prec || (strict && p == prec) {
+		return "(" + formatNodeSyntax(n, syn) + ")"
+	}
+	return formatNodeSyntax(n, syn)
+}
+
+// literal returns a number node for a computed value
+func literal(v float64) *numberNode {
+	return &numberNode{value: v, text: formatResult(v)}
+}
+
+// boolLiteral returns a number node for a truth value, printed as true or false
+func boolLiteral(b bool) *numberNode {
+	return &numberNode{value: truth(b), text: strconv.FormatBool(b)}
+}
+
+// formatStatement prints the statement expr in the grammar syn with the spacing and parentheses of
+// formatNode, e.g. "r = 2*(a+b)" for "r = 2(a + b)". It returns "" if expr does not parse.
+func formatStatement(expr string, syn syntax) string {
+	stmt, err := parseStatementSyntax(expr, syn)
+	if err != nil {
+		return ""
+	}
+	if stmt.target != "" {
+		return stmt.target + " = " + formatNodeSyntax(stmt.expr, syn)
+	}
+	return formatNodeSyntax(stmt.expr, syn)
+}
@@ -0,0 +1,182 @@
+package main
+
+import "math"
+
+// Limits of sums and products
+const (
+	maxSeriesTerms = 1_000_000
+	maxLevinTerms  = 40 // the Levin transform is swamped by rounding well before this
+	seriesRelTol   = 1e-12
+	levinRelTol    = 1e-8 // the least accuracy accepted from the Levin transform
+)
+
+// seriesResult is the result of a sum or product
+type seriesResult struct {
+	value, errorEstimate float64
+	terms                int
+	accelerated          bool // the value is the Levin extrapolation of an infinite series
+	converged            bool
+}
+
+// series adds up, or with product set multiplies, body for the evaluator's variable running
+// over the integers from first to last. last may be +Inf for an infinite series, which is
+// extrapolated with the Levin u-transform or summed until the terms no longer change it.
+func series(ev *boundEvaluator, body node, first, last float64, product bool) (seriesResult, error) {
+	const eps = 0x1p-52
+	if math.IsInf(last, 1) {
+		return infiniteSeries(ev, body, first, product)
+	}
+
+	r := seriesResult{converged: true}
+	if product {
+		r.value = 1
+	}
+	var compensation, magnitude float64
+	for n := first; n <= last; n++ {
+		a, err := ev.evalFinite(body, n)
+		if err != nil {
+			return r, err
+		}
+		r.terms++
+		if product {
+			r.value *= a
+		} else {
+			// Neumaier's compensated summation
+			t := r.value + a
+			if math.Abs(r.value) >= math.Abs(a) {
+				compensation += (r.value - t) + a
+			} else {
+				compensation += (a - t) + r.value
+			}
+			r.value = t
+			magnitude += math.Abs(a)
+		}
+		if math.IsInf(r.value, 0) {
+			start, end := body.span()
+			return r, newExprError(errKindInvalidResult, start, end, "the result overflows at %s = %s", ev.x, formatResult(n))
+		}
+	}
+
+	// Rounding error bounds: one rounding per factor, and for compensated summation two
+	// roundings of the result plus a second-order term
+	if product {
+		r.errorEstimate = float64(r.terms) * eps * math.Abs(r.value)
+	} else {
+		r.value += compensation
+		r.errorEstimate = 2*eps*math.Abs(r.value) + float64(r.terms)*eps*eps*magnitude
+	}
+	return r, nil
+}
+
+// infiniteSeries evaluates a sum or product from first to infinity. The partial results form a
+// sequence whose limit is estimated with the Levin u-transform. Rounding limits how far the
+// transform can be taken, so the estimate that moved least is kept, and it is accepted when it
+// is stable and the terms have shrunk; the second condition keeps divergent series such as
+// 1 + 2 + 4 + ... from being given the value of their analytic continuation. Otherwise the
+// terms are added up until they decrease geometrically and no longer change the result.
+func infiniteSeries(ev *boundEvaluator, body node, first float64, product bool) (seriesResult, error) {
+	const eps = 0x1p-52
+	r := seriesResult{}
+	current := 0.0
+	if product {
+		current = 1
+	}
+	levin := &levinTransform{}
+	bestEstimate, bestChange := 0.0, math.Inf(1)
+	negligible := 0
+	var largest, previousIncrement, tail float64
+	for k := range maxSeriesTerms {
+		n := first + float64(k)
+		a, err := ev.evalFinite(body, n)
+		if err != nil {
+			return r, err
+		}
+		r.terms++
+
+		// The increment of the partial result is the term of the equivalent series
+		previous := current
+		if product {
+			current *= a
+		} else {
+			current += a
+		}
+		if math.IsInf(current, 0) {
+			start, end := body.span()
+			return r, newExprError(errKindInvalidResult, start, end, "the partial result overflows at %s = %s", ev.x, formatResult(n))
+		}
+		increment := current - previous
+		r.value = current
+		if product && current == 0 {
+			r.converged = true
+			return r, nil
+		}
+
+		// Direct summation has converged when the terms shrink geometrically and no longer
+		// change the result, so that the rest of the series cannot add up to more than rounding
+		geometric := increment == 0 || math.Abs(increment) <= 0.9*math.Abs(previousIncrement)
+		if geometric && math.Abs(increment) <= eps*math.Abs(current) {
+			negligible++
+			tail += math.Abs(increment)
+			if negligible >= 10 {
+				r.errorEstimate = 10*tail + eps*math.Abs(current)
+				r.converged = true
+				return r, nil
+			}
+		} else {
+			negligible, tail = 0, 0
+		}
+		previousIncrement = increment
+		largest = math.Max(largest, math.Abs(increment))
+
+		if k >= maxLevinTerms || increment == 0 {
+			continue
+		}
+		estimate, change := levin.next(current, increment)
+		if k > 1 && change < bestChange && math.Abs(increment) < largest/2 {
+			bestEstimate, bestChange = estimate, change
+		}
+		if bestChange <= seriesRelTol*math.Abs(bestEstimate) || (k == maxLevinTerms-1 && bestChange <= levinRelTol*math.Abs(bestEstimate)) {
+			r.value, r.errorEstimate = bestEstimate, math.Max(bestChange, eps*math.Abs(bestEstimate))
+			r.accelerated, r.converged = true, true
+			return r, nil
+		}
+	}
+
+	// The partial result after the last term, which may be far from the limit
+	r.errorEstimate = math.Abs(previousIncrement) * float64(r.terms)
+	return r, nil
+}
+
+// levinTransform extrapolates the limit of a sequence of partial sums with the Levin
+// u-transform, following Numerical Recipes (3rd ed., section 5.3). numer and denom hold the
+// last diagonal of the transform's numerator and denominator tables.
+type levinTransform struct {
+	numer, denom []float64
+	last         float64
+}
+
+// next adds the partial sum s, whose last term is a, and returns the new estimate of the limit
+// and how much it moved
+func (l *levinTransform) next(s, a float64) (estimate, change float64) {
+	const beta = 1.0
+	n := len(l.numer)
+	term := 1 / (beta + float64(n))
+	l.denom = append(l.denom, term/((beta+float64(n))*a))
+	l.numer = append(l.numer, s*l.denom[n])
+	if n > 0 {
+		ratio := (beta + float64(n) - 1) * term
+		for j := 1; j <= n; j++ {
+			fact := (float64(n-j) + beta) * term
+			l.numer[n-j] = l.numer[n-j+1] - fact*l.numer[n-j]
+			l.denom[n-j] = l.denom[n-j+1] - fact*l.denom[n-j]
+			term *= ratio
+		}
+	}
+	estimate = l.last
+	if math.Abs(l.denom[0]) >= 0x1p-1022 {
+		estimate = l.numer[0] / l.denom[0]
+	}
+	change = math.Abs(estimate - l.last)
+	l.last = estimate
+	return estimate, change
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSeries(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct {
+		expr        string
+		first, last float64
+		product     bool
+		want        float64
+		accelerated bool
+	}{
+		{"n", 1, 100, false, 5050, false},
+		{"n", 1, 10, true, 3628800, false},
+		{"n", 5, 4, false, 0, false},
+		{"n", 5, 4, true, 1, false},
+		{"0.1", 1, 10, false, 1, false},
+		{"1/n^2", 1, inf, false, math.Pi * math.Pi / 6, true},
+		{"(-1)^n/(2n+1)", 0, inf, false, math.Pi / 4, true},
+		{"(-1)^(n+1)/n", 1, inf, false, math.Ln2, true},
+		{"1/n!", 0, inf, false, math.E, true},
+		{"n < 5 ? 1 : 0", 0, inf, false, 5, false},
+		{"1 - 1/(4n^2)", 1, inf, true, 2 / math.Pi, true},
+		{"1 - 1/n", 1, inf, true, 0, false},
+	}
+	for _, tt := range tests {
+		n, err := parseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.expr, err)
+		}
+		ev := &boundEvaluator{ctx: context.Background(), x: "n", vars: map[string]float64{}}
+		r, err := series(ev, n, tt.first, tt.last, tt.product)
+		if err != nil {
+			t.Errorf("%s from %v to %v: %v", tt.expr, tt.first, tt.last, err)
+			continue
+		}
+		if !r.converged || r.accelerated != tt.accelerated || math.Abs(r.value-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("%s from %v to %v = %+v, want %v", tt.expr, tt.first, tt.last, r, tt.want)
+		}
+		if math.Abs(r.value-tt.want) > 10*r.errorEstimate+1e-15 {
+			t.Errorf("%s from %v to %v: error %g exceeds the estimate %g", tt.expr, tt.first, tt.last, math.Abs(r.value-tt.want), r.errorEstimate)
+		}
+		if r.terms != ev.evaluations {
+			t.Errorf("%s: %d terms but %d evaluations", tt.expr, r.terms, ev.evaluations)
+		}
+	}
+}
+
+func TestSeriesDivergent(t *testing.T) {
+	// Geometric series with a ratio above 1 overflow; terms that do not shrink are not
+	// extrapolated to the value of an analytic continuation
+	for _, expr := range []string{"2^n", "(-1)^n", "1/n"} {
+		n, _ := parseExpression(expr)
+		ev := &boundEvaluator{ctx: context.Background(), x: "n", vars: map[string]float64{}}
+		r, err := series(ev, n, 1, math.Inf(1), false)
+		if err == nil && r.converged {
+			t.Errorf("sum of %s converged to %v", expr, r.value)
+		}
+	}
+}
+
+func TestSeriesCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, _ := parseExpression("1/n")
+	if _, err := series(&boundEvaluator{ctx: ctx, x: "n", vars: map[string]float64{}}, n, 1, math.Inf(1), false); err != context.Canceled {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestSumAndProductTools(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out seriesOutput
+	callTool(t, cs, "sum", map[string]any{"expression": "k^2", "index": "k", "from": 1, "to": 10}, &out)
+	if out.Value != 385 || out.Method != "direct" || out.Evaluations != 10 || !strings.HasPrefix(out.Result, "Σ k^2 for k = 1 to 10 = 385") {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = seriesOutput{}
+	callTool(t, cs, "sum", map[string]any{"expression": "2i", "index": "i", "from": 1, "to": 3}, &out)
+	if out.Value != 12 {
+		t.Errorf("expected 12, got %+v", out)
+	}
+
+	out = seriesOutput{}
+	callTool(t, cs, "sum", map[string]any{"expression": "1/n^2", "from": 1, "to": "inf"}, &out)
+	if math.Abs(out.Value-math.Pi*math.Pi/6) > 1e-9 || out.Method != "levin" || !out.Converged || out.ErrorEstimate == 0 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = seriesOutput{}
+	callTool(t, cs, "product", map[string]any{"expression": "n", "from": 1, "to": 5}, &out)
+	if out.Value != 120 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = seriesOutput{}
+	callTool(t, cs, "sum", map[string]any{"expression": "(-1)^n", "from": 0, "to": "inf"}, &out)
+	if out.Converged || !strings.Contains(out.Result, "may diverge") {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	for _, args := range []map[string]any{
+		{"expression": "n", "from": 1.5, "to": 3},
+		{"expression": "n", "from": "-inf", "to": 3},
+		{"expression": "n", "from": 1, "to": 2e6},
+		{"expression": "1/n", "from": 0, "to": 3},
+		{"expression": "n", "from": 1, "to": 3, "index": "pi"},
+	} {
+		if res := callTool(t, cs, "sum", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v, got %q", args, resultText(res))
+		}
+	}
+}
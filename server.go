@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"math"
 	"math/big"
 	"net/http"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -56,17 +59,124 @@ func createMCPServer() *mcp.Server {
 
 	// Calculator tool
 	mcp.AddTool(s, &mcp.Tool{
-		Name:        "calculate",
-		Description: "Perform basic mathematical operations like add, subtract, multiply, and divide",
+		Name: "calculate",
+		Description: "Perform mathematical operations: add (+), subtract (-), multiply (*), divide (/), floor divide (//), modulo (%) and exponentiation (^ or **). Exponentiation is right-associative and binds tighter than unary minus, so -2^2 = -4. " +
+			"A postfix % is a percentage: a + b% = a*(1+b/100) and a - b% = a*(1-b/100) when b% is the right operand of + or - (200 + 15% = 230, 80 - 25% = 60); anywhere else b% = b/100 (15% = 0.15, 200 * 15% = 30). " +
+			"% is modulo when an operand follows it (17 % 5 = 2, 7 % -3 = -2); a sign separated from what follows by a space ends a percentage (15% - 3 = -2.85). In programmer mode % is always the remainder, with the sign of the dividend as in C (-7 % 2 = -1), matching / which truncates toward zero. " +
+			"Built-in functions: " + strings.Join(builtinFunctionNames(), ", ") + ". " +
+			"Named constants: " + strings.Join(constantNames(), ", ") + " (the same values as the math://constants resource). " +
+			"Postfix n! is the factorial (extended to non-integers by the gamma function, so 0.5! = sqrt(pi)/2) and n!! the double factorial; nPr(n, r) counts permutations and nCr(n, r) combinations. Counting results are computed exactly, and integers too large for float64 (30!, nCr(100, 50)) are returned with all their digits, up to 2^65536 (5910!), beyond which they overflow to +Inf; variables and ans hold their nearest float64, so x = 30! keeps about 16 significant digits. " +
+			"Multiplication may be implicit, with the same precedence as *: 2(3+4), (1+2)(3+4), 3pi and 2x^2 = 2*x^2; so 1/2x = (1/2)*x, which is flagged in 'warnings'. " +
+			"Set 'trace' to get the evaluation step by step, as the server performed it. " +
+			"Trigonometric functions use radians, log(x) is the natural logarithm and log(x, base) uses the given base; min and max accept any number of arguments. " +
+			"Assign session variables with 'name = expression' (e.g. 'x = 3.5' then 'y = x*2'); 'ans' always holds the last result. Variables keep full precision and last for the MCP session. " +
+			"Define functions with 'name(params) = expression' (e.g. 'f(x, y) = x^2 + y', then 'f(3, 4)'); they last for the session, may be recursive up to a call depth of " + strconv.Itoa(maxCallDepth) + " and " + strconv.Itoa(maxFunctionCalls) + " calls per evaluation, are evaluated in the default mode and are managed with the functions tool. " +
+			"Comparisons (== != < <= > >=), logical and/or/not and conditionals (cond ? a : b or if(cond, a, b)) return true or false; set 'tolerance' to compare with == approximately. Truth values count as 1 and 0 in arithmetic and are only available in the default mode. " +
+			"Set 'precision' to a number of significant digits to evaluate with arbitrary precision (e.g. 0.1+0.2 = 0.3 exactly, 12345678901234567890*98765 without rounding). " +
+			"Set 'mode' to 'exact' for rational arithmetic: 1/3 + 1/6 returns the fraction 1/2 with its mixed number and decimal forms; irrational results such as sqrt(2) or pi are reported as errors. " +
+			"Set 'mode' to 'complex' to work with complex numbers: i or j is the imaginary unit (3+4i, 2j), sqrt(-4) = 2i, and re, im, arg, conj and polar(r, theta) are available; results are given in rectangular and polar form. " +
+			"Set 'mode' to 'programmer' for integer arithmetic on a word of 'wordSize' bits (8, 16, 32 or 64, 'signed' by default) with wraparound: " +
+			"0xFF, 0b1010 and 0o17 literals, bitwise & | ~ << >>, ^ as XOR and ** for powers; results are shown in decimal, hex, binary and octal. " +
+			"Set 'mode' to 'units' for quantities with units: a number followed by units (5 km, 9.81 m/s^2, 3 N m) with SI base and derived units, SI prefixes (km, ms, kWh) and common imperial units (ft, mi, lb, gal, mph, psi); " +
+			"adding incompatible units (m + s) is a dimension error, 'to' converts the result (5 km / 20 min to km/h), and otherwise the result is given in the simplest SI unit. Temperatures are absolute, in K. " +
+			"Besides the result sentence, the output has the result as a number in 'value', the 'formatted' result, the 'expression' as parsed, the 'mode' and the flags isInteger, isExact and overflowed.",
+		OutputSchema: outputSchema[calculateOutput](map[string][]any{"mode": {"float", "precision", "exact", "complex", "programmer", "units"}}),
 	}, handleCalculate)
 
+	// Batch calculator tool
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "calculate_batch",
+		Description: "Evaluate many calculate expressions in one call, e.g. for a column of a spreadsheet. The expressions are evaluated in order with the calculate grammar and the given mode options; assignments and function definitions carry over to later expressions. " +
+			"Set 'variables' to bindings shared by the whole batch. Session variables and functions are available, but the batch's bindings and assignments last only for the batch. " +
+			"A failed expression does not fail the batch: each entry of 'results' has ok and either the calculate output or the error. At most " + strconv.Itoa(maxBatchExpressions) + " expressions and " + strconv.Itoa(maxBatchLength) + " characters in total, 500 per expression.",
+	}, handleCalculateBatch)
+
 	// Random number generator tool
 	mcp.AddTool(s, &mcp.Tool{
-		Name:        "random_number",
-		Description: "Generate a random number within a specified range using various probability distributions",
+		Name:         "random_number",
+		Description:  "Generate a random number within a specified range using various probability distributions",
+		OutputSchema: outputSchema[randomNumberOutput](map[string][]any{"distribution": distributions}),
 	}, handleRandomNumber)
 
-	log.Println("Loaded tools: calculate, random_number")
+	// Session variables tool
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "variables",
+		Description: "List or clear the variables assigned with calculate in the current session, including 'ans' (the last result)",
+	}, handleVariables)
+
+	// Functions tool
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "functions",
+		Description: "List or delete the functions defined with calculate in the current session, e.g. f(x, y) = x^2 + y",
+	}, handleFunctions)
+
+	// Symbolic differentiation tool
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "differentiate",
+		Description: "Differentiate an expression symbolically, using the calculate grammar: sums, products and quotients, powers, the chain rule and the built-in elementary functions (sqrt, exp, ln, log, trigonometric and hyperbolic functions and their inverses). " +
+			"The derivative is simplified and returned in calculate syntax, e.g. x^3 + 2x gives 3*x^2+2. Session functions are expanded, other identifiers are treated as constants, and conditionals are differentiated branch by branch. " +
+			"Set 'order' for higher derivatives and 'at' to also evaluate the derivative at a point.",
+	}, handleDifferentiate)
+
+	// Algebraic rewriting tools
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "simplify",
+		Description: "Rewrite an expression in the calculate grammar into a simpler equivalent form: like terms are combined (2x + 3x - x = 4*x), constants folded exactly (0.1 + 0.2 = 0.3, sqrt(16) = 4), powers merged (x*x^2 = x^3), exact polynomial quotients cancelled ((x^2-1)/(x-1) = x+1) and common terms factored out when that is shorter (pi*r^2 + 2*pi*r = pi*r*(r+2)). " +
+			"Identifiers other than named constants are treated as symbols. The result is checked numerically against the original at random sample points, which are returned as proof.",
+	}, handleSimplify)
+
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "expand",
+		Description: "Multiply out products and integer powers of sums in an expression in the calculate grammar and combine like terms, e.g. (x+1)^2 = x^2+2*x+1 and (a+b)*(a-b) = a^2-b^2. Powers of sums above " + strconv.Itoa(maxExpandPower) + " and results over " + strconv.Itoa(maxExpandTerms) + " terms are rejected. " +
+			"The result is checked numerically against the original at random sample points, which are returned as proof.",
+	}, handleExpand)
+
+	// Equation solver tool
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "solve",
+		Description: "Find the real roots of an equation in one variable, written in the calculate grammar: 'x^3 - 2x - 5 = 0', 'cos(x) = x', or an expression such as 'x^2 - 2' that is set to zero. " +
+			"Linear and quadratic equations with rational coefficients are solved exactly in closed form (x^2 - 2x - 1 = 0 gives 1-sqrt(2) and sqrt(2)+1). " +
+			"Other equations are solved numerically in the interval from 'min' to 'max' (default -10 to 10): the interval is scanned for sign changes, each is bracketed with Brent's method and polished with Newton steps, and roots where the sign does not change are found with Newton's method. " +
+			"Each root is returned with its residual, method, iteration count and whether it converged; sign changes at poles such as 1/x = 0 are reported as discontinuities, not roots. Session variables and functions can be used.",
+	}, handleSolve)
+
+	// Numerical integration and summation tools
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "integrate",
+		Description: "Compute a definite integral numerically, with the integrand in the calculate grammar: e.g. sin(x) from 0 to pi, or exp(-x^2) from -inf to inf. " +
+			"Limits are numbers, expressions such as 'pi/2', or 'inf' and '-inf'; infinite ranges are mapped onto finite ones by a change of variable. " +
+			"The integral is computed with adaptive 15-point Gauss-Kronrod quadrature, to a relative accuracy of 1e-10 where possible, and returned with its error estimate, the number of evaluations and whether the accuracy goal was met. Session variables and functions can be used.",
+	}, handleIntegrate)
+
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "sum",
+		Description: "Add up a term in the calculate grammar over an integer index range, e.g. 1/n^2 for n from 1 to inf, or k^2 for k from 1 to 100 (set 'index' to k). " +
+			"Finite ranges of up to " + strconv.Itoa(maxSeriesTerms) + " terms are summed with compensated summation. The limit of an infinite series is extrapolated with the Levin u-transform, or found by adding terms until they no longer matter; series that do not settle are reported as possibly divergent. " +
+			"The result comes with its error estimate and the number of terms evaluated.",
+	}, handleSum)
+
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "product",
+		Description: "Multiply a term in the calculate grammar over an integer index range, e.g. n for n from 1 to 10, or 1 - 1/(4n^2) for n from 1 to inf. " +
+			"Infinite products are evaluated like the infinite series of the sum tool, with the Levin u-transform applied to the partial products. The result comes with its error estimate and the number of terms evaluated.",
+	}, handleProduct)
+
+	// Linear algebra tool
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "matrix",
+		Description: "Linear algebra on matrices given as arrays of rows, e.g. [[1, 2], [3, 4]], and vectors given as arrays of entries, e.g. [5, 6], which are treated as columns. Entries may be numbers or expressions such as 'sqrt(2)'. " +
+			"Set 'operation' to add, subtract or multiply (a and b), transpose, determinant, inverse or rank (a), solve (the system ax = b for a square a), lu (PA = LU with partial pivoting), qr (A = QR with Householder reflections) or eigenvalues (a symmetric a, with unit eigenvectors, by the Jacobi method). " +
+			"Matrices may have up to " + strconv.Itoa(maxMatrixSize) + " rows and columns. Operands of the wrong shape are reported as dimension errors, and the inverse of a singular matrix or a singular system as singular errors.",
+	}, handleMatrix)
+
+	// Descriptive statistics tool
+	mcp.AddTool(s, &mcp.Tool{
+		Name: "statistics",
+		Description: "Describe a dataset given as an array of numbers or as text such as CSV (set 'column' to pick a column of a table by header name or number): count, sum, mean, median, mode, sample and population variance and standard deviation, min, max, quartiles, IQR, skewness and excess kurtosis, plus any 'percentiles' from 0 to 100. " +
+			"The sum is compensated and the variance computed about the mean in a second pass, so large offsets do not cost accuracy; percentiles interpolate linearly between the closest ranks, like NumPy and Excel's PERCENTILE.INC. Up to " + strconv.Itoa(maxDatasetSize) + " values.",
+	}, handleStatistics)
+
+	log.Println("Loaded tools: calculate, calculate_batch, random_number, variables, functions, differentiate, simplify, expand, solve, integrate, sum, product, matrix, statistics")
 
 	// Math constants resource
 	s.AddResource(&mcp.Resource{
@@ -114,131 +224,1825 @@ func createMCPServer() *mcp.Server {
 				Description: "Mathematical expression to explain",
 				Required:    true,
 			},
-		},
-	}, handleExplainCalculationPrompt)
+		},
+	}, handleExplainCalculationPrompt)
+
+	log.Println("Loaded prompts: math_problem, explain_calculation")
+	log.Println("MCP server initialization complete")
+
+	return s
+}
+
+func startHTTPServer(s *mcp.Server) {
+	port := "8080"
+	if portStr := os.Getenv("PORT"); portStr != "" {
+		port = portStr
+	}
+
+	log.Printf("starting server with streamable-http transport on port %s", port)
+
+	// Create streamable HTTP handler
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return s
+	}, &mcp.StreamableHTTPOptions{
+		SessionTimeout: 5 * time.Minute,
+		Stateless:      false,
+	})
+
+	// Create HTTP mux for additional endpoints
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("OK")); err != nil {
+			log.Printf("Health check write error: %v", err)
+		}
+	})
+
+	// Mount the MCP streamable HTTP handler at /mcp
+	mux.Handle("/mcp", handler)
+
+	// Start HTTP server
+	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), mux); err != nil {
+		log.Fatalf("HTTP server error: %v", err)
+	}
+}
+
+// outputSchema infers the output schema of a tool from T, as the SDK would, and restricts the
+// named string properties to the given values
+func outputSchema[T any](enums map[string][]any) *jsonschema.Schema {
+	schema, err := jsonschema.For[T](nil)
+	if err != nil {
+		panic(fmt.Sprintf("output schema: %v", err))
+	}
+	for name, values := range enums {
+		schema.Properties[name].Enum = values
+	}
+	return schema
+}
+
+// calculateOutput is the structured output of the calculate tool
+type calculateOutput struct {
+	Result      string     `json:"result"`
+	Value       *float64   `json:"value,omitempty" jsonschema:"The result as a number: the nearest float64 (with precision, to the digits of formatted), 1 or 0 for a truth value, the real part in complex mode and the number without its unit in units mode. Omitted for definitions and when the result overflowed float64"`
+	Imaginary   *float64   `json:"imaginary,omitempty" jsonschema:"Complex mode: the imaginary part of the result"`
+	Formatted   string     `json:"formatted,omitempty" jsonschema:"The result as the server writes it: e.g. 0.1666666667, true, all digits of a large integer, the digits requested with precision, the fraction in exact mode, the rectangular form in complex mode or the decimal value in programmer mode"`
+	Expression  string     `json:"expression,omitempty" jsonschema:"The expression as the server parsed it, with explicit operators and only the parentheses it needs, e.g. 2*(x+1)^2 for 2(x + 1)^2"`
+	Mode        string     `json:"mode,omitempty" jsonschema:"The mode the expression was evaluated in: float, precision (float with 'precision' set), exact, complex, programmer or units. Functions are always defined in float mode"`
+	IsInteger   bool       `json:"isInteger" jsonschema:"Whether the result is a whole number"`
+	IsExact     bool       `json:"isExact" jsonschema:"Whether the formatted result is known to be exactly the value of the expression, not rounded. Always true in exact and programmer mode. In float and precision mode it is true when the result agrees with rational arithmetic (2+3 and 0.5*3 are exact, 0.1+0.2 and 1/3 are not). The check is conservative: false means exactness could not be shown, so conditionals, user-defined functions and functions such as log(8, 2) give false even when the result is exact. Always false in complex and units mode"`
+	Overflowed  bool       `json:"overflowed" jsonschema:"Whether the result is beyond the range of float64, so that value is omitted; formatted or integer may still hold it, e.g. for 200!"`
+	Boolean     *bool      `json:"boolean,omitempty" jsonschema:"Set when the expression is a comparison or logical expression: its truth value"`
+	Integer     string     `json:"integer,omitempty" jsonschema:"Set when a factorial, nPr or nCr result is an integer too large for float64 to hold exactly: all of its digits"`
+	Fraction    string     `json:"fraction,omitempty" jsonschema:"Exact mode: the result as a reduced fraction, e.g. 7/3"`
+	MixedNumber string     `json:"mixedNumber,omitempty" jsonschema:"Exact mode: the result as a mixed number, e.g. 2 1/3"`
+	Decimal     string     `json:"decimal,omitempty" jsonschema:"Exact mode: decimal approximation of the result. Programmer mode: the result in decimal. Units mode: the numeric value in unit"`
+	Hex         string     `json:"hex,omitempty" jsonschema:"Programmer mode: the result in hexadecimal, padded to the word size"`
+	Binary      string     `json:"binary,omitempty" jsonschema:"Programmer mode: the result in binary, padded to the word size"`
+	Octal       string     `json:"octal,omitempty" jsonschema:"Programmer mode: the result in octal"`
+	Rectangular string     `json:"rectangular,omitempty" jsonschema:"Complex mode: the result in rectangular notation, e.g. 3 + 4i"`
+	Polar       string     `json:"polar,omitempty" jsonschema:"Complex mode: the result as magnitude ∠ angle, with the angle in radians and degrees"`
+	Unit        string     `json:"unit,omitempty" jsonschema:"Units mode: the unit of the result, e.g. m/s or km/h; empty for a dimensionless number"`
+	Trace       []string   `json:"trace,omitempty" jsonschema:"With trace set: the expression as written, each intermediate form and the result, e.g. 2 + 3*4, 2+12, 14"`
+	Warnings    []string   `json:"warnings,omitempty" jsonschema:"Notes on how an ambiguous expression was interpreted, e.g. that 1/2x was read as (1/2)*x"`
+	Error       *exprError `json:"error,omitempty" jsonschema:"Details of the problem when the expression could not be evaluated"`
+}
+
+// calculateInput is the input of the calculate tool
+type calculateInput struct {
+	Expression string   `json:"expression" jsonschema:"A mathematical expression to evaluate (e.g., '2 + 3', '10 * 5', '15 / 3', '2^10', '17 % 5', 'sqrt(2)*sin(0.5)', 'pi*2^2', 'max(1, 4, 2)', 'r = 2', 'pi*r^2')"`
+	Precision  *int     `json:"precision,omitempty" jsonschema:"Evaluate with arbitrary precision to this many significant decimal digits (1-1000) instead of float64. Integer-only arithmetic is exact regardless of the digit count. Trigonometric and hyperbolic functions and user-defined functions are not available in this mode. In exact mode, the number of digits of the decimal approximation"`
+	Mode       string   `json:"mode,omitempty" jsonschema:"Evaluation mode: 'float' (default), 'exact' for rational arithmetic returning reduced fractions such as 1/3 + 1/6 = 1/2, 'complex' for complex numbers, 'programmer' for fixed-width integers with bitwise operators, or 'units' for quantities with units such as 5 km / 20 min to m/s"`
+	WordSize   *int     `json:"wordSize,omitempty" jsonschema:"Programmer mode: word size in bits, one of 8, 16, 32 or 64 (default 64). Results wrap around on overflow"`
+	Signed     *bool    `json:"signed,omitempty" jsonschema:"Programmer mode: whether the word is a signed two's complement integer (default true)"`
+	Tolerance  *float64 `json:"tolerance,omitempty" jsonschema:"Absolute tolerance for == and != (default 0, exact comparison); e.g. with 1e-9, 0.1 + 0.2 == 0.3 is true"`
+	Trace      bool     `json:"trace,omitempty" jsonschema:"Return the evaluation step by step in 'trace', one reduction per step in the order the server evaluates, e.g. 2+3*4, 2+12, 14. Default mode only"`
+}
+
+func handleCalculate(ctx context.Context, req *mcp.CallToolRequest, input calculateInput) (*mcp.CallToolResult, calculateOutput, error) {
+	return calculate(ctx, input, sessions.get(req.Session))
+}
+
+// calculate validates and evaluates a calculate request against state, until ctx is cancelled
+func calculate(ctx context.Context, input calculateInput, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	expression := input.Expression
+
+	// Validate expression length and characters
+	if len(expression) == 0 {
+		log.Printf("Calculate error - empty expression")
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression cannot be empty"},
+			},
+		}, calculateOutput{}, nil
+	}
+
+	if len(expression) > 500 {
+		log.Printf("Calculate error - expression too long: %d characters", len(expression))
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression too long (maximum 500 characters)"},
+			},
+		}, calculateOutput{}, nil
+	}
+
+	if input.Precision != nil && (*input.Precision < 1 || *input.Precision > maxPrecisionDigits) {
+		log.Printf("Calculate error - invalid precision: %d", *input.Precision)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Precision must be between 1 and %d digits", maxPrecisionDigits)},
+			},
+		}, calculateOutput{}, nil
+	}
+
+	if input.Tolerance != nil && !(*input.Tolerance >= 0 && !math.IsInf(*input.Tolerance, 1)) {
+		log.Printf("Calculate error - invalid tolerance: %v", *input.Tolerance)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Tolerance must be a finite non-negative number"},
+			},
+		}, calculateOutput{}, nil
+	}
+
+	if input.Trace && ((input.Mode != "" && input.Mode != "float") || input.Precision != nil) {
+		log.Printf("Calculate error - trace outside the default mode")
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "trace is only available in the default mode without precision"},
+			},
+		}, calculateOutput{}, nil
+	}
+
+	if input.Mode != "programmer" && (input.WordSize != nil || input.Signed != nil) {
+		log.Printf("Calculate error - word size outside programmer mode")
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "wordSize and signed only apply to mode 'programmer'"},
+			},
+		}, calculateOutput{}, nil
+	}
+
+	result, output, err := calculateInMode(ctx, expression, input, state)
+	if result != nil && ctx.Err() != nil {
+		log.Printf("Calculate cancelled: %s", expression)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Calculation cancelled"},
+			},
+		}, calculateOutput{}, nil
+	}
+	if result == nil {
+		// Point out implicit multiplications that may not have been meant as written
+		syn := syntaxStandard
+		switch input.Mode {
+		case "programmer":
+			syn = syntaxProgrammer
+		case "units":
+			syn = syntaxUnits
+		}
+		output.Warnings = implicitWarnings(expression, syn)
+		for _, w := range output.Warnings {
+			log.Printf("Calculate warning: %s", w)
+		}
+	}
+	return result, output, err
+}
+
+// calculateInMode evaluates a validated expression, or stores a function definition, in the
+// mode selected by input
+func calculateInMode(ctx context.Context, expression string, input calculateInput, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	if fn, isDefinition, err := parseDefinition(expression); isDefinition {
+		return calculateDefinition(expression, fn, err, state)
+	}
+
+	switch input.Mode {
+	case "", "float":
+	case "exact":
+		return calculateExact(expression, input.Precision, state)
+	case "complex":
+		if input.Precision != nil {
+			log.Printf("Calculate error - precision in complex mode")
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "Precision is not supported in complex mode"},
+				},
+			}, calculateOutput{}, nil
+		}
+		return calculateComplex(expression, state)
+	case "programmer":
+		bits, signed := 64, true
+		if input.WordSize != nil {
+			bits = *input.WordSize
+		}
+		if input.Signed != nil {
+			signed = *input.Signed
+		}
+		if !slices.Contains(wordSizes, bits) || input.Precision != nil {
+			log.Printf("Calculate error - invalid programmer mode options")
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "Programmer mode requires a wordSize of 8, 16, 32 or 64 and does not support precision"},
+				},
+			}, calculateOutput{}, nil
+		}
+		return calculateProgrammer(expression, bits, signed, state)
+	case "units":
+		if input.Precision != nil {
+			log.Printf("Calculate error - precision in units mode")
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "Precision is not supported in units mode"},
+				},
+			}, calculateOutput{}, nil
+		}
+		return calculateUnits(expression, state)
+	default:
+		log.Printf("Calculate error - unknown mode: %s", input.Mode)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Unknown mode: %s. Supported modes are: float, exact, complex, programmer, units", input.Mode)},
+			},
+		}, calculateOutput{}, nil
+	}
+
+	if input.Precision != nil {
+		return calculatePrecise(ctx, expression, *input.Precision, state)
+	}
+
+	var tolerance float64
+	if input.Tolerance != nil {
+		tolerance = *input.Tolerance
+	}
+	vars, funcs := state.snapshotVariables(), state.snapshotFunctions()
+	assigned, result, isBool, err := evaluateSessionStatement(ctx, expression, vars, funcs, tolerance)
+	if err != nil {
+		log.Printf("Calculate error - evaluation failed: %v", err)
+		return calculateError(expression, asExprError(err, errKindSyntax))
+	}
+
+	// Counting results too large for float64 to hold exactly (30!, nCr(100, 50)) are recomputed
+	// with all their digits. This comes before the NaN check, since e.g. 171! - 171! is Inf - Inf
+	// in float64 but exactly 0; results that float64 holds exactly need no digits.
+	integer := exactIntegerResult(expression, vars, result)
+	if exact, ok := new(big.Int).SetString(integer, 10); ok {
+		result, _ = new(big.Float).SetInt(exact).Float64()
+		if math.Abs(result) <= maxExactFloatInt {
+			integer = ""
+		}
+	}
+
+	// Check for special float values, NaN check
+	if math.IsNaN(result) {
+		log.Printf("Calculate error - result is NaN")
+		return calculateError(expression, newExprError(errKindInvalidResult, 0, len(expression), "Calculation resulted in an invalid number (NaN)"))
+	}
+
+	// The trace is taken before ans changes, so it sees the same variables as the evaluation
+	var trace []string
+	if input.Trace {
+		if trace, err = traceStatement(expression, &evaluator{ctx: ctx, vars: vars, funcs: funcs, tolerance: tolerance}); err != nil {
+			log.Printf("Calculate error - trace failed: %v", err)
+			return calculateError(expression, asExprError(err, errKindUnsupported))
+		}
+	}
+
+	if assigned != "" {
+		state.setVariable(assigned, result)
+	}
+	state.setVariable(lastResultVariable, result)
+
+	// Truth values are stored as 1 and 0 but reported as true and false
+	resultText := formatResult(result)
+	isExact := integer != ""
+	if integer != "" {
+		resultText = integer
+	}
+	var boolean *bool
+	if isBool {
+		b := result != 0
+		boolean = &b
+		resultText = strconv.FormatBool(b)
+		isExact = true
+	}
+	if !isExact {
+		isExact = isExactValue(expression, vars, new(big.Rat).SetFloat64(result))
+	}
+
+	resultStr := fmt.Sprintf("Result: %s = %s", expression, resultText)
+	if assigned != "" {
+		resultStr = fmt.Sprintf("Assigned: %s = %s", assigned, resultText)
+	}
+	log.Printf("Calculate result: %s = %s", expression, resultText)
+	return nil, calculateOutput{
+		Result:     resultStr,
+		Value:      finiteValue(result),
+		Formatted:  resultText,
+		Expression: formatStatement(expression, syntaxStandard),
+		Mode:       "float",
+		IsInteger:  integer != "" || isWhole(result),
+		IsExact:    isExact,
+		Overflowed: math.IsInf(result, 0),
+		Boolean:    boolean,
+		Integer:    integer,
+		Trace:      trace,
+	}, nil
+}
+
+// finiteValue returns v for the value field of calculateOutput, or nil if it overflowed float64
+func finiteValue(v float64) *float64 {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// isWhole reports whether v is a finite whole number
+func isWhole(v float64) bool {
+	return !math.IsInf(v, 0) && v == math.Trunc(v)
+}
+
+// calculatePrecise evaluates the expression with math/big and reports the full-precision decimal result
+func calculatePrecise(ctx context.Context, expression string, digits int, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	vars := state.snapshotVariables()
+	assigned, resultStr, result, err := evaluateStatementBig(ctx, expression, vars, state.snapshotFunctions(), digits)
+	if err != nil {
+		log.Printf("Calculate error - evaluation failed: %v", err)
+		return calculateError(expression, asExprError(err, errKindSyntax))
+	}
+
+	// Session variables hold float64, so later float calculations see the nearest float64 value
+	if assigned != "" {
+		state.setVariable(assigned, result)
+	}
+	state.setVariable(lastResultVariable, result)
+
+	// The digits are read back as a fraction to tell whether they are whole and exact; they do not
+	// parse when the result overflowed to ±Inf. A whole number in exponent notation, such as
+	// 3.3333e+29 for 10^30/3, has been rounded and is only known to be whole if it is exact.
+	formatted, ok := new(big.Rat).SetString(resultStr)
+	if !ok {
+		formatted = nil
+	}
+	isExact := isExactValue(expression, vars, formatted)
+	output := calculateOutput{
+		Result:     fmt.Sprintf("Result: %s = %s", expression, resultStr),
+		Value:      finiteValue(result),
+		Formatted:  resultStr,
+		Expression: formatStatement(expression, syntaxStandard),
+		Mode:       "precision",
+		IsInteger:  formatted != nil && formatted.IsInt() && (isExact || !strings.Contains(resultStr, "e")),
+		IsExact:    isExact,
+		Overflowed: formatted == nil || math.IsInf(result, 0),
+	}
+	if assigned != "" {
+		output.Result = fmt.Sprintf("Assigned: %s = %s", assigned, resultStr)
+	}
+	log.Printf("Calculate result (%d digits): %s = %s", digits, expression, resultStr)
+	return nil, output, nil
+}
+
+// calculateDefinition validates and stores a user-defined function such as f(x, y) = x^2 + y.
+// err is the error from parsing the definition, if any.
+func calculateDefinition(expression string, fn *userFunction, err error, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	if err == nil {
+		err = validateDefinition(expression, fn, state.snapshotVariables(), state.snapshotFunctions())
+	}
+	if err != nil {
+		log.Printf("Calculate error - invalid definition: %v", err)
+		return calculateError(expression, asExprError(err, errKindInvalidDefinition))
+	}
+
+	state.setFunction(fn)
+	log.Printf("Defined function: %s = %s", fn.signature(), fn.source)
+	return nil, calculateOutput{
+		Result:     fmt.Sprintf("Defined: %s = %s", fn.signature(), fn.source),
+		Expression: fn.signature() + " = " + formatNode(fn.body),
+		Mode:       "float",
+	}, nil
+}
+
+// calculateExact evaluates the expression with rational arithmetic and reports the fraction,
+// mixed number and decimal approximation
+func calculateExact(expression string, precision *int, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	assigned, exact, err := evaluateStatementExact(expression, state.snapshotVariables())
+	if err != nil {
+		log.Printf("Calculate error - evaluation failed: %v", err)
+		return calculateError(expression, asExprError(err, errKindSyntax))
+	}
+
+	result, _ := exact.value.Float64()
+	decimal := formatResult(result)
+	if precision != nil {
+		decimal = new(big.Float).SetPrec(newBigEvaluator(*precision, nil).prec).SetRat(exact.value).Text('g', *precision)
+	}
+
+	if assigned != "" {
+		state.setVariable(assigned, result)
+	}
+	state.setVariable(lastResultVariable, result)
+
+	resultStr := fmt.Sprintf("Result: %s = %s", expression, exact.fraction)
+	if assigned != "" {
+		resultStr = fmt.Sprintf("Assigned: %s = %s", assigned, exact.fraction)
+	}
+	log.Printf("Calculate result (exact): %s = %s", expression, exact.fraction)
+	return nil, calculateOutput{
+		Result:      resultStr,
+		Value:       finiteValue(result),
+		Formatted:   exact.fraction,
+		Expression:  formatStatement(expression, syntaxStandard),
+		Mode:        "exact",
+		IsInteger:   exact.value.IsInt(),
+		IsExact:     true,
+		Overflowed:  math.IsInf(result, 0),
+		Fraction:    exact.fraction,
+		MixedNumber: exact.mixedNumber,
+		Decimal:     decimal,
+	}, nil
+}
+
+// calculateComplex evaluates the expression over complex numbers and reports the result in
+// rectangular and polar notation
+func calculateComplex(expression string, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	assigned, result, err := evaluateStatementComplex(expression, state.snapshotComplexVariables())
+	if err != nil {
+		log.Printf("Calculate error - evaluation failed: %v", err)
+		return calculateError(expression, asExprError(err, errKindSyntax))
+	}
+
+	result = cleanComplex(result)
+	if assigned != "" {
+		state.setComplexVariable(assigned, result)
+	}
+	state.setComplexVariable(lastResultVariable, result)
+
+	rectangular, polar := formatComplex(result), formatPolar(result)
+	resultStr := fmt.Sprintf("Result: %s = %s (polar: %s)", expression, rectangular, polar)
+	if assigned != "" {
+		resultStr = fmt.Sprintf("Assigned: %s = %s (polar: %s)", assigned, rectangular, polar)
+	}
+	log.Printf("Calculate result (complex): %s = %s", expression, rectangular)
+	re, im := real(result), imag(result)
+	return nil, calculateOutput{
+		Result:      resultStr,
+		Value:       finiteValue(re),
+		Imaginary:   finiteValue(im),
+		Formatted:   rectangular,
+		Expression:  formatStatement(expression, syntaxStandard),
+		Mode:        "complex",
+		IsInteger:   im == 0 && isWhole(re),
+		Overflowed:  math.IsInf(re, 0) || math.IsInf(im, 0),
+		Rectangular: rectangular,
+		Polar:       polar,
+	}, nil
+}
+
+// calculateProgrammer evaluates the expression with fixed-width integers and reports the result
+// in decimal, hexadecimal, binary and octal
+func calculateProgrammer(expression string, bits int, signed bool, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	assigned, result, err := evaluateStatementInt(expression, state.snapshotVariables(), bits, signed)
+	if err != nil {
+		log.Printf("Calculate error - evaluation failed: %v", err)
+		return calculateError(expression, asExprError(err, errKindSyntax))
+	}
+
+	if assigned != "" {
+		state.setVariable(assigned, result.value)
+	}
+	state.setVariable(lastResultVariable, result.value)
+
+	bases := fmt.Sprintf("%s (hex %s, bin %s, oct %s)", result.decimal, result.hex, result.binary, result.octal)
+	resultStr := fmt.Sprintf("Result: %s = %s", expression, bases)
+	if assigned != "" {
+		resultStr = fmt.Sprintf("Assigned: %s = %s", assigned, bases)
+	}
+	log.Printf("Calculate result (%d-bit): %s = %s", bits, expression, result.decimal)
+	return nil, calculateOutput{
+		Result:     resultStr,
+		Value:      &result.value,
+		Formatted:  result.decimal,
+		Expression: formatStatement(expression, syntaxProgrammer),
+		Mode:       "programmer",
+		IsInteger:  true,
+		IsExact:    true,
+		Decimal:    result.decimal,
+		Hex:        result.hex,
+		Binary:     result.binary,
+		Octal:      result.octal,
+	}, nil
+}
+
+// calculateUnits evaluates the expression over quantities with units and reports the value
+// with its unit
+func calculateUnits(expression string, state *sessionState) (*mcp.CallToolResult, calculateOutput, error) {
+	result, err := evaluateStatementUnits(expression, state.snapshotVariables())
+	if err != nil {
+		log.Printf("Calculate error - evaluation failed: %v", err)
+		return calculateError(expression, asExprError(err, errKindSyntax))
+	}
+
+	// Variables hold plain numbers, so ans keeps the value as reported, without its unit
+	state.setVariable(lastResultVariable, result.value)
+
+	value := formatResult(result.value)
+	quantityStr := strings.TrimSpace(value + " " + result.unit)
+	log.Printf("Calculate result (units): %s = %s", expression, quantityStr)
+	return nil, calculateOutput{
+		Result:     fmt.Sprintf("Result: %s = %s", expression, quantityStr),
+		Value:      finiteValue(result.value),
+		Formatted:  value,
+		Expression: formatStatement(expression, syntaxUnits),
+		Mode:       "units",
+		IsInteger:  isWhole(result.value),
+		Overflowed: math.IsInf(result.value, 0),
+		Decimal:    value,
+		Unit:       result.unit,
+	}, nil
+}
+
+// calculateError builds an error result carrying both a caret diagnostic for humans and
+// the located error as structured output, so callers can correct the expression automatically
+func calculateError(expression string, e *exprError) (*mcp.CallToolResult, calculateOutput, error) {
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: "Calculation error: " + e.render(expression)},
+		},
+	}, calculateOutput{Error: e}, nil
+}
+
+// calculateBatchInput is the input of the calculate_batch tool
+type calculateBatchInput struct {
+	Expressions []string           `json:"expressions" jsonschema:"The expressions to evaluate in order, in calculate syntax; assignments such as 'x = 2' and definitions such as 'f(x) = x^2' are seen by the expressions after them"`
+	Variables   map[string]float64 `json:"variables,omitempty" jsonschema:"Variable bindings shared by every expression, e.g. {\"rate\": 0.05, \"n\": 12}; they take precedence over session variables of the same name"`
+	Mode        string             `json:"mode,omitempty" jsonschema:"Evaluation mode for every expression, as in calculate: 'float' (default), 'exact', 'complex', 'programmer' or 'units'"`
+	Precision   *int               `json:"precision,omitempty" jsonschema:"Significant digits for arbitrary precision, as in calculate"`
+	WordSize    *int               `json:"wordSize,omitempty" jsonschema:"Programmer mode: word size in bits, as in calculate"`
+	Signed      *bool              `json:"signed,omitempty" jsonschema:"Programmer mode: whether the word is signed, as in calculate"`
+	Tolerance   *float64           `json:"tolerance,omitempty" jsonschema:"Absolute tolerance for == and !=, as in calculate"`
+}
+
+// calculateBatchOutput is the structured output of the calculate_batch tool
+type calculateBatchOutput struct {
+	Result    string      `json:"result"`
+	Results   []batchItem `json:"results,omitempty" jsonschema:"One entry per expression, in order"`
+	Succeeded int         `json:"succeeded" jsonschema:"The number of expressions evaluated"`
+	Failed    int         `json:"failed" jsonschema:"The number of expressions that failed"`
+}
+
+func handleCalculateBatch(ctx context.Context, req *mcp.CallToolRequest, input calculateBatchInput) (*mcp.CallToolResult, calculateBatchOutput, error) {
+	if len(input.Expressions) == 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "At least one expression is required"},
+			},
+		}, calculateBatchOutput{}, nil
+	}
+	if len(input.Expressions) > maxBatchExpressions {
+		log.Printf("Calculate batch error - too many expressions: %d", len(input.Expressions))
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Too many expressions: %d (maximum %d per batch)", len(input.Expressions), maxBatchExpressions)},
+			},
+		}, calculateBatchOutput{}, nil
+	}
+	total := 0
+	for _, expression := range input.Expressions {
+		total += len(expression)
+	}
+	if total > maxBatchLength {
+		log.Printf("Calculate batch error - expressions too long: %d characters", total)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Expressions too long: %d characters in total (maximum %d per batch)", total, maxBatchLength)},
+			},
+		}, calculateBatchOutput{}, nil
+	}
+
+	// The batch works on a copy of the session state, so its bindings and assignments last only
+	// for the batch
+	state := sessions.get(req.Session).clone()
+	for _, name := range slices.Sorted(maps.Keys(input.Variables)) {
+		if err := checkVariable(name); err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Invalid binding: %v", err)},
+				},
+			}, calculateBatchOutput{}, nil
+		}
+		state.setVariable(name, input.Variables[name])
+	}
+
+	options := calculateInput{Mode: input.Mode, Precision: input.Precision, WordSize: input.WordSize, Signed: input.Signed, Tolerance: input.Tolerance}
+	items, err := evaluateBatch(ctx, input.Expressions, options, state)
+
+	output := calculateBatchOutput{Results: items}
+	lines := make([]string, len(items))
+	for i, item := range items {
+		if item.OK {
+			output.Succeeded++
+		} else {
+			output.Failed++
+		}
+		lines[i] = fmt.Sprintf("[%d] %s", i+1, strings.ReplaceAll(item.Result, "\n", "; "))
+	}
+	if err != nil {
+		// The expressions evaluated before the cancellation are still reported
+		log.Printf("Calculate batch cancelled after %d of %d expressions", len(items), len(input.Expressions))
+		output.Result = strings.Join(append([]string{fmt.Sprintf("Batch cancelled after %d of %d expressions", len(items), len(input.Expressions))}, lines...), "\n")
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: output.Result},
+			},
+		}, output, nil
+	}
+	output.Result = fmt.Sprintf("Evaluated %d of %d expressions\n%s", output.Succeeded, len(items), strings.Join(lines, "\n"))
+	log.Printf("Calculate batch: %d expressions, %d failed", len(items), output.Failed)
+	return nil, output, nil
+}
+
+// variablesOutput is the structured result of the variables tool
+type variablesOutput struct {
+	Result           string             `json:"result"`
+	Variables        map[string]float64 `json:"variables,omitempty"`
+	ComplexVariables map[string]string  `json:"complexVariables,omitempty" jsonschema:"Variables holding complex numbers (from mode 'complex'), in rectangular notation"`
+}
+
+func handleVariables(ctx context.Context, req *mcp.CallToolRequest, input struct {
+	Action string  `json:"action,omitempty" jsonschema:"'list' (default) to show session variables, or 'clear' to remove them"`
+	Name   *string `json:"name,omitempty" jsonschema:"Variable to clear; all variables are cleared when omitted"`
+}) (*mcp.CallToolResult, variablesOutput, error) {
+	state := sessions.get(req.Session)
+
+	switch input.Action {
+	case "", "list":
+		variables := state.snapshotVariables()
+		all := state.snapshotComplexVariables()
+		names := make([]string, 0, len(all))
+		var complexVariables map[string]string
+		for name, v := range all {
+			names = append(names, name)
+			if _, ok := variables[name]; !ok {
+				if complexVariables == nil {
+					complexVariables = make(map[string]string)
+				}
+				complexVariables[name] = formatComplex(v)
+			}
+		}
+		sort.Strings(names)
+
+		resultStr := "No variables defined"
+		if len(names) > 0 {
+			lines := make([]string, len(names))
+			for i, name := range names {
+				lines[i] = fmt.Sprintf("%s = %s", name, formatComplex(all[name]))
+			}
+			resultStr = "Variables:\n" + strings.Join(lines, "\n")
+		}
+		return nil, variablesOutput{
+			Result:           resultStr,
+			Variables:        variables,
+			ComplexVariables: complexVariables,
+		}, nil
+
+	case "clear":
+		var resultStr string
+		if input.Name != nil && *input.Name != "" {
+			if !state.deleteVariable(*input.Name) {
+				return &mcp.CallToolResult{
+					IsError: true,
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("Variable '%s' is not defined", *input.Name)},
+					},
+				}, variablesOutput{}, nil
+			}
+			resultStr = fmt.Sprintf("Cleared variable '%s'", *input.Name)
+		} else {
+			resultStr = fmt.Sprintf("Cleared %d variable(s)", state.clearVariables())
+		}
+		log.Println(resultStr)
+		return nil, variablesOutput{
+			Result: resultStr,
+		}, nil
+	}
+
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Unknown action: %s. Supported actions are: list, clear", input.Action)},
+		},
+	}, variablesOutput{}, nil
+}
+
+// functionsOutput is the structured result of the functions tool
+type functionsOutput struct {
+	Result    string            `json:"result"`
+	Functions map[string]string `json:"functions,omitempty" jsonschema:"Defined functions by signature, e.g. f(x, y), with their bodies"`
+}
+
+func handleFunctions(ctx context.Context, req *mcp.CallToolRequest, input struct {
+	Action string  `json:"action,omitempty" jsonschema:"'list' (default) to show the session's functions, or 'clear' to delete them"`
+	Name   *string `json:"name,omitempty" jsonschema:"Function to delete; all functions are deleted when omitted"`
+}) (*mcp.CallToolResult, functionsOutput, error) {
+	state := sessions.get(req.Session)
+
+	switch input.Action {
+	case "", "list":
+		functions := state.snapshotFunctions()
+		resultStr := "No functions defined"
+		var bodies map[string]string
+		if len(functions) > 0 {
+			bodies = make(map[string]string, len(functions))
+			lines := make([]string, 0, len(functions))
+			for _, name := range sortedKeys(functions) {
+				fn := functions[name]
+				bodies[fn.signature()] = fn.source
+				lines = append(lines, fmt.Sprintf("%s = %s", fn.signature(), fn.source))
+			}
+			resultStr = "Functions:\n" + strings.Join(lines, "\n")
+		}
+		return nil, functionsOutput{Result: resultStr, Functions: bodies}, nil
+
+	case "clear":
+		var resultStr string
+		if input.Name != nil && *input.Name != "" {
+			if !state.deleteFunction(*input.Name) {
+				return &mcp.CallToolResult{
+					IsError: true,
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: fmt.Sprintf("Function '%s' is not defined", *input.Name)},
+					},
+				}, functionsOutput{}, nil
+			}
+			resultStr = fmt.Sprintf("Deleted function '%s'", *input.Name)
+		} else {
+			resultStr = fmt.Sprintf("Deleted %d function(s)", state.clearFunctions())
+		}
+		log.Println(resultStr)
+		return nil, functionsOutput{Result: resultStr}, nil
+	}
+
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Unknown action: %s. Supported actions are: list, clear", input.Action)},
+		},
+	}, functionsOutput{}, nil
+}
+
+// maxDerivativeOrder bounds the order of the differentiate tool
+const maxDerivativeOrder = 10
+
+// differentiateInput is the input of the differentiate tool
+type differentiateInput struct {
+	Expression string   `json:"expression" jsonschema:"The expression to differentiate, in calculate syntax (e.g. 'x^3 + 2x', 'sin(x)*exp(2x)', 'ln(x)/x')"`
+	Variable   string   `json:"variable,omitempty" jsonschema:"The variable to differentiate with respect to (default x); other names are treated as constants"`
+	Order      *int     `json:"order,omitempty" jsonschema:"Differentiate this many times, 1-10 (default 1)"`
+	At         *float64 `json:"at,omitempty" jsonschema:"Also evaluate the derivative at this value of the variable"`
+}
+
+// differentiateOutput is the structured output of the differentiate tool
+type differentiateOutput struct {
+	Result     string     `json:"result"`
+	Derivative string     `json:"derivative,omitempty" jsonschema:"The simplified derivative in calculate syntax, e.g. 3*x^2+2"`
+	Value      *float64   `json:"value,omitempty" jsonschema:"With 'at' set: the derivative evaluated there"`
+	Error      *exprError `json:"error,omitempty" jsonschema:"Details of the problem when the expression could not be differentiated or the derivative not evaluated"`
+}
+
+func handleDifferentiate(ctx context.Context, req *mcp.CallToolRequest, input differentiateInput) (*mcp.CallToolResult, differentiateOutput, error) {
+	expression := input.Expression
+	if len(expression) == 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression cannot be empty"},
+			},
+		}, differentiateOutput{}, nil
+	}
+	if len(expression) > 500 {
+		log.Printf("Differentiate error - expression too long: %d characters", len(expression))
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression too long (maximum 500 characters)"},
+			},
+		}, differentiateOutput{}, nil
+	}
+
+	variable := "x"
+	if input.Variable != "" {
+		variable = input.Variable
+	}
+	if err := checkVariable(variable); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: err.Error()},
+			},
+		}, differentiateOutput{}, nil
+	}
+	order := 1
+	if input.Order != nil {
+		order = *input.Order
+		if order < 1 || order > maxDerivativeOrder {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Order must be between 1 and %d", maxDerivativeOrder)},
+				},
+			}, differentiateOutput{}, nil
+		}
+	}
+
+	state := sessions.get(req.Session)
+	funcs := state.snapshotFunctions()
+
+	n, err := parseExpression(expression)
+	for i := 0; err == nil && i < order; i++ {
+		if n, err = differentiate(n, variable, funcs); err == nil {
+			// Combine the like terms the differentiation rules leave behind
+			if simplified, err := simplifyNode(n, funcs); err == nil {
+				n = simplified
+			}
+		}
+	}
+	if err != nil {
+		e := asExprError(err, errKindSyntax)
+		log.Printf("Differentiate error: %s - %v", expression, e)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Differentiation error: " + e.render(expression)},
+			},
+		}, differentiateOutput{Error: e}, nil
+	}
+
+	derivative := formatNode(n)
+	resultStr := fmt.Sprintf("%s (%s) = %s", derivativeLabel(variable, order), strings.TrimSpace(expression), derivative)
+	output := differentiateOutput{Derivative: derivative}
+
+	if input.At != nil {
+		vars := state.snapshotVariables()
+		vars[variable] = *input.At
+		_, value, _, err := evaluateSessionStatement(ctx, derivative, vars, funcs, 0)
+		if err != nil {
+			e := asExprError(err, errKindSyntax)
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("%s\nEvaluation error at %s = %s: %s", resultStr, variable, formatResult(*input.At), e.render(derivative))},
+				},
+			}, differentiateOutput{Derivative: derivative, Error: e}, nil
+		}
+		resultStr += fmt.Sprintf("\nAt %s = %s: %s", variable, formatResult(*input.At), formatResult(value))
+		output.Value = &value
+	}
+
+	log.Printf("Differentiate: %s", resultStr)
+	output.Result = resultStr
+	return nil, output, nil
+}
+
+// rewriteOutput is the structured output of the simplify and expand tools
+type rewriteOutput struct {
+	Result     string        `json:"result"`
+	Expression string        `json:"expression,omitempty" jsonschema:"The rewritten expression in calculate syntax"`
+	Verified   bool          `json:"verified" jsonschema:"Whether the rewritten expression agreed with the original at every sample point"`
+	Checks     []sampleCheck `json:"checks,omitempty" jsonschema:"The sample points at which both forms were evaluated, with their values"`
+	Error      *exprError    `json:"error,omitempty" jsonschema:"Details of the problem when the expression could not be rewritten"`
+}
+
+type rewriteInput struct {
+	Expression string `json:"expression" jsonschema:"The expression to rewrite, in calculate syntax (e.g. '2x + 3x - x', '(x+1)^2 - (x-1)^2', '(x^2-1)/(x-1)')"`
+}
+
+func handleSimplify(ctx context.Context, req *mcp.CallToolRequest, input rewriteInput) (*mcp.CallToolResult, rewriteOutput, error) {
+	return rewriteExpression(req, input.Expression, false)
+}
+
+func handleExpand(ctx context.Context, req *mcp.CallToolRequest, input rewriteInput) (*mcp.CallToolResult, rewriteOutput, error) {
+	return rewriteExpression(req, input.Expression, true)
+}
+
+// rewriteExpression simplifies or expands expression and checks the result numerically against
+// the original
+func rewriteExpression(req *mcp.CallToolRequest, expression string, expand bool) (*mcp.CallToolResult, rewriteOutput, error) {
+	operation := "Simplify"
+	if expand {
+		operation = "Expand"
+	}
+	if len(expression) == 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression cannot be empty"},
+			},
+		}, rewriteOutput{}, nil
+	}
+	if len(expression) > 500 {
+		log.Printf("%s error - expression too long: %d characters", operation, len(expression))
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression too long (maximum 500 characters)"},
+			},
+		}, rewriteOutput{}, nil
+	}
+
+	funcs := sessions.get(req.Session).snapshotFunctions()
+	n, err := parseExpression(expression)
+	var rewritten node
+	if err == nil {
+		if expand {
+			rewritten, err = expandNode(n, funcs)
+		} else {
+			rewritten, err = simplifyNode(n, funcs)
+		}
+	}
+	if err != nil {
+		e := asExprError(err, errKindSyntax)
+		log.Printf("%s error: %s - %v", operation, expression, e)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: operation + " error: " + e.render(expression)},
+			},
+		}, rewriteOutput{Error: e}, nil
+	}
+
+	result := formatNode(rewritten)
+	checks, verified := checkEquivalence(n, rewritten, funcs)
+	if !verified && len(checks) > 0 {
+		// The rewrite rules are meant to preserve the value everywhere the original is defined
+		log.Printf("%s error: %s rewritten to %s failed the equivalence check", operation, expression, result)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("%s error: the rewritten form %s does not agree with %s at %v; please report this expression", operation, result, strings.TrimSpace(expression), checks[len(checks)-1].Point)},
+			},
+		}, rewriteOutput{Expression: result, Checks: checks}, nil
+	}
+
+	resultStr := fmt.Sprintf("%s = %s", strings.TrimSpace(expression), result)
+	if verified {
+		resultStr += fmt.Sprintf("\nVerified numerically at %d sample point(s)", len(checks))
+	} else {
+		resultStr += "\nNot verified: the expression could not be evaluated at any sample point"
+	}
+	log.Printf("%s: %s = %s", operation, expression, result)
+	return nil, rewriteOutput{Result: resultStr, Expression: result, Verified: verified, Checks: checks}, nil
+}
+
+// solveInput is the input of the solve tool
+type solveInput struct {
+	Equation string   `json:"equation" jsonschema:"The equation to solve, in calculate syntax (e.g. 'x^3 - 2x - 5 = 0', 'cos(x) = x', '2x + 1 = 7'); an expression without '=' is set equal to zero"`
+	Variable string   `json:"variable,omitempty" jsonschema:"The unknown to solve for (default x); other names refer to session variables"`
+	Min      *float64 `json:"min,omitempty" jsonschema:"Lower end of the interval searched for roots (default -10)"`
+	Max      *float64 `json:"max,omitempty" jsonschema:"Upper end of the interval searched for roots (default 10)"`
+}
+
+// solveOutput is the structured output of the solve tool
+type solveOutput struct {
+	Result          string      `json:"result"`
+	Equation        string      `json:"equation,omitempty" jsonschema:"The equation that was solved, in the form f(x) = 0"`
+	Method          string      `json:"method,omitempty" jsonschema:"closed form for linear and quadratic equations, numeric otherwise"`
+	Roots           []solveRoot `json:"roots,omitempty" jsonschema:"The real roots found, in ascending order"`
+	Interval        []float64   `json:"interval,omitempty" jsonschema:"The interval [min, max] that was searched"`
+	Evaluations     int         `json:"evaluations,omitempty" jsonschema:"Numeric method: the number of times the equation was evaluated"`
+	Discontinuities []float64   `json:"discontinuities,omitempty" jsonschema:"Points where lhs - rhs changes sign without passing through zero, such as the pole of 1/x, which are not roots"`
+	Error           *exprError  `json:"error,omitempty" jsonschema:"Details of the problem when the equation could not be parsed or evaluated"`
+}
+
+func handleSolve(ctx context.Context, req *mcp.CallToolRequest, input solveInput) (*mcp.CallToolResult, solveOutput, error) {
+	equation := input.Equation
+	if len(equation) == 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Equation cannot be empty"},
+			},
+		}, solveOutput{}, nil
+	}
+	if len(equation) > 500 {
+		log.Printf("Solve error - equation too long: %d characters", len(equation))
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Equation too long (maximum 500 characters)"},
+			},
+		}, solveOutput{}, nil
+	}
+
+	variable := "x"
+	if input.Variable != "" {
+		variable = input.Variable
+	}
+	if err := checkVariable(variable); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: err.Error()},
+			},
+		}, solveOutput{}, nil
+	}
+	lo, hi := defaultSolveMin, defaultSolveMax
+	if input.Min != nil {
+		lo = *input.Min
+	}
+	if input.Max != nil {
+		hi = *input.Max
+	}
+	if math.IsInf(lo, 0) || math.IsInf(hi, 0) || !(lo < hi) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Invalid interval [%s, %s]: min must be less than max and both must be finite", formatResult(lo), formatResult(hi))},
+			},
+		}, solveOutput{}, nil
+	}
+
+	state := sessions.get(req.Session)
+	funcs := state.snapshotFunctions()
+	vars := state.snapshotVariables()
+
+	f, err := parseEquation(equation)
+	if err != nil {
+		e := asExprError(err, errKindSyntax)
+		log.Printf("Solve error: %s - %v", equation, e)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Solve error: " + e.render(equation)},
+			},
+		}, solveOutput{Error: e}, nil
+	}
+	lhs := f
+	if simplified, err := simplifyNode(f, funcs); err == nil {
+		lhs = simplified
+	}
+	output := solveOutput{Equation: formatNode(lhs) + " = 0"}
+	s := &solver{boundEvaluator: boundEvaluator{ctx: ctx, x: variable, vars: vars, funcs: funcs}, f: f}
+
+	var resultStr string
+	if exact, degree, ok := closedForm(f, variable, funcs); ok {
+		output.Method = "closed form"
+		bounded := input.Min != nil || input.Max != nil
+		for _, n := range exact {
+			value, err := (&evaluator{}).eval(n)
+			if err != nil || (bounded && (value < lo || value > hi)) {
+				continue
+			}
+			residual, err := s.eval(f, value)
+			if err != nil {
+				break
+			}
+			method := "linear"
+			if degree == 2 {
+				method = "quadratic"
+			}
+			output.Roots = append(output.Roots, solveRoot{Value: value, Exact: formatNode(n), Residual: residual, Method: method, Converged: true})
+		}
+		if bounded {
+			output.Interval = []float64{lo, hi}
+		}
+		switch degree {
+		case -1:
+			resultStr = fmt.Sprintf("%s holds for every value of %s", strings.TrimSpace(equation), variable)
+		case 0:
+			resultStr = fmt.Sprintf("%s has no solution", strings.TrimSpace(equation))
+		default:
+			kind := "linear"
+			if degree == 2 {
+				kind = "quadratic"
+			}
+			resultStr = fmt.Sprintf("%s is %s in %s: %s", strings.TrimSpace(equation), kind, variable, describeRoots(output.Roots, output.Interval))
+			if degree == 2 && len(exact) == 0 {
+				resultStr += " (the discriminant is negative)"
+			}
+		}
+	} else {
+		if d, err := differentiate(f, variable, funcs); err == nil {
+			s.df = d
+			if simplified, err := simplifyNode(d, funcs); err == nil {
+				s.df = simplified
+			}
+		}
+		roots, discontinuities, identity, err := s.roots(lo, hi)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Solve cancelled: %s", equation)
+				return &mcp.CallToolResult{
+					IsError: true,
+					Content: []mcp.Content{
+						&mcp.TextContent{Text: "Solve cancelled"},
+					},
+				}, solveOutput{}, nil
+			}
+			e := asExprError(err, errKindSyntax)
+			log.Printf("Solve error: %s - %v", equation, e)
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "Solve error: " + e.render(equation)},
+				},
+			}, solveOutput{Error: e}, nil
+		}
+		output.Method = "numeric"
+		output.Roots = append(output.Roots, roots...)
+		output.Interval = []float64{lo, hi}
+		output.Evaluations = s.evaluations
+		output.Discontinuities = discontinuities
+		if identity {
+			resultStr = fmt.Sprintf("%s holds at every point sampled in [%s, %s]", strings.TrimSpace(equation), formatResult(lo), formatResult(hi))
+		} else {
+			resultStr = fmt.Sprintf("%s: %s", strings.TrimSpace(equation), describeRoots(output.Roots, output.Interval))
+			for _, x := range discontinuities {
+				resultStr += fmt.Sprintf("\nSign change without a root at %s = %s (a discontinuity)", variable, formatResult(x))
+			}
+			if len(roots) >= maxSolveRoots {
+				resultStr += fmt.Sprintf("\nStopped after %d roots; narrow the interval to find the others", maxSolveRoots)
+			}
+		}
+	}
+
+	log.Printf("Solve: %s", strings.ReplaceAll(resultStr, "\n", "; "))
+	output.Result = resultStr
+	return nil, output, nil
+}
+
+// describeRoots lists roots for the solve tool's text result
+func describeRoots(roots []solveRoot, interval []float64) string {
+	where := ""
+	if interval != nil {
+		where = fmt.Sprintf(" in [%s, %s]", formatResult(interval[0]), formatResult(interval[1]))
+	}
+	switch len(roots) {
+	case 0:
+		return "no real roots" + where
+	case 1:
+		where = "1 real root" + where + ":"
+	default:
+		where = fmt.Sprintf("%d real roots%s:", len(roots), where)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(where)
+	for _, r := range roots {
+		value := formatResult(r.Value)
+		switch {
+		case r.Exact == value:
+			fmt.Fprintf(&sb, "\n  %s", value)
+		case r.Exact != "":
+			fmt.Fprintf(&sb, "\n  %s = %s", r.Exact, value)
+		default:
+			fmt.Fprintf(&sb, "\n  %s (residual %.2g, %s, %d iterations)", value, r.Residual, r.Method, r.Iterations)
+		}
+	}
+	return sb.String()
+}
+
+// integrateInput is the input of the integrate tool
+type integrateInput struct {
+	Expression string `json:"expression" jsonschema:"The integrand, in calculate syntax (e.g. 'sin(x)', 'exp(-x^2)', '1/(1+x^2)')"`
+	Variable   string `json:"variable,omitempty" jsonschema:"The variable of integration (default x); other names refer to session variables"`
+	From       any    `json:"from" jsonschema:"Lower limit: a number, an expression such as 'pi/2', or '-inf'"`
+	To         any    `json:"to" jsonschema:"Upper limit: a number, an expression such as '2*pi', or 'inf'"`
+}
+
+// integrateOutput is the structured output of the integrate tool
+type integrateOutput struct {
+	Result        string     `json:"result"`
+	Value         float64    `json:"value"`
+	ErrorEstimate float64    `json:"errorEstimate" jsonschema:"Estimated absolute error of the value"`
+	Evaluations   int        `json:"evaluations" jsonschema:"The number of times the integrand was evaluated"`
+	Subintervals  int        `json:"subintervals" jsonschema:"The number of subintervals the range was divided into"`
+	Converged     bool       `json:"converged" jsonschema:"Whether the error estimate met the accuracy goal of 1e-10 relative or 1e-12 absolute"`
+	Error         *exprError `json:"error,omitempty" jsonschema:"Details of the problem when the integrand or a limit could not be evaluated"`
+}
+
+func handleIntegrate(ctx context.Context, req *mcp.CallToolRequest, input integrateInput) (*mcp.CallToolResult, integrateOutput, error) {
+	expression := input.Expression
+	if len(expression) == 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression cannot be empty"},
+			},
+		}, integrateOutput{}, nil
+	}
+	if len(expression) > 500 {
+		log.Printf("Integrate error - expression too long: %d characters", len(expression))
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression too long (maximum 500 characters)"},
+			},
+		}, integrateOutput{}, nil
+	}
+
+	variable := "x"
+	if input.Variable != "" {
+		variable = input.Variable
+	}
+	if err := checkVariable(variable); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: err.Error()},
+			},
+		}, integrateOutput{}, nil
+	}
+
+	state := sessions.get(req.Session)
+	funcs := state.snapshotFunctions()
+	vars := state.snapshotVariables()
+	from, to, res := readLimits(input.From, input.To, vars, funcs)
+	if res != nil {
+		return res, integrateOutput{}, nil
+	}
+
+	body, err := parseExpression(expression)
+	var r integration
+	ev := &boundEvaluator{ctx: ctx, x: variable, vars: vars, funcs: funcs}
+	if err == nil {
+		r, err = integrate(ev, body, from, to)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("Integrate cancelled: %s", expression)
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: "Integration cancelled"},
+				},
+			}, integrateOutput{}, nil
+		}
+		e := asExprError(err, errKindSyntax)
+		log.Printf("Integrate error: %s - %v", expression, e)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Integration error: " + e.render(expression)},
+			},
+		}, integrateOutput{Error: e}, nil
+	}
+
+	resultStr := fmt.Sprintf("∫ %s d%s from %s to %s = %s", strings.TrimSpace(expression), variable, formatLimit(from), formatLimit(to), formatResult(r.value))
+	if r.converged {
+		resultStr += fmt.Sprintf("\nError estimate: %.2g (%d evaluations on %d subinterval(s))", r.errorEstimate, ev.evaluations, r.subintervals)
+	} else {
+		resultStr += fmt.Sprintf("\nDid not reach the accuracy goal after %d evaluations on %d subintervals: error estimate %.2g; the integrand may be singular or oscillate too fast", ev.evaluations, r.subintervals, r.errorEstimate)
+	}
+	log.Printf("Integrate: %s", strings.ReplaceAll(resultStr, "\n", "; "))
+	return nil, integrateOutput{
+		Result:        resultStr,
+		Value:         r.value,
+		ErrorEstimate: r.errorEstimate,
+		Evaluations:   ev.evaluations,
+		Subintervals:  r.subintervals,
+		Converged:     r.converged,
+	}, nil
+}
+
+// seriesInput is the input of the sum and product tools
+type seriesInput struct {
+	Expression string `json:"expression" jsonschema:"The term, in calculate syntax, in terms of the index (e.g. '1/n^2', '(-1)^n/(2n+1)', '1 - 1/(4n^2)')"`
+	Index      string `json:"index,omitempty" jsonschema:"The index variable (default n); other names refer to session variables"`
+	From       any    `json:"from" jsonschema:"The first index: an integer or an expression such as 'k + 1'"`
+	To         any    `json:"to" jsonschema:"The last index: an integer, an expression, or 'inf' for an infinite series"`
+}
+
+// seriesOutput is the structured output of the sum and product tools
+type seriesOutput struct {
+	Result        string     `json:"result"`
+	Value         float64    `json:"value"`
+	ErrorEstimate float64    `json:"errorEstimate" jsonschema:"Estimated absolute error of the value: rounding for a finite range, the uncertainty of the limit for an infinite series"`
+	Evaluations   int        `json:"evaluations" jsonschema:"The number of terms evaluated"`
+	Method        string     `json:"method" jsonschema:"direct when the terms were combined one by one, levin when the limit of an infinite series was extrapolated with the Levin u-transform"`
+	Converged     bool       `json:"converged" jsonschema:"False when an infinite series did not settle within the term limit and may diverge"`
+	Error         *exprError `json:"error,omitempty" jsonschema:"Details of the problem when a term or a limit could not be evaluated"`
+}
+
+func handleSum(ctx context.Context, req *mcp.CallToolRequest, input seriesInput) (*mcp.CallToolResult, seriesOutput, error) {
+	return evaluateSeries(ctx, req, input, false)
+}
+
+func handleProduct(ctx context.Context, req *mcp.CallToolRequest, input seriesInput) (*mcp.CallToolResult, seriesOutput, error) {
+	return evaluateSeries(ctx, req, input, true)
+}
+
+// evaluateSeries adds up or multiplies the terms of a sum or product tool call
+func evaluateSeries(ctx context.Context, req *mcp.CallToolRequest, input seriesInput, product bool) (*mcp.CallToolResult, seriesOutput, error) {
+	operation, symbol := "Sum", "Σ"
+	if product {
+		operation, symbol = "Product", "Π"
+	}
+	expression := input.Expression
+	if len(expression) == 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression cannot be empty"},
+			},
+		}, seriesOutput{}, nil
+	}
+	if len(expression) > 500 {
+		log.Printf("%s error - expression too long: %d characters", operation, len(expression))
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Expression too long (maximum 500 characters)"},
+			},
+		}, seriesOutput{}, nil
+	}
+
+	index := "n"
+	if input.Index != "" {
+		index = input.Index
+	}
+	if err := checkVariable(index); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: err.Error()},
+			},
+		}, seriesOutput{}, nil
+	}
+
+	state := sessions.get(req.Session)
+	funcs := state.snapshotFunctions()
+	vars := state.snapshotVariables()
+	from, to, res := readLimits(input.From, input.To, vars, funcs)
+	if res != nil {
+		return res, seriesOutput{}, nil
+	}
+	var problem string
+	switch {
+	case math.IsInf(from, 0) || from != math.Trunc(from) || math.Abs(from) > maxExactFloatInt:
+		problem = fmt.Sprintf("the first index must be a finite integer, got %s", formatLimit(from))
+	case math.IsInf(to, -1) || !math.IsInf(to, 1) && (to != math.Trunc(to) || math.Abs(to) > maxExactFloatInt):
+		problem = fmt.Sprintf("the last index must be an integer or inf, got %s", formatLimit(to))
+	case !math.IsInf(to, 1) && to-from >= maxSeriesTerms:
+		problem = fmt.Sprintf("the range has %s terms, more than the limit of %d", formatResult(to-from+1), maxSeriesTerms)
+	}
+	if problem != "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Invalid index range: %s", problem)},
+			},
+		}, seriesOutput{}, nil
+	}
 
-	log.Println("Loaded prompts: math_problem, explain_calculation")
-	log.Println("MCP server initialization complete")
+	body, err := parseExpression(expression)
+	var r seriesResult
+	ev := &boundEvaluator{ctx: ctx, x: index, vars: vars, funcs: funcs}
+	if err == nil {
+		r, err = series(ev, body, from, to, product)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("%s cancelled: %s", operation, expression)
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: operation + " cancelled"},
+				},
+			}, seriesOutput{}, nil
+		}
+		e := asExprError(err, errKindSyntax)
+		log.Printf("%s error: %s - %v", operation, expression, e)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: operation + " error: " + e.render(expression)},
+			},
+		}, seriesOutput{Error: e}, nil
+	}
 
-	return s
+	method := "direct"
+	if r.accelerated {
+		method = "levin"
+	}
+	resultStr := fmt.Sprintf("%s %s for %s = %s to %s = %s", symbol, strings.TrimSpace(expression), index, formatLimit(from), formatLimit(to), formatResult(r.value))
+	switch {
+	case !r.converged:
+		resultStr += fmt.Sprintf("\nDid not converge after %d terms; the series may diverge. The value is the last partial %s", r.terms, strings.ToLower(operation))
+	case r.accelerated:
+		resultStr += fmt.Sprintf("\nError estimate: %.2g (limit extrapolated from %d terms with the Levin u-transform)", r.errorEstimate, r.terms)
+	default:
+		resultStr += fmt.Sprintf("\nError estimate: %.2g (%d terms)", r.errorEstimate, r.terms)
+	}
+	log.Printf("%s: %s", operation, strings.ReplaceAll(resultStr, "\n", "; "))
+	return nil, seriesOutput{
+		Result:        resultStr,
+		Value:         r.value,
+		ErrorEstimate: r.errorEstimate,
+		Evaluations:   ev.evaluations,
+		Method:        method,
+		Converged:     r.converged,
+	}, nil
 }
 
-func startHTTPServer(s *mcp.Server) {
-	port := "8080"
-	if portStr := os.Getenv("PORT"); portStr != "" {
-		port = portStr
+// readLimits evaluates the from and to limits of the integrate, sum and product tools. It
+// returns an error result when either is invalid.
+func readLimits(fromArg, toArg any, vars map[string]float64, funcs map[string]*userFunction) (float64, float64, *mcp.CallToolResult) {
+	var limits [2]float64
+	for i, limit := range []struct {
+		name string
+		arg  any
+	}{{"from", fromArg}, {"to", toArg}} {
+		name, arg := limit.name, limit.arg
+		v, err := parseBound(arg, vars, funcs)
+		if err != nil {
+			text := fmt.Sprintf("Invalid '%s': %v", name, err)
+			if s, ok := arg.(string); ok {
+				text = fmt.Sprintf("Invalid '%s': %s", name, asExprError(err, errKindSyntax).render(s))
+			}
+			return 0, 0, &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: text},
+				},
+			}
+		}
+		if math.IsNaN(v) {
+			return 0, 0, &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: fmt.Sprintf("Invalid '%s': not a number", name)},
+				},
+			}
+		}
+		limits[i] = v
 	}
+	return limits[0], limits[1], nil
+}
 
-	log.Printf("starting server with streamable-http transport on port %s", port)
-
-	// Create streamable HTTP handler
-	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
-		return s
-	}, &mcp.StreamableHTTPOptions{
-		SessionTimeout: 5 * time.Minute,
-		Stateless:      false,
-	})
-
-	// Create HTTP mux for additional endpoints
-	mux := http.NewServeMux()
+// formatLimit prints a limit of integration or summation, writing infinities as inf
+func formatLimit(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "inf"
+	case math.IsInf(v, -1):
+		return "-inf"
+	}
+	return formatResult(v)
+}
 
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("OK")); err != nil {
-			log.Printf("Health check write error: %v", err)
-		}
-	})
+// matrixOperations are the operations of the matrix tool
+var matrixOperations = []string{"add", "subtract", "multiply", "transpose", "determinant", "inverse", "rank", "solve", "lu", "qr", "eigenvalues"}
 
-	// Mount the MCP streamable HTTP handler at /mcp
-	mux.Handle("/mcp", handler)
+// matrixInput is the input of the matrix tool
+type matrixInput struct {
+	Operation string `json:"operation" jsonschema:"One of add, subtract, multiply, transpose, determinant, inverse, rank, solve, lu, qr or eigenvalues"`
+	A         any    `json:"a" jsonschema:"A matrix as an array of rows (e.g. [[1, 2], [3, 4]]) or a vector as an array of entries (e.g. [1, 2]), which is treated as a column; entries are numbers or expressions such as 'sqrt(2)'"`
+	B         any    `json:"b,omitempty" jsonschema:"The second operand of add, subtract and multiply, or the right-hand side b of solve: a matrix or a vector"`
+}
 
-	// Start HTTP server
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), mux); err != nil {
-		log.Fatalf("HTTP server error: %v", err)
-	}
+// matrixOutput is the structured output of the matrix tool
+type matrixOutput struct {
+	Result       string      `json:"result"`
+	Matrix       [][]float64 `json:"matrix,omitempty" jsonschema:"The resulting matrix as an array of rows, for add, subtract, multiply, transpose, inverse and solve"`
+	Vector       []float64   `json:"vector,omitempty" jsonschema:"The resulting vector, when add, subtract, multiply or solve is given a vector (e.g. the solution x of Ax = b)"`
+	Value        *float64    `json:"value,omitempty" jsonschema:"The determinant or the rank"`
+	P            [][]float64 `json:"p,omitempty" jsonschema:"lu: the permutation matrix, with PA = LU"`
+	L            [][]float64 `json:"l,omitempty" jsonschema:"lu: the unit lower triangular factor"`
+	U            [][]float64 `json:"u,omitempty" jsonschema:"lu: the upper triangular factor"`
+	Q            [][]float64 `json:"q,omitempty" jsonschema:"qr: the orthogonal factor, with A = QR"`
+	R            [][]float64 `json:"r,omitempty" jsonschema:"qr: the upper triangular factor, with a non-negative diagonal"`
+	Eigenvalues  []float64   `json:"eigenvalues,omitempty" jsonschema:"The eigenvalues of a symmetric matrix, in ascending order"`
+	Eigenvectors [][]float64 `json:"eigenvectors,omitempty" jsonschema:"Unit eigenvectors, one row per eigenvalue in the same order"`
+	Error        *exprError  `json:"error,omitempty" jsonschema:"Details of the problem, such as a dimension mismatch or a singular matrix"`
 }
 
-func handleCalculate(ctx context.Context, req *mcp.CallToolRequest, input struct {
-	Expression string `json:"expression" jsonschema:"A mathematical expression to evaluate (e.g., '2 + 3', '10 * 5', '15 / 3')"`
-}) (*mcp.CallToolResult, struct {
-	Result string `json:"result"`
-}, error) {
-	expression := input.Expression
+func handleMatrix(ctx context.Context, req *mcp.CallToolRequest, input matrixInput) (*mcp.CallToolResult, matrixOutput, error) {
+	operation := strings.ToLower(strings.TrimSpace(input.Operation))
+	if !slices.Contains(matrixOperations, operation) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Unknown operation '%s': expected one of %s", input.Operation, strings.Join(matrixOperations, ", "))},
+			},
+		}, matrixOutput{}, nil
+	}
 
-	// Validate expression length and characters
-	if len(expression) == 0 {
-		log.Printf("Calculate error - empty expression")
+	state := sessions.get(req.Session)
+	funcs := state.snapshotFunctions()
+	vars := state.snapshotVariables()
+	a, err := parseMatrix(input.A, vars, funcs)
+	if err != nil {
 		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Invalid 'a': %v", err)},
+			},
+		}, matrixOutput{}, nil
+	}
+	var b matrixOperand
+	switch operation {
+	case "add", "subtract", "multiply", "solve":
+		if input.B == nil {
+			return &mcp.CallToolResult{
 				IsError: true,
 				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Expression cannot be empty"},
+					&mcp.TextContent{Text: fmt.Sprintf("'b' is required for %s", operation)},
 				},
-			}, struct {
-				Result string `json:"result"`
-			}{}, nil
-	}
-
-	if len(expression) > 500 {
-		log.Printf("Calculate error - expression too long: %d characters", len(expression))
-		return &mcp.CallToolResult{
+			}, matrixOutput{}, nil
+		}
+		if b, err = parseMatrix(input.B, vars, funcs); err != nil {
+			return &mcp.CallToolResult{
 				IsError: true,
 				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Expression too long (maximum 500 characters)"},
+					&mcp.TextContent{Text: fmt.Sprintf("Invalid 'b': %v", err)},
 				},
-			}, struct {
-				Result string `json:"result"`
-			}{}, nil
+			}, matrixOutput{}, nil
+		}
 	}
 
-	// Check for valid characters
-	validChars := "0123456789+-*/.()eE "
-	for _, char := range expression {
-		if !strings.ContainsRune(validChars, char) {
-			log.Printf("Calculate error - invalid character: %c", char)
-			return &mcp.CallToolResult{
-					IsError: true,
-					Content: []mcp.Content{
-						&mcp.TextContent{Text: fmt.Sprintf("Invalid character in expression: '%c'", char)},
-					},
-				}, struct {
-					Result string `json:"result"`
-				}{}, nil
+	output, err := applyMatrixOperation(operation, a, b)
+	if err != nil {
+		e := asExprError(err, errKindDimension)
+		log.Printf("Matrix %s error: %v", operation, e)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Matrix error: " + e.Message},
+			},
+		}, matrixOutput{Error: e}, nil
+	}
+	log.Printf("Matrix %s: %s", operation, strings.ReplaceAll(output.Result, "\n", "; "))
+	return nil, output, nil
+}
+
+// applyMatrixOperation carries out an operation of the matrix tool. The results of add,
+// subtract, multiply and solve are vectors when the operand b is one, and for add and subtract
+// when a is too.
+func applyMatrixOperation(operation string, a, b matrixOperand) (matrixOutput, error) {
+	var output matrixOutput
+	var result matrix
+	var err error
+	vector := false
+	switch operation {
+	case "add", "subtract":
+		sign, symbol := 1.0, "+"
+		if operation == "subtract" {
+			sign, symbol = -1, "-"
 		}
+		if result, err = a.add(b.matrix, sign); err != nil {
+			return output, err
+		}
+		vector = a.vector && b.vector
+		output.Result = "a " + symbol + " b = "
+	case "multiply":
+		if result, err = a.mul(b.matrix); err != nil {
+			return output, err
+		}
+		vector = b.vector
+		output.Result = "ab = "
+	case "transpose":
+		result = a.transpose()
+		output.Result = "Transpose: "
+	case "solve":
+		if err := a.requireSquare("solve"); err != nil {
+			return output, err
+		}
+		if result, err = a.lu().solve(b.matrix); err != nil {
+			return output, err
+		}
+		vector = b.vector
+		output.Result = "Solution of ax = b: x = "
+	case "inverse":
+		if err := a.requireSquare("inverse"); err != nil {
+			return output, err
+		}
+		d := a.lu()
+		if d.singular != 0 {
+			return output, newExprError(errKindSingular, 0, 0, "the matrix is singular (pivot %d is zero), so it has no inverse", d.singular)
+		}
+		if result, err = d.solve(identity(a.rows())); err != nil {
+			return output, err
+		}
+		output.Result = "Inverse: "
+	case "determinant":
+		if err := a.requireSquare("determinant"); err != nil {
+			return output, err
+		}
+		det := a.lu().determinant()
+		output.Value = &det
+		output.Result = "det(a) = " + formatResult(det)
+		return output, nil
+	case "rank":
+		rank := float64(a.rank())
+		output.Value = &rank
+		output.Result = fmt.Sprintf("rank(a) = %d for a %s matrix", int(rank), a.size())
+		return output, nil
+	case "lu":
+		if err := a.requireSquare("LU decomposition"); err != nil {
+			return output, err
+		}
+		d := a.lu()
+		p, l, u := d.factors()
+		output.P, output.L, output.U = p, l, u
+		output.Result = fmt.Sprintf("PA = LU with\nP = %s\nL = %s\nU = %s", formatMatrix(p), formatMatrix(l), formatMatrix(u))
+		if d.singular != 0 {
+			output.Result += fmt.Sprintf("\nThe matrix is singular: pivot %d is zero", d.singular)
+		}
+		return output, nil
+	case "qr":
+		q, r := a.qr()
+		output.Q, output.R = q, r
+		output.Result = fmt.Sprintf("A = QR with\nQ = %s\nR = %s", formatMatrix(q), formatMatrix(r))
+		return output, nil
+	case "eigenvalues":
+		if err := a.requireSquare("eigenvalues"); err != nil {
+			return output, err
+		}
+		if err := a.checkSymmetric(); err != nil {
+			return output, err
+		}
+		values, vectors, sweeps, converged := a.symmetricEigen()
+		output.Eigenvalues, output.Eigenvectors = values, vectors
+		output.Result = fmt.Sprintf("Eigenvalues: %s\nEigenvectors (one per row): %s", formatVector(values), formatMatrix(vectors))
+		if !converged {
+			output.Result += fmt.Sprintf("\nThe Jacobi method did not converge after %d sweeps; the values may be inaccurate", sweeps)
+		}
+		return output, nil
+	}
+
+	if vector {
+		output.Vector = result.column()
+		output.Result += formatVector(output.Vector)
+	} else {
+		output.Matrix = result
+		output.Result += formatMatrix(result)
 	}
+	return output, nil
+}
+
+// statisticsInput is the input of the statistics tool
+type statisticsInput struct {
+	Data        any       `json:"data" jsonschema:"The dataset: an array of numbers (e.g. [2, 4, 4, 5]), or text such as CSV with numbers separated by commas, or by whitespace, semicolons or new lines; a first row that is not numeric is a header"`
+	Column      string    `json:"column,omitempty" jsonschema:"For text with several columns: the header name or 1-based number of the column to describe"`
+	Percentiles []float64 `json:"percentiles,omitempty" jsonschema:"Further percentiles to compute, from 0 to 100 (e.g. [5, 95])"`
+}
+
+// percentileValue is a requested percentile of the statistics tool
+type percentileValue struct {
+	Percentile float64 `json:"percentile"`
+	Value      float64 `json:"value"`
+}
+
+// statisticsOutput is the structured output of the statistics tool
+type statisticsOutput struct {
+	Result             string            `json:"result"`
+	Count              int               `json:"count,omitempty" jsonschema:"The number of values"`
+	Missing            int               `json:"missing,omitempty" jsonschema:"Empty CSV cells that were skipped"`
+	Column             string            `json:"column,omitempty" jsonschema:"The column of a table that was described, by header name or number"`
+	Sum                *float64          `json:"sum,omitempty" jsonschema:"The sum of the values; omitted when it overflows float64"`
+	Mean               *float64          `json:"mean,omitempty"`
+	Median             *float64          `json:"median,omitempty"`
+	Mode               []float64         `json:"mode,omitempty" jsonschema:"The most frequent values, in ascending order; omitted when no value occurs more than once"`
+	ModeCount          int               `json:"modeCount,omitempty" jsonschema:"How many times each mode occurs"`
+	Min                *float64          `json:"min,omitempty"`
+	Max                *float64          `json:"max,omitempty"`
+	Q1                 *float64          `json:"q1,omitempty" jsonschema:"The first quartile (25th percentile)"`
+	Q3                 *float64          `json:"q3,omitempty" jsonschema:"The third quartile (75th percentile)"`
+	IQR                *float64          `json:"iqr,omitempty" jsonschema:"The interquartile range q3 - q1"`
+	PopulationVariance *float64          `json:"populationVariance,omitempty" jsonschema:"The variance with divisor n"`
+	SampleVariance     *float64          `json:"sampleVariance,omitempty" jsonschema:"The variance with divisor n - 1; omitted for a single value"`
+	PopulationStddev   *float64          `json:"populationStddev,omitempty" jsonschema:"The standard deviation with divisor n"`
+	SampleStddev       *float64          `json:"sampleStddev,omitempty" jsonschema:"The standard deviation with divisor n - 1; omitted for a single value"`
+	Skewness           *float64          `json:"skewness,omitempty" jsonschema:"The moment coefficient of skewness; omitted when all values are equal"`
+	Kurtosis           *float64          `json:"kurtosis,omitempty" jsonschema:"The excess kurtosis, 0 for a normal distribution; omitted when all values are equal"`
+	Percentiles        []percentileValue `json:"percentiles,omitempty" jsonschema:"The requested percentiles"`
+	Error              *exprError        `json:"error,omitempty" jsonschema:"Details of the problem when the statistics could not be computed in float64"`
+}
 
-	result, err := evaluateExpression(expression)
+func handleStatistics(ctx context.Context, req *mcp.CallToolRequest, input statisticsInput) (*mcp.CallToolResult, statisticsOutput, error) {
+	d, err := parseDataset(input.Data, strings.TrimSpace(input.Column))
+	if err == nil && len(d.values) == 0 {
+		err = fmt.Errorf("the data contains no numbers")
+	}
 	if err != nil {
-		log.Printf("Calculate error - evaluation failed: %v", err)
+		log.Printf("Statistics error - invalid data: %v", err)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Invalid 'data': %v", err)},
+			},
+		}, statisticsOutput{}, nil
+	}
+	if len(input.Percentiles) > 100 {
 		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Too many percentiles: %d (maximum 100)", len(input.Percentiles))},
+			},
+		}, statisticsOutput{}, nil
+	}
+	for _, p := range input.Percentiles {
+		if !(p >= 0 && p <= 100) {
+			return &mcp.CallToolResult{
 				IsError: true,
 				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Calculation error: %v", err)},
+					&mcp.TextContent{Text: fmt.Sprintf("Invalid percentile %s: percentiles run from 0 to 100", formatResult(p))},
 				},
-			}, struct {
-				Result string `json:"result"`
-			}{}, nil
+			}, statisticsOutput{}, nil
+		}
 	}
 
-	// Check for special float values, NaN check
-	if math.IsNaN(result) {
-		log.Printf("Calculate error - result is NaN")
+	s, err := describe(d.values)
+	if err != nil {
+		e := asExprError(err, errKindInvalidResult)
+		log.Printf("Statistics error: %v", e)
 		return &mcp.CallToolResult{
-				IsError: true,
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Calculation resulted in an invalid number (NaN)"},
-				},
-			}, struct {
-				Result string `json:"result"`
-			}{}, nil
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Statistics error: " + e.Message},
+			},
+		}, statisticsOutput{Error: e}, nil
 	}
 
-	resultStr := fmt.Sprintf("Result: %s = %s", expression, formatResult(result))
-	log.Printf("Calculate result: %s = %s", expression, formatResult(result))
-	return nil, struct {
-		Result string `json:"result"`
-	}{
-		Result: resultStr,
-	}, nil
+	output := statisticsOutput{
+		Count:              s.count,
+		Missing:            d.missing,
+		Column:             d.column,
+		Sum:                finiteValue(s.sum),
+		Mean:               &s.mean,
+		Median:             &s.median,
+		Mode:               s.mode,
+		ModeCount:          s.modeCount,
+		Min:                &s.min,
+		Max:                &s.max,
+		Q1:                 &s.q1,
+		Q3:                 &s.q3,
+		IQR:                finiteValue(s.q3 - s.q1),
+		PopulationVariance: s.populationVariance,
+		SampleVariance:     s.sampleVariance,
+		PopulationStddev:   s.populationDeviation,
+		SampleStddev:       s.sampleDeviation,
+		Skewness:           s.skewness,
+		Kurtosis:           s.kurtosis,
+	}
+	for _, p := range input.Percentiles {
+		output.Percentiles = append(output.Percentiles, percentileValue{Percentile: p, Value: s.percentile(p)})
+	}
+
+	sum := formatResult(s.sum)
+	if output.Sum == nil {
+		sum = "overflows float64"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Count: %d, sum: %s, mean: %s", s.count, sum, formatResult(s.mean))
+	if d.missing > 0 {
+		fmt.Fprintf(&b, " (%d empty cells skipped)", d.missing)
+	}
+	mode := "none"
+	if s.mode != nil {
+		modes := make([]string, len(s.mode))
+		for i, m := range s.mode {
+			modes[i] = formatResult(m)
+		}
+		mode = fmt.Sprintf("%s (%d times)", strings.Join(modes, ", "), s.modeCount)
+	}
+	fmt.Fprintf(&b, "\nMedian: %s, mode: %s", formatResult(s.median), mode)
+	fmt.Fprintf(&b, "\nMin: %s, max: %s, Q1: %s, Q3: %s, IQR: %s", formatResult(s.min), formatResult(s.max), formatResult(s.q1), formatResult(s.q3), formatResult(s.q3-s.q1))
+	if s.sampleVariance != nil {
+		fmt.Fprintf(&b, "\nVariance: %s (sample), %s (population)", formatResult(*s.sampleVariance), formatResult(*s.populationVariance))
+		fmt.Fprintf(&b, "\nStandard deviation: %s (sample), %s (population)", formatResult(*s.sampleDeviation), formatResult(*s.populationDeviation))
+	} else {
+		fmt.Fprintf(&b, "\nVariance: %s (population; a single value has no sample variance)", formatResult(*s.populationVariance))
+	}
+	if s.skewness != nil {
+		fmt.Fprintf(&b, "\nSkewness: %s, excess kurtosis: %s", formatResult(*s.skewness), formatResult(*s.kurtosis))
+	}
+	if len(output.Percentiles) > 0 {
+		percentiles := make([]string, len(output.Percentiles))
+		for i, p := range output.Percentiles {
+			percentiles[i] = fmt.Sprintf("P%s = %s", formatResult(p.Percentile), formatResult(p.Value))
+		}
+		fmt.Fprintf(&b, "\nPercentiles: %s", strings.Join(percentiles, ", "))
+	}
+	output.Result = b.String()
+	log.Printf("Statistics: %d values, mean %s", s.count, formatResult(s.mean))
+	return nil, output, nil
 }
 
 // generateUniform creates a uniform random number in the range [min, max)
@@ -312,13 +2116,23 @@ func generateExponential(min, max float64) (float64, error) {
 	return result, nil
 }
 
+// distributions are the probability distributions of the random_number tool
+var distributions = []any{"uniform", "normal", "exponential"}
+
+// randomNumberOutput is the structured output of the random_number tool
+type randomNumberOutput struct {
+	Result       string  `json:"result"`
+	Value        float64 `json:"value" jsonschema:"The random number"`
+	Min          float64 `json:"min" jsonschema:"The lower end of the range"`
+	Max          float64 `json:"max" jsonschema:"The upper end of the range"`
+	Distribution string  `json:"distribution,omitempty" jsonschema:"The distribution the number was drawn from: uniform, normal or exponential"`
+}
+
 func handleRandomNumber(ctx context.Context, req *mcp.CallToolRequest, input struct {
 	Min          *float64 `json:"min,omitempty" jsonschema:"Minimum value (default: 1)"`
 	Max          *float64 `json:"max,omitempty" jsonschema:"Maximum value (default: 100)"`
 	Distribution *string  `json:"distribution,omitempty" jsonschema:"Probability distribution: 'uniform' (default), 'normal' (Gaussian/bell curve), or 'exponential' (exponential decay)"`
-}) (*mcp.CallToolResult, struct {
-	Result string `json:"result"`
-}, error) {
+}) (*mcp.CallToolResult, randomNumberOutput, error) {
 	minm := 1.0
 	maxi := 100.0
 
@@ -343,7 +2157,7 @@ func handleRandomNumber(ctx context.Context, req *mcp.CallToolRequest, input str
 				Properties: map[string]*jsonschema.Schema{
 					"distribution": {
 						Type:        "string",
-						Enum:        []any{"uniform", "normal", "exponential"},
+						Enum:        distributions,
 						Description: "Probability distribution type:\n- uniform: Even spread across the range\n- normal: Bell curve (Gaussian) centered in the range\n- exponential: Exponential decay from minimum",
 					},
 				},
@@ -386,26 +2200,22 @@ func handleRandomNumber(ctx context.Context, req *mcp.CallToolRequest, input str
 	// Validate distribution
 	if distribution != "uniform" && distribution != "normal" && distribution != "exponential" {
 		return &mcp.CallToolResult{
-				IsError: true,
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Unknown distribution: %s. Supported distributions are: uniform, normal, exponential", distribution)},
-				},
-			}, struct {
-				Result string `json:"result"`
-			}{}, nil
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Unknown distribution: %s. Supported distributions are: uniform, normal, exponential", distribution)},
+			},
+		}, randomNumberOutput{}, nil
 	}
 
 	// Generate random number
 	if minm >= maxi {
 		log.Printf("Random number error - invalid range: min=%.2f, max=%.2f", minm, maxi)
 		return &mcp.CallToolResult{
-				IsError: true,
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Minimum value must be less than maximum value"},
-				},
-			}, struct {
-				Result string `json:"result"`
-			}{}, nil
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Minimum value must be less than maximum value"},
+			},
+		}, randomNumberOutput{}, nil
 	}
 
 	var result float64
@@ -423,37 +2233,28 @@ func handleRandomNumber(ctx context.Context, req *mcp.CallToolRequest, input str
 	if err != nil {
 		log.Printf("Random number generation error: %v", err)
 		return &mcp.CallToolResult{
-				IsError: true,
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Failed to generate random number"},
-				},
-			}, struct {
-				Result string `json:"result"`
-			}{}, nil
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "Failed to generate random number"},
+			},
+		}, randomNumberOutput{}, nil
 	}
 
 	resultStr := fmt.Sprintf("Random number (%s distribution) between %.2f and %.2f: %.6f", distribution, minm, maxi, result)
 	log.Printf("Generated random number: %.4f (distribution: %s, range: %.2f-%.2f)", result, distribution, minm, maxi)
-	return nil, struct {
-		Result string `json:"result"`
-	}{
-		Result: resultStr,
+	return nil, randomNumberOutput{
+		Result:       resultStr,
+		Value:        result,
+		Min:          minm,
+		Max:          maxi,
+		Distribution: distribution,
 	}, nil
 }
 
 func handleMathConstants(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
 	log.Printf("Resource access: %s", req.Params.URI)
 
-	constants := map[string]interface{}{
-		"pi":    3.141592653589793,
-		"e":     2.718281828459045,
-		"phi":   1.618033988749895, // Golden ratio
-		"sqrt2": 1.4142135623730951,
-		"ln2":   0.6931471805599453,
-		"ln10":  2.302585092994046,
-	}
-
-	data, _ := json.MarshalIndent(constants, "", "  ")
+	data, _ := json.MarshalIndent(mathConstants, "", "  ")
 
 	return &mcp.ReadResourceResult{
 		Contents: []*mcp.ResourceContents{
@@ -474,7 +2275,7 @@ Server Name: %s
 Version: %s
 Protocol: Model Context Protocol (MCP)
 Capabilities:
-  - Tools: 2 available (calculate, random_number)
+  - Tools: 14 available (calculate, calculate_batch, random_number, variables, functions, differentiate, simplify, expand, solve, integrate, sum, product, matrix, statistics)
   - Resources: 2 available (math constants, server info)
   - Prompts: 2 available (math problem, explain calculation)
 
@@ -551,9 +2352,26 @@ func handleExplainCalculationPrompt(ctx context.Context, req *mcp.GetPromptReque
 	if expression == "" {
 		expression = "2 + 3 * 4"
 	}
+	if len(expression) > 500 {
+		log.Printf("Explain calculation error - expression too long: %d characters", len(expression))
+		return nil, fmt.Errorf("expression too long (maximum 500 characters)")
+	}
+
+	// The steps come from the evaluator itself, so the explanation cannot drift from the real result
+	state := sessions.get(req.Session)
+	var verified string
+	steps, err := traceStatement(expression, &evaluator{ctx: ctx, vars: state.snapshotVariables(), funcs: state.snapshotFunctions()})
+	if err != nil {
+		log.Printf("Explain calculation - trace failed: %v", err)
+		verified = fmt.Sprintf("The calculator could not evaluate this expression:\n\n%s\n\nExplain what is wrong with it and how to correct it.", asExprError(err, errKindSyntax).render(expression))
+	} else {
+		verified = fmt.Sprintf("The calculator evaluated it in these verified steps, one operation at a time:\n\n%s\n\nBase the breakdown and the final answer on exactly these steps.", strings.Join(steps, "\n→ "))
+	}
 
 	prompt := fmt.Sprintf(`Explain how to solve this mathematical expression step by step: %s
 
+%s
+
 Please provide:
 1. The expression to solve
 2. Order of operations (PEMDAS/BODMAS) explanation
@@ -561,7 +2379,7 @@ Please provide:
 4. Final answer
 5. A brief explanation of why each step was necessary
 
-Make the explanation clear, suitable for someone learning mathematics.`, expression)
+Make the explanation clear, suitable for someone learning mathematics.`, expression, verified)
 
 	return &mcp.GetPromptResult{
 		Description: fmt.Sprintf("Step-by-step explanation for solving: %s", expression),
@@ -574,205 +2392,6 @@ Make the explanation clear, suitable for someone learning mathematics.`, express
 	}, nil
 }
 
-// evaluateExpression evaluates a mathematical expression with proper operator precedence and parentheses support
-func evaluateExpression(expr string) (float64, error) {
-	expr = removeSpaces(expr)
-	if expr == "" {
-		return 0, fmt.Errorf("empty expression")
-	}
-	return parseExpression(expr)
-}
-
-// parseExpression handles the main parsing logic
-func parseExpression(expr string) (float64, error) {
-	result, remaining, err := parseAddSubWithRemaining(expr)
-	if err != nil {
-		return 0, err
-	}
-	// Check for leftover characters (e.g., unmatched closing parentheses)
-	if len(remaining) > 0 {
-		return 0, fmt.Errorf("unexpected character '%c' at position %d", remaining[0], len(expr)-len(remaining))
-	}
-	return result, nil
-}
-
-// parseAddSubWithRemaining handles addition and subtraction and returns remaining string
-func parseAddSubWithRemaining(expr string) (float64, string, error) {
-	left, remaining, err := parseMulDiv(expr)
-	if err != nil {
-		return 0, "", err
-	}
-
-	for len(remaining) > 0 {
-		if remaining[0] != '+' && remaining[0] != '-' {
-			break
-		}
-		op := remaining[0]
-		remaining = remaining[1:]
-
-		// Check for consecutive operators
-		if len(remaining) == 0 {
-			return 0, "", fmt.Errorf("operator '%c' at end of expression", op)
-		}
-
-		right, newRemaining, err := parseMulDiv(remaining)
-		if err != nil {
-			return 0, "", err
-		}
-		remaining = newRemaining
-
-		if op == '+' {
-			left += right
-		} else {
-			left -= right
-		}
-	}
-
-	return left, remaining, nil
-}
-
-// parseMulDiv handles multiplication and division (higher precedence)
-func parseMulDiv(expr string) (float64, string, error) {
-	left, remaining, err := parseUnary(expr)
-	if err != nil {
-		return 0, "", err
-	}
-
-	for len(remaining) > 0 {
-		if remaining[0] != '*' && remaining[0] != '/' {
-			break
-		}
-		op := remaining[0]
-		remaining = remaining[1:]
-
-		// Check for consecutive operators
-		if len(remaining) == 0 {
-			return 0, "", fmt.Errorf("operator '%c' at end of expression", op)
-		}
-
-		right, newRemaining, err := parseUnary(remaining)
-		if err != nil {
-			return 0, "", err
-		}
-		remaining = newRemaining
-
-		if op == '*' {
-			left *= right
-		} else {
-			if right == 0 {
-				return 0, "", fmt.Errorf("division by zero is not allowed")
-			}
-			left /= right
-		}
-	}
-
-	return left, remaining, nil
-}
-
-// parseUnary handles unary operators (+ and -)
-func parseUnary(expr string) (float64, string, error) {
-	if len(expr) == 0 {
-		return 0, "", fmt.Errorf("unexpected end of expression")
-	}
-
-	if expr[0] == '+' {
-		return parseUnary(expr[1:])
-	}
-
-	if expr[0] == '-' {
-		val, remaining, err := parseUnary(expr[1:])
-		return -val, remaining, err
-	}
-
-	return parseFactor(expr)
-}
-
-// parseFactor handles numbers and parentheses (highest precedence)
-func parseFactor(expr string) (float64, string, error) {
-	if len(expr) == 0 {
-		return 0, "", fmt.Errorf("unexpected end of expression")
-	}
-
-	// Handle parentheses
-	if expr[0] == '(' {
-		// Find matching closing parenthesis
-		parenCount := 1
-		i := 1
-		for i < len(expr) && parenCount > 0 {
-			switch expr[i] {
-			case '(':
-				parenCount++
-			case ')':
-				parenCount--
-			}
-			i++
-		}
-
-		if parenCount > 0 {
-			return 0, "", fmt.Errorf("mismatched parentheses: missing closing parenthesis")
-		}
-
-		// Evaluate expression inside parentheses
-		innerExpr := expr[1 : i-1]
-		if len(innerExpr) == 0 {
-			return 0, "", fmt.Errorf("empty parentheses are not allowed")
-		}
-		result, err := parseExpression(innerExpr)
-		if err != nil {
-			return 0, "", err
-		}
-
-		return result, expr[i:], nil
-	}
-
-	// Handle numbers
-	return parseNumber(expr)
-}
-
-// parseNumber extracts and parses a number from the beginning of the expression
-func parseNumber(expr string) (float64, string, error) {
-	if len(expr) == 0 {
-		return 0, "", fmt.Errorf("unexpected end of expression")
-	}
-
-	i := 0
-	// Skip digits, decimal point, and scientific notation
-	for i < len(expr) {
-		c := expr[i]
-		if (c >= '0' && c <= '9') || c == '.' {
-			i++
-		} else if c == 'e' || c == 'E' {
-			// Handle scientific notation
-			i++
-			if i < len(expr) && (expr[i] == '+' || expr[i] == '-') {
-				i++
-			}
-			// Continue parsing digits after the exponent
-			for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
-				i++
-			}
-		} else {
-			break
-		}
-	}
-
-	if i == 0 {
-		return 0, "", fmt.Errorf("expected number but found '%c'", expr[0])
-	}
-
-	numberStr := expr[:i]
-	val, err := strconv.ParseFloat(numberStr, 64)
-	if err != nil {
-		return 0, "", fmt.Errorf("invalid number format: %s", numberStr)
-	}
-
-	return val, expr[i:], nil
-}
-
-func removeSpaces(s string) string {
-	return strings.ReplaceAll(s, " ", "")
-}
-
 func formatResult(result float64) string {
 	return fmt.Sprintf("%.10g", result)
 }
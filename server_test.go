@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"math"
+	"slices"
 	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 func TestEvaluateExpression(t *testing.T) {
@@ -19,12 +25,35 @@ func TestEvaluateExpression(t *testing.T) {
 		{"scientific", "1e2", 100, false},
 		{"unary_minus", "-5+3", -2, false},
 
+		// Exponentiation, modulo and floor division
+		{"power_caret", "2^10", 1024, false},
+		{"power_double_star", "2**10", 1024, false},
+		{"power_right_associative", "2^3^2", 512, false},
+		{"power_mixed_right_associative", "2**3^2", 512, false},
+		{"power_over_unary_minus", "-2^2", -4, false},
+		{"power_negative_exponent", "2^-1", 0.5, false},
+		{"power_parenthesized_base", "(-2)^2", 4, false},
+		{"power_over_multiplication", "3*2^2", 12, false},
+		{"power_scientific_base", "1e2^2", 10000, false},
+		{"modulo", "17%5", 2, false},
+		{"modulo_negative_dividend", "-7%3", 2, false},
+		{"modulo_negative_divisor", "7%-3", -2, false},
+		{"floor_division", "17//5", 3, false},
+		{"floor_division_negative", "-7//2", -4, false},
+		{"multiplicative_left_associative", "100//7%4", 2, false},
+		{"modulo_precedence", "2+17%5*3", 8, false},
+
 		// Error cases
 		{"empty_parentheses", "()", 0, true},
 		{"unmatched_closing", "1+2)", 0, true},
 		{"trailing_operator", "2+", 0, true},
 		{"division_by_zero", "5/0", 0, true},
 		{"invalid_character", "2&3", 0, true},
+		{"trailing_power", "2^", 0, true},
+		{"trailing_floor_division", "2//", 0, true},
+		{"modulo_by_zero", "5%0", 0, true},
+		{"floor_division_by_zero", "5//0", 0, true},
+		{"zero_to_negative_power", "0^-1", 0, true},
 	}
 
 	for _, tt := range tests {
@@ -89,3 +118,119 @@ func TestDistributionGenerators(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateStructuredOutput(t *testing.T) {
+	precision := 5
+	tests := []struct {
+		input      calculateInput
+		value      float64 // NaN when value is omitted
+		formatted  string
+		expression string
+		mode       string
+		isInteger  bool
+		isExact    bool
+		overflowed bool
+	}{
+		{calculateInput{Expression: "2(x + 1)^2 + 3"}, 21, "21", "2*(x+1)^2+3", "float", true, true, false},
+		{calculateInput{Expression: "y = 0.5 * 3"}, 1.5, "1.5", "y = 0.5*3", "float", false, true, false},
+		{calculateInput{Expression: "0.1 + 0.2"}, 0.30000000000000004, "0.3", "0.1+0.2", "float", false, false, false},
+		{calculateInput{Expression: "3^40"}, math.Pow(3, 40), "1.215766546e+19", "3^40", "float", true, false, false},
+		{calculateInput{Expression: "x > 1 and x < 3"}, 1, "true", "x > 1 and x < 3", "float", true, true, false},
+		// isExact is conservative: rational arithmetic does not evaluate conditionals
+		{calculateInput{Expression: "x > 1 ? 2 : 3"}, 2, "2", "x > 1 ? 2 : 3", "float", true, false, false},
+		{calculateInput{Expression: "1e308 * 10"}, math.NaN(), "+Inf", "1e308*10", "float", false, false, true},
+		{calculateInput{Expression: "0.1 + 0.2", Precision: &precision}, 0.3, "0.3", "0.1+0.2", "precision", false, true, false},
+		{calculateInput{Expression: "1/3", Precision: &precision}, 0.33333, "0.33333", "1/3", "precision", false, false, false},
+		{calculateInput{Expression: "10^30 / 3", Precision: &precision}, 3.3333e29, "3.3333e+29", "10^30/3", "precision", false, false, false},
+		{calculateInput{Expression: "1/3 + 1/6", Mode: "exact"}, 0.5, "1/2", "1/3+1/6", "exact", false, true, false},
+		{calculateInput{Expression: "sqrt(-4) + 1", Mode: "complex"}, 1, "1 + 2i", "sqrt(-4)+1", "complex", false, false, false},
+		{calculateInput{Expression: "0xFF ^ 2 ** 3", Mode: "programmer"}, 247, "247", "0xFF^2**3", "programmer", true, true, false},
+		{calculateInput{Expression: "5 km / 20 min to km/h", Mode: "units"}, 15, "15", "5*km/(20*min) to km/h", "units", true, false, false},
+		{calculateInput{Expression: "f(t) = 2t^2"}, math.NaN(), "", "f(t) = 2*t^2", "float", false, false, false},
+	}
+	for _, tt := range tests {
+		state := newSessionState()
+		state.setVariable("x", 2)
+		res, out, _ := calculate(context.Background(), tt.input, state)
+		if res != nil {
+			t.Errorf("%s: unexpected error %q", tt.input.Expression, resultText(res))
+			continue
+		}
+		if math.IsNaN(tt.value) != (out.Value == nil) || (out.Value != nil && math.Abs(*out.Value-tt.value) > 1e-9*math.Abs(tt.value)) {
+			t.Errorf("%s: value = %v, want %v", tt.input.Expression, out.Value, tt.value)
+		}
+		if out.Formatted != tt.formatted || out.Expression != tt.expression || out.Mode != tt.mode {
+			t.Errorf("%s: formatted, expression, mode = %q, %q, %q; want %q, %q, %q", tt.input.Expression, out.Formatted, out.Expression, out.Mode, tt.formatted, tt.expression, tt.mode)
+		}
+		if out.IsInteger != tt.isInteger || out.IsExact != tt.isExact || out.Overflowed != tt.overflowed {
+			t.Errorf("%s: isInteger, isExact, overflowed = %v, %v, %v; want %v, %v, %v", tt.input.Expression, out.IsInteger, out.IsExact, out.Overflowed, tt.isInteger, tt.isExact, tt.overflowed)
+		}
+	}
+
+	// Complex results carry both parts, and large counting results all their digits
+	_, out, _ := calculate(context.Background(), calculateInput{Expression: "3 + 4i", Mode: "complex"}, newSessionState())
+	if out.Value == nil || *out.Value != 3 || out.Imaginary == nil || *out.Imaginary != 4 {
+		t.Errorf("unexpected complex output: %+v", out)
+	}
+	_, out, _ = calculate(context.Background(), calculateInput{Expression: "200!"}, newSessionState())
+	if out.Value != nil || !out.Overflowed || !out.IsInteger || !out.IsExact || out.Formatted != out.Integer || len(out.Formatted) != 375 {
+		t.Errorf("unexpected output for 200!: %+v", out)
+	}
+	_, out, _ = calculate(context.Background(), calculateInput{Expression: "171! - 171!"}, newSessionState())
+	if out.Value == nil || *out.Value != 0 || out.Integer != "" || out.Result != "Result: 171! - 171! = 0" {
+		t.Errorf("unexpected output for 171! - 171!: %+v", out)
+	}
+}
+
+func TestStructuredOutputSchemas(t *testing.T) {
+	cs, _ := connectTestClient(t)
+	tools, err := cs.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		tool, enum string
+		values     []string
+		properties []string
+	}{
+		{"calculate", "mode", []string{"float", "precision", "exact", "complex", "programmer", "units"}, []string{"value", "formatted", "expression", "isInteger", "isExact", "overflowed"}},
+		{"random_number", "distribution", []string{"uniform", "normal", "exponential"}, []string{"value", "min", "max"}},
+	} {
+		i := slices.IndexFunc(tools.Tools, func(tool *mcp.Tool) bool { return tool.Name == want.tool })
+		if i < 0 {
+			t.Fatalf("tool %s not listed", want.tool)
+		}
+		var schema struct {
+			Properties map[string]struct {
+				Enum []string `json:"enum"`
+			} `json:"properties"`
+		}
+		data, _ := json.Marshal(tools.Tools[i].OutputSchema)
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(schema.Properties[want.enum].Enum, want.values) {
+			t.Errorf("%s: %s enum = %v, want %v", want.tool, want.enum, schema.Properties[want.enum].Enum, want.values)
+		}
+		for _, name := range want.properties {
+			if _, ok := schema.Properties[name]; !ok {
+				t.Errorf("%s: output schema has no property %s", want.tool, name)
+			}
+		}
+	}
+
+	var out randomNumberOutput
+	callTool(t, cs, "random_number", map[string]any{"min": 10, "max": 20, "distribution": "normal"}, &out)
+	if out.Distribution != "normal" || out.Min != 10 || out.Max != 20 || out.Value < 10 || out.Value > 20 {
+		t.Errorf("unexpected random_number output: %+v", out)
+	}
+	if res := callTool(t, cs, "random_number", map[string]any{"min": 5, "max": 1, "distribution": "uniform"}, nil); !res.IsError {
+		t.Errorf("expected an error for an empty range, got %q", resultText(res))
+	}
+
+	var calc calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "2^10", "mode": "exact"}, &calc)
+	if calc.Value == nil || *calc.Value != 1024 || calc.Mode != "exact" || !calc.IsInteger || !calc.IsExact {
+		t.Errorf("unexpected calculate output: %+v", calc)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// lastResultVariable is updated with the result of every successful calculation in a session
+const lastResultVariable = "ans"
+
+// sessionState holds calculator state that persists across tool calls within one MCP session
+type sessionState struct {
+	mu        sync.Mutex
+	variables map[string]float64
+	// complexVariables holds complex mode results with a non-zero imaginary part; a name is
+	// never in both maps
+	complexVariables map[string]complex128
+	functions        map[string]*userFunction
+}
+
+func newSessionState() *sessionState {
+	return &sessionState{
+		variables:        make(map[string]float64),
+		complexVariables: make(map[string]complex128),
+		functions:        make(map[string]*userFunction),
+	}
+}
+
+// snapshotVariables returns a copy of the variables that is safe to read without holding the lock
+func (st *sessionState) snapshotVariables() map[string]float64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return maps.Clone(st.variables)
+}
+
+// snapshotComplexVariables returns a copy of all variables, real ones included, as complex values
+func (st *sessionState) snapshotComplexVariables() map[string]complex128 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	vars := make(map[string]complex128, len(st.variables)+len(st.complexVariables))
+	maps.Copy(vars, st.complexVariables)
+	for name, v := range st.variables {
+		vars[name] = complex(v, 0)
+	}
+	return vars
+}
+
+// clone returns an independent copy of the state, for evaluations whose assignments and
+// definitions must not reach the session
+func (st *sessionState) clone() *sessionState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return &sessionState{
+		variables:        maps.Clone(st.variables),
+		complexVariables: maps.Clone(st.complexVariables),
+		functions:        maps.Clone(st.functions),
+	}
+}
+
+// setVariable stores a variable value
+func (st *sessionState) setVariable(name string, value float64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.complexVariables, name)
+	st.variables[name] = value
+}
+
+// setComplexVariable stores a complex variable value, as a real variable if it has no imaginary part
+func (st *sessionState) setComplexVariable(name string, value complex128) {
+	if imag(value) == 0 {
+		st.setVariable(name, real(value))
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.variables, name)
+	st.complexVariables[name] = value
+}
+
+// deleteVariable removes a single variable, reporting whether it existed
+func (st *sessionState) deleteVariable(name string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, isReal := st.variables[name]
+	_, isComplex := st.complexVariables[name]
+	delete(st.variables, name)
+	delete(st.complexVariables, name)
+	return isReal || isComplex
+}
+
+// clearVariables removes all variables, returning how many were removed
+func (st *sessionState) clearVariables() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := len(st.variables) + len(st.complexVariables)
+	clear(st.variables)
+	clear(st.complexVariables)
+	return n
+}
+
+// snapshotFunctions returns a copy of the user-defined functions. Definitions are immutable once
+// stored, so the copy may share them.
+func (st *sessionState) snapshotFunctions() map[string]*userFunction {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return maps.Clone(st.functions)
+}
+
+// setFunction stores a user-defined function, replacing any previous definition of the same name
+func (st *sessionState) setFunction(fn *userFunction) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.functions[fn.name] = fn
+}
+
+// deleteFunction removes a single function, reporting whether it existed
+func (st *sessionState) deleteFunction(name string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, ok := st.functions[name]
+	delete(st.functions, name)
+	return ok
+}
+
+// clearFunctions removes all functions, returning how many were removed
+func (st *sessionState) clearFunctions() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := len(st.functions)
+	clear(st.functions)
+	return n
+}
+
+// sessionStore maps live MCP sessions to their calculator state
+type sessionStore struct {
+	mu     sync.Mutex
+	states map[*mcp.ServerSession]*sessionState
+}
+
+var sessions = &sessionStore{states: make(map[*mcp.ServerSession]*sessionState)}
+
+// get returns the state for ss, creating it on first use. The state is discarded once the
+// session closes, which for streamable-http includes expiry after SessionTimeout.
+// A nil session (e.g. a direct handler call) gets fresh state that is not retained.
+func (s *sessionStore) get(ss *mcp.ServerSession) *sessionState {
+	if ss == nil {
+		return newSessionState()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.states[ss]; ok {
+		return st
+	}
+	st := newSessionState()
+	s.states[ss] = st
+
+	go func() {
+		_ = ss.Wait()
+		s.remove(ss)
+	}()
+
+	return st
+}
+
+func (s *sessionStore) remove(ss *mcp.ServerSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, ss)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectTestClient connects an in-memory client to a fresh calculator server
+func connectTestClient(t *testing.T) (*mcp.ClientSession, *mcp.ServerSession) {
+	t.Helper()
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+
+	ss, err := createMCPServer().Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("server connect failed: %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	cs, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = cs.Close() })
+	return cs, ss
+}
+
+// callTool calls a tool and decodes its structured output into out (which may be nil)
+func callTool(t *testing.T, cs *mcp.ClientSession, name string, args map[string]any, out any) *mcp.CallToolResult {
+	t.Helper()
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("tool %s failed: %v", name, err)
+	}
+	if out != nil && res.StructuredContent != nil {
+		data, _ := json.Marshal(res.StructuredContent)
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("decoding %s output: %v", name, err)
+		}
+	}
+	return res
+}
+
+// resultText returns the first text content of a tool result
+func resultText(res *mcp.CallToolResult) string {
+	if len(res.Content) == 0 {
+		return ""
+	}
+	if tc, ok := res.Content[0].(*mcp.TextContent); ok {
+		return tc.Text
+	}
+	return ""
+}
+
+func TestEvaluateStatement(t *testing.T) {
+	vars := map[string]float64{"x": 3.5}
+	tests := []struct {
+		expr     string
+		assigned string
+		expected float64
+		wantErr  string
+	}{
+		{"x*2", "", 7, ""},
+		{"y = x*2", "y", 7, ""},
+		{"y=x", "y", 3.5, ""},
+		{"pi = 3", "", 0, "cannot assign to constant 'pi'"},
+		{"sqrt = 3", "", 0, "cannot assign to function 'sqrt'"},
+		{"ans = 1", "", 0, "cannot assign to 'ans'"},
+		{"y = ", "", 0, "missing value in assignment to 'y'"},
+		{"2 = 3", "", 0, "unexpected '='"},
+		{"y = x = 3", "", 0, "unexpected '='"},
+		{"z + 1", "", 0, "unknown variable or constant 'z'"},
+		{"xx", "", 0, "(did you mean 'x'?)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			assigned, result, err := evaluateStatement(tt.expr, vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if assigned != tt.assigned || result != tt.expected {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.assigned, tt.expected, assigned, result)
+			}
+		})
+	}
+}
+
+func TestSessionVariables(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out struct {
+		Result string `json:"result"`
+	}
+	callTool(t, cs, "calculate", map[string]any{"expression": "x = 1/3"}, &out)
+	if out.Result != "Assigned: x = 0.3333333333" {
+		t.Errorf("unexpected assignment result: %q", out.Result)
+	}
+
+	// x keeps full precision rather than the formatted 10 significant digits
+	callTool(t, cs, "calculate", map[string]any{"expression": "x*3"}, &out)
+	if out.Result != "Result: x*3 = 1" {
+		t.Errorf("unexpected result: %q", out.Result)
+	}
+
+	callTool(t, cs, "calculate", map[string]any{"expression": "ans + 1"}, &out)
+	if out.Result != "Result: ans + 1 = 2" {
+		t.Errorf("unexpected ans result: %q", out.Result)
+	}
+
+	var vars struct {
+		Variables map[string]float64 `json:"variables"`
+	}
+	callTool(t, cs, "variables", nil, &vars)
+	if len(vars.Variables) != 2 || vars.Variables["ans"] != 2 {
+		t.Errorf("unexpected variables: %v", vars.Variables)
+	}
+
+	callTool(t, cs, "variables", map[string]any{"action": "clear", "name": "x"}, nil)
+	res := callTool(t, cs, "calculate", map[string]any{"expression": "x"}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "unknown variable or constant 'x'") {
+		t.Errorf("expected cleared variable to be unknown, got %q", resultText(res))
+	}
+
+	res = callTool(t, cs, "variables", map[string]any{"action": "clear", "name": "x"}, nil)
+	if !res.IsError {
+		t.Errorf("expected error clearing an undefined variable")
+	}
+
+	callTool(t, cs, "variables", map[string]any{"action": "clear"}, nil)
+	vars.Variables = nil
+	callTool(t, cs, "variables", map[string]any{"action": "list"}, &vars)
+	if len(vars.Variables) != 0 {
+		t.Errorf("expected no variables after clear, got %v", vars.Variables)
+	}
+}
+
+func TestSessionVariablesAreIsolated(t *testing.T) {
+	cs1, _ := connectTestClient(t)
+	cs2, _ := connectTestClient(t)
+
+	callTool(t, cs1, "calculate", map[string]any{"expression": "x = 5"}, nil)
+	res := callTool(t, cs2, "calculate", map[string]any{"expression": "x"}, nil)
+	if !res.IsError {
+		t.Errorf("variable leaked between sessions: %q", resultText(res))
+	}
+}
+
+func TestSessionStateCleanup(t *testing.T) {
+	cs, ss := connectTestClient(t)
+	callTool(t, cs, "calculate", map[string]any{"expression": "x = 5"}, nil)
+
+	sessions.mu.Lock()
+	_, ok := sessions.states[ss]
+	sessions.mu.Unlock()
+	if !ok {
+		t.Fatalf("expected state for the session")
+	}
+
+	_ = cs.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		sessions.mu.Lock()
+		_, ok = sessions.states[ss]
+		sessions.mu.Unlock()
+		if !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("session state was not removed after the session closed")
+}
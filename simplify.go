@@ -0,0 +1,821 @@
+package main
+
+import (
+	"cmp"
+	"hash/fnv"
+	"maps"
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Limits on how far expand multiplies out products and powers of sums
+const (
+	maxExpandTerms = 500
+	maxExpandPower = 20
+)
+
+// maxFoldPower bounds integer powers of coefficients, so that 10^100000 is left unevaluated
+const maxFoldPower = 1024
+
+// poly is an expression in canonical form: a sum of terms with like terms combined, ordered by
+// descending degree with the constant term last
+type poly []term
+
+// term is a rational coefficient times a product of powers ordered by base
+type term struct {
+	coef    *big.Rat
+	factors []power
+}
+
+// power is base^exponent. The base is anything that is not a product or a power: a variable, a
+// constant, a call, a sum with its common numeric factor removed or an operator the algebra does
+// not look into such as a comparison. key is the printed base and identifies like factors.
+type power struct {
+	base     node
+	key      string
+	exponent poly
+}
+
+// rewriter puts expressions into canonical form. With expand set, products and positive integer
+// powers of sums are multiplied out; otherwise they are kept as factors and the result is
+// factored when that is shorter. funcs holds the session's functions, used to fold calls with
+// constant arguments.
+type rewriter struct {
+	expand bool
+	funcs  map[string]*userFunction
+}
+
+// simplifyNode combines like terms, folds constants and factors out common terms
+func simplifyNode(n node, funcs map[string]*userFunction) (node, error) {
+	return (&rewriter{funcs: funcs}).rewrite(n)
+}
+
+// expandNode multiplies out products and powers of sums and combines like terms
+func expandNode(n node, funcs map[string]*userFunction) (node, error) {
+	return (&rewriter{expand: true, funcs: funcs}).rewrite(n)
+}
+
+func (rw *rewriter) rewrite(n node) (node, error) {
+	p, err := rw.canon(n)
+	if err != nil {
+		return nil, err
+	}
+	out := p.node()
+	if !rw.expand {
+		if f, ok := p.factored(); ok && len(formatNode(f)) < len(formatNode(out)) {
+			out = f
+		}
+	}
+	return out, nil
+}
+
+// canon converts n into canonical form
+func (rw *rewriter) canon(n node) (poly, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return constPoly(literalRat(n)), nil
+
+	case *identNode:
+		return atomPoly(n), nil
+
+	case *unaryNode:
+		if n.op == "not" {
+			return rw.opaque(n)
+		}
+		p, err := rw.canon(n.operand)
+		if err != nil || n.op == "+" {
+			return p, err
+		}
+		return p.scale(big.NewRat(-1, 1)), nil
+
+	case *percentNode:
+		p, err := rw.canon(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		return p.scale(big.NewRat(1, 100)), nil
+
+	case *binaryNode:
+		if isLogicalOperator(n.op) || n.op == "//" || n.op == "%" {
+			return rw.opaque(n)
+		}
+		if relativePercent(n) {
+			// a + b% = a * (1 + b/100)
+			pct := n.right.(*percentNode)
+			factor := &binaryNode{op: n.op, left: literal(1), right: &binaryNode{op: "/", left: pct.operand, right: literal(100)}}
+			return rw.canon(&binaryNode{op: "*", left: n.left, right: factor})
+		}
+		a, err := rw.canon(n.left)
+		if err != nil {
+			return nil, err
+		}
+		b, err := rw.canon(n.right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "+":
+			return add(a, b), nil
+		case "-":
+			return add(a, b.scale(big.NewRat(-1, 1))), nil
+		case "*":
+			p, ok := rw.mul(a, b)
+			if !ok {
+				return nil, tooManyTerms(n)
+			}
+			return p, nil
+		case "/":
+			if len(b) == 0 {
+				return nil, nodeError(errKindDivisionByZero, n.right, "%v", errDivisionByZero)
+			}
+			if q, ok := divideExact(a, b); ok {
+				return q, nil
+			}
+			p, _ := rw.mul(a, poly{b.asFactor().invert()})
+			return p, nil
+		case "^":
+			return rw.pow(a, b, n)
+		}
+	}
+	return rw.opaque(n)
+}
+
+// opaque rewrites the operands of a node the algebra does not look into and treats the node as
+// a single factor. Calls, factorials and the like whose operands are constant are folded when
+// their value is a whole number, so sqrt(16) becomes 4 while sqrt(2) stays.
+func (rw *rewriter) opaque(n node) (poly, error) {
+	var err error
+	rewrite := func(n node) node {
+		if err != nil {
+			return n
+		}
+		var out node
+		out, err = rw.rewrite(n)
+		return out
+	}
+
+	switch m := n.(type) {
+	case *unaryNode:
+		n = &unaryNode{op: m.op, operand: rewrite(m.operand)}
+	case *binaryNode:
+		n = &binaryNode{op: m.op, left: rewrite(m.left), right: rewrite(m.right)}
+	case *factorialNode:
+		n = &factorialNode{operand: rewrite(m.operand), double: m.double}
+	case *conditionalNode:
+		n = &conditionalNode{cond: rewrite(m.cond), then: rewrite(m.then), otherwise: rewrite(m.otherwise)}
+	case *callNode:
+		args := make([]node, len(m.args))
+		for i, arg := range m.args {
+			args[i] = rewrite(arg)
+		}
+		n = &callNode{name: m.name, args: args}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !isBoolean(n) {
+		if v, err := (&evaluator{funcs: rw.funcs}).eval(n); err == nil && isInteger(v) {
+			return constPoly(new(big.Rat).SetFloat64(v)), nil
+		}
+	}
+	// sqrt(u) is u^(1/2), so that sqrt(x)*sqrt(x) = x and sqrt(x)/x = 1/sqrt(x)
+	if call, ok := n.(*callNode); ok && call.name == "sqrt" && len(call.args) == 1 {
+		base, err := rw.canon(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return rw.pow(base, constPoly(big.NewRat(1, 2)), nil)
+	}
+	return atomPoly(n), nil
+}
+
+// mul multiplies two canonical forms, distributing over sums when expanding or when one side is
+// a single term. It returns false when the product would have more than maxExpandTerms terms.
+func (rw *rewriter) mul(a, b poly) (poly, bool) {
+	if len(a) > 1 && len(b) > 1 && !rw.expand {
+		return poly{mulTerms(a.asFactor(), b.asFactor())}.collect(), true
+	}
+	if (len(a) == 1 && len(b) > 1 && rw.keepSum(a[0], b)) || (len(b) == 1 && len(a) > 1 && rw.keepSum(b[0], a)) {
+		return poly{mulTerms(a.asFactor(), b.asFactor())}.collect(), true
+	}
+	if len(a)*len(b) > maxExpandTerms {
+		return nil, false
+	}
+	out := make(poly, 0, len(a)*len(b))
+	for _, s := range a {
+		for _, t := range b {
+			out = append(out, mulTerms(s, t))
+		}
+	}
+	return out.collect(), true
+}
+
+// keepSum reports whether t times the sum p is better kept as a product than distributed: when
+// t contains a power of p, as in (x+1)*(x+1)^-2, or when simplifying, any quotient, so that
+// (2*x+2)/(x+1) cancels to 2
+func (rw *rewriter) keepSum(t term, p poly) bool {
+	key := p.asFactor().factors[0].key
+	for _, f := range t.factors {
+		if f.key == key {
+			return true
+		}
+		if e, ok := f.exponent.constant(); !rw.expand && (!ok || e.Sign() < 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooManyTerms reports an expansion of n that exceeds maxExpandTerms
+func tooManyTerms(n node) error {
+	return nodeError(errKindUnsupported, n, "expanding %s gives more than %d terms", formatNode(n), maxExpandTerms)
+}
+
+// pow raises base to exponent; n is the power node, for errors
+func (rw *rewriter) pow(base, exponent poly, n *binaryNode) (poly, error) {
+	if k, ok := exponent.integer(); ok {
+		switch {
+		case k == 0:
+			return constPoly(big.NewRat(1, 1)), nil
+		case len(base) == 0:
+			if k < 0 {
+				return nil, nodeError(errKindDivisionByZero, n, "%v", errDivisionByZero)
+			}
+			return nil, nil
+		case rw.expand && len(base) > 1 && k > 0 && k <= maxExpandPower:
+			out := base
+			for i := 1; i < int(k); i++ {
+				var ok bool
+				if out, ok = rw.mul(out, base); !ok {
+					return nil, tooManyTerms(n)
+				}
+			}
+			return out, nil
+		case rw.expand && len(base) > 1 && k > maxExpandPower:
+			return nil, nodeError(errKindUnsupported, n, "expanding %s needs a power above %d", formatNode(n), maxExpandPower)
+		case k >= -maxFoldPower && k <= maxFoldPower:
+			t := base[0]
+			if len(base) > 1 {
+				t = base.asFactor()
+			}
+			return poly{t.pow(k)}, nil
+		}
+	}
+
+	if c, ok := base.constant(); ok {
+		if e, ok := exponent.constant(); ok {
+			cf, _ := c.Float64()
+			ef, _ := e.Float64()
+			if v := math.Pow(cf, ef); isInteger(v) {
+				return constPoly(new(big.Rat).SetFloat64(v)), nil
+			}
+		}
+	}
+
+	// x^y keeps x as the base, so that it combines with other powers of x
+	if len(base) == 1 && base[0].coef.Cmp(big.NewRat(1, 1)) == 0 && len(base[0].factors) == 1 {
+		if f := base[0].factors[0]; f.exponent.isOne() {
+			return poly{{coef: big.NewRat(1, 1), factors: []power{{base: f.base, key: f.key, exponent: exponent}}}}, nil
+		}
+	}
+	b := base.node()
+	return poly{{coef: big.NewRat(1, 1), factors: []power{{base: b, key: formatNode(b), exponent: exponent}}}}, nil
+}
+
+// divideExact divides a by b when both are polynomials in the same variable and b divides a
+// without remainder, so that (x^2-1)/(x-1) = x+1
+func divideExact(a, b poly) (poly, bool) {
+	key, bc, ok := b.coefficients("")
+	if !ok || len(bc) < 2 {
+		return nil, false
+	}
+	_, ac, ok := a.coefficients(key)
+	if !ok || len(ac) < len(bc) {
+		return nil, false
+	}
+	base := b[0].factors[0].base
+
+	rem := ac
+	quotient := make([]*big.Rat, len(ac)-len(bc)+1)
+	lead := bc[len(bc)-1]
+	for i := len(quotient) - 1; i >= 0; i-- {
+		c := new(big.Rat).Quo(rem[i+len(bc)-1], lead)
+		quotient[i] = c
+		for j, d := range bc {
+			rem[i+j] = new(big.Rat).Sub(rem[i+j], new(big.Rat).Mul(c, d))
+		}
+	}
+	for _, r := range rem {
+		if r.Sign() != 0 {
+			return nil, false
+		}
+	}
+
+	var q poly
+	for k, c := range quotient {
+		if c.Sign() == 0 {
+			continue
+		}
+		t := term{coef: c}
+		if k > 0 {
+			t.factors = []power{{base: base, key: key, exponent: constPoly(big.NewRat(int64(k), 1))}}
+		}
+		q = append(q, t)
+	}
+	return q.collect(), true
+}
+
+// coefficients returns the coefficients of p, indexed by degree, when p is a polynomial in a
+// single variable; key is the variable, or "" to accept any
+func (p poly) coefficients(key string) (string, []*big.Rat, bool) {
+	var coefs []*big.Rat
+	for _, t := range p {
+		k := int64(0)
+		switch len(t.factors) {
+		case 0:
+		case 1:
+			f := t.factors[0]
+			if _, isIdent := f.base.(*identNode); !isIdent || (key != "" && f.key != key) {
+				return "", nil, false
+			}
+			key = f.key
+			var ok bool
+			if k, ok = f.exponent.integer(); !ok || k < 0 || k > maxExpandTerms {
+				return "", nil, false
+			}
+		default:
+			return "", nil, false
+		}
+		for int64(len(coefs)) <= k {
+			coefs = append(coefs, new(big.Rat))
+		}
+		coefs[k] = new(big.Rat).Add(coefs[k], t.coef)
+	}
+	return key, coefs, key != ""
+}
+
+// literalRat returns the exact value of a number literal, so that 0.1 is 1/10
+func literalRat(n *numberNode) *big.Rat {
+	if r, ok := new(big.Rat).SetString(n.text); ok {
+		return r
+	}
+	if r := new(big.Rat).SetFloat64(n.value); r != nil {
+		return r
+	}
+	return new(big.Rat)
+}
+
+func constPoly(r *big.Rat) poly {
+	if r.Sign() == 0 {
+		return nil
+	}
+	return poly{{coef: r}}
+}
+
+func atomPoly(n node) poly {
+	return poly{{coef: big.NewRat(1, 1), factors: []power{{base: n, key: formatNode(n), exponent: constPoly(big.NewRat(1, 1))}}}}
+}
+
+// constant returns the value of a constant form
+func (p poly) constant() (*big.Rat, bool) {
+	switch {
+	case len(p) == 0:
+		return new(big.Rat), true
+	case len(p) == 1 && len(p[0].factors) == 0:
+		return p[0].coef, true
+	}
+	return nil, false
+}
+
+// integer returns the value of a constant whole-number form
+func (p poly) integer() (int64, bool) {
+	c, ok := p.constant()
+	if !ok || !c.IsInt() || !c.Num().IsInt64() {
+		return 0, false
+	}
+	return c.Num().Int64(), true
+}
+
+func (p poly) isOne() bool {
+	k, ok := p.integer()
+	return ok && k == 1
+}
+
+// scale multiplies every coefficient by c
+func (p poly) scale(c *big.Rat) poly {
+	if c.Sign() == 0 {
+		return nil
+	}
+	out := make(poly, len(p))
+	for i, t := range p {
+		out[i] = term{coef: new(big.Rat).Mul(t.coef, c), factors: t.factors}
+	}
+	return out
+}
+
+func add(a, b poly) poly {
+	return append(slices.Clone(a), b...).collect()
+}
+
+// collect combines like terms, drops zero terms and sorts the result
+func (p poly) collect() poly {
+	byKey := make(map[string]int, len(p))
+	out := make(poly, 0, len(p))
+	for _, t := range p {
+		k := t.key()
+		if i, ok := byKey[k]; ok {
+			out[i].coef = new(big.Rat).Add(out[i].coef, t.coef)
+			continue
+		}
+		byKey[k] = len(out)
+		out = append(out, term{coef: new(big.Rat).Set(t.coef), factors: t.factors})
+	}
+	out = slices.DeleteFunc(out, func(t term) bool { return t.coef.Sign() == 0 })
+	slices.SortStableFunc(out, func(s, t term) int {
+		// Constant terms last, then by descending degree and by descending powers of each base
+		// in turn, so (a+b)^2 expands to a^2+2*a*b+b^2
+		if (len(s.factors) == 0) != (len(t.factors) == 0) {
+			if len(s.factors) == 0 {
+				return 1
+			}
+			return -1
+		}
+		if c := cmp.Compare(t.degree(), s.degree()); c != 0 {
+			return c
+		}
+		es, et := s.exponents(), t.exponents()
+		keys := slices.Sorted(maps.Keys(es))
+		for k := range et {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			if c := cmp.Compare(et[k], es[k]); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(s.key(), t.key())
+	})
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// content returns the common numeric factor of the terms, negative when the leading term is
+// negative, so that p / content has coprime integer coefficients and a positive leading term
+func (p poly) content() *big.Rat {
+	num, den := new(big.Int), big.NewInt(1)
+	for _, t := range p {
+		num.GCD(nil, nil, num, new(big.Int).Abs(t.coef.Num()))
+		d := t.coef.Denom()
+		g := new(big.Int).GCD(nil, nil, den, d)
+		den.Mul(den, new(big.Int).Quo(d, g))
+	}
+	c := new(big.Rat).SetFrac(num, den)
+	if len(p) > 0 && p[0].coef.Sign() < 0 {
+		c.Neg(c)
+	}
+	return c
+}
+
+// split writes p as common times rest, where common is the content of p times the powers
+// common to all of its terms, e.g. 6*x^2*y + 9*x*y^2 = 3*x*y * (2*x+3*y)
+func (p poly) split() (common term, rest poly) {
+	common = term{coef: p.content()}
+	for _, f := range p[0].factors {
+		least, ok := f.exponent.constant()
+		if !ok || least.Sign() <= 0 {
+			continue
+		}
+		for _, t := range p[1:] {
+			i := slices.IndexFunc(t.factors, func(g power) bool { return g.key == f.key })
+			if i < 0 {
+				ok = false
+				break
+			}
+			e, isConst := t.factors[i].exponent.constant()
+			if !isConst || e.Sign() <= 0 {
+				ok = false
+				break
+			}
+			if e.Cmp(least) < 0 {
+				least = e
+			}
+		}
+		if ok {
+			common.factors = append(common.factors, power{base: f.base, key: f.key, exponent: constPoly(least)})
+		}
+	}
+
+	inv := common.invert()
+	rest = make(poly, len(p))
+	for i, t := range p {
+		rest[i] = mulTerms(t, inv)
+	}
+	return common, rest.collect()
+}
+
+// asFactor returns p as a single term: p itself if it has one term, otherwise what its terms
+// have in common times the remaining sum as a factor, e.g. 2*x^2 + 4*x becomes 2*x*(x+2)
+func (p poly) asFactor() term {
+	if len(p) == 1 {
+		return p[0]
+	}
+	common, rest := p.split()
+	b := rest.node()
+	return mulTerms(common, term{coef: big.NewRat(1, 1), factors: []power{{base: b, key: formatNode(b), exponent: constPoly(big.NewRat(1, 1))}}})
+}
+
+// factored writes p as what its terms have in common times the remaining sum, e.g.
+// pi*r^2 + 2*pi*r = pi*r*(r+2). It returns false when nothing can be factored out.
+func (p poly) factored() (node, bool) {
+	if len(p) < 2 {
+		return nil, false
+	}
+	common, rest := p.split()
+	if len(common.factors) == 0 && common.coef.Cmp(big.NewRat(1, 1)) == 0 {
+		return nil, false
+	}
+	return symMul(common.node(), rest.node()), true
+}
+
+// mulTerms multiplies two terms, merging powers of the same base
+func mulTerms(s, t term) term {
+	factors := make([]power, 0, len(s.factors)+len(t.factors))
+	factors = append(factors, s.factors...)
+	factors = append(factors, t.factors...)
+	return term{coef: new(big.Rat).Mul(s.coef, t.coef), factors: factors}.normalize()
+}
+
+// normalize sorts the factors, merges powers of the same base, drops factors raised to zero and
+// moves whole-number powers of numbers into the coefficient
+func (t term) normalize() term {
+	slices.SortStableFunc(t.factors, func(a, b power) int {
+		if c := cmp.Compare(factorRank(a.base), factorRank(b.base)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	coef := new(big.Rat).Set(t.coef)
+	var factors []power
+	for _, f := range t.factors {
+		if n := len(factors); n > 0 && factors[n-1].key == f.key {
+			factors[n-1].exponent = add(factors[n-1].exponent, f.exponent)
+			continue
+		}
+		factors = append(factors, f)
+	}
+	factors = slices.DeleteFunc(factors, func(f power) bool {
+		if len(f.exponent) == 0 {
+			return true
+		}
+		num, isNum := f.base.(*numberNode)
+		k, isInt := f.exponent.integer()
+		if isNum && isInt && k >= -maxFoldPower && k <= maxFoldPower && num.value != 0 {
+			coef.Mul(coef, ratPow(literalRat(num), k))
+			return true
+		}
+		return false
+	})
+	return term{coef: coef, factors: factors}
+}
+
+// factorRank orders the factors of a term: numbers, then variables, then calls and other
+// operators, then sums, so that terms print as 2*x^2*sin(x)*(x+1)
+func factorRank(n node) int {
+	switch n := n.(type) {
+	case *numberNode:
+		return 0
+	case *identNode:
+		return 1
+	case *binaryNode:
+		if n.op == "+" || n.op == "-" {
+			return 3
+		}
+	}
+	return 2
+}
+
+// invert returns 1/t
+func (t term) invert() term {
+	factors := make([]power, len(t.factors))
+	for i, f := range t.factors {
+		factors[i] = power{base: f.base, key: f.key, exponent: f.exponent.scale(big.NewRat(-1, 1))}
+	}
+	return term{coef: new(big.Rat).Inv(t.coef), factors: factors}
+}
+
+// pow returns t^k
+func (t term) pow(k int64) term {
+	factors := make([]power, len(t.factors))
+	for i, f := range t.factors {
+		factors[i] = power{base: f.base, key: f.key, exponent: f.exponent.scale(big.NewRat(k, 1))}
+	}
+	return term{coef: ratPow(t.coef, k), factors: factors}.normalize()
+}
+
+// ratPow returns r^k for a non-zero r
+func ratPow(r *big.Rat, k int64) *big.Rat {
+	abs := big.NewInt(k)
+	abs.Abs(abs)
+	num := new(big.Int).Exp(r.Num(), abs, nil)
+	den := new(big.Int).Exp(r.Denom(), abs, nil)
+	if k < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// key identifies terms that differ only in their coefficient
+func (t term) key() string {
+	parts := make([]string, len(t.factors))
+	for i, f := range t.factors {
+		parts[i] = f.key + "^" + formatNode(f.exponent.node())
+	}
+	return strings.Join(parts, "*")
+}
+
+// exponents maps the base of each factor with a numeric exponent to that exponent
+func (t term) exponents() map[string]float64 {
+	m := make(map[string]float64, len(t.factors))
+	for _, f := range t.factors {
+		if e, ok := f.exponent.constant(); ok {
+			m[f.key], _ = e.Float64()
+		}
+	}
+	return m
+}
+
+// degree is the sum of the numeric exponents of the factors
+func (t term) degree() float64 {
+	d := 0.0
+	for _, f := range t.factors {
+		if e, ok := f.exponent.constant(); ok {
+			v, _ := e.Float64()
+			d += v
+		}
+	}
+	return d
+}
+
+// node prints the canonical form, writing negative terms after the first with '-'
+func (p poly) node() node {
+	if len(p) == 0 {
+		return literal(0)
+	}
+	// A difference leads with its positive term: 1-x rather than -x+1
+	if len(p) == 2 && p[0].coef.Sign() < 0 && p[1].coef.Sign() > 0 {
+		p = poly{p[1], p[0]}
+	}
+	out := p[0].node()
+	for _, t := range p[1:] {
+		if t.coef.Sign() < 0 {
+			neg := term{coef: new(big.Rat).Neg(t.coef), factors: t.factors}
+			out = &binaryNode{op: "-", left: out, right: neg.node()}
+		} else {
+			out = &binaryNode{op: "+", left: out, right: t.node()}
+		}
+	}
+	return out
+}
+
+// node prints the term as coefficient*numerator/denominator. Coefficients are fractions such
+// as x/3, except that decimal fractions stay decimals (0.3*x).
+func (t term) node() node {
+	// A negative coefficient is absorbed by a sum factor: -(x-1)/y prints as (1-x)/y
+	if t.coef.Sign() < 0 {
+		for i, f := range t.factors {
+			if factorRank(f.base) == 3 && f.exponent.isOne() {
+				if sum, err := (&rewriter{}).canon(f.base); err == nil {
+					b := sum.scale(big.NewRat(-1, 1)).node()
+					factors := slices.Clone(t.factors)
+					factors[i] = power{base: b, key: formatNode(b), exponent: f.exponent}
+					return term{coef: new(big.Rat).Neg(t.coef), factors: factors}.node()
+				}
+			}
+		}
+	}
+	p := &product{num: 1, den: 1}
+	n, d := t.coef.Num(), t.coef.Denom()
+	if n.IsInt64() && d.IsInt64() && isInteger(float64(n.Int64())) && isInteger(float64(d.Int64())) && !isPowerOfTen(d) {
+		p.num, p.den = float64(n.Int64()), float64(d.Int64())
+	} else {
+		p.num, _ = t.coef.Float64()
+		// Print a decimal coefficient in full, so that 1 - 1e-12 does not print as 1
+		text := strconv.FormatFloat(p.num, 'g', -1, 64)
+		if r, ok := new(big.Rat).SetString(text); ok && r.Cmp(t.coef) == 0 && text != formatResult(p.num) {
+			p.text = text
+		}
+	}
+	half := big.NewRat(1, 2)
+	for _, f := range t.factors {
+		// Square roots are printed as sqrt: x^(1/2) as sqrt(x) and x^(-1/2) as 1/sqrt(x)
+		if e, ok := f.exponent.constant(); ok && new(big.Rat).Abs(e).Cmp(half) == 0 {
+			p.factors = append(p.factors, factor{base: symCall("sqrt", f.base), exponent: literal(float64(e.Sign()))})
+			continue
+		}
+		p.factors = append(p.factors, factor{base: f.base, exponent: f.exponent.exponentNode()})
+	}
+	return p.node()
+}
+
+// exponentNode prints an exponent, using a decimal for a constant with a short terminating
+// expansion: x^0.5 rather than x^(1/2)
+func (p poly) exponentNode() node {
+	if c, ok := p.constant(); ok && !c.IsInt() {
+		if r, ok := new(big.Rat).SetString(c.FloatString(6)); ok && r.Cmp(c) == 0 {
+			v, _ := c.Float64()
+			return literal(v)
+		}
+	}
+	return p.node()
+}
+
+func isPowerOfTen(d *big.Int) bool {
+	if d.Cmp(big.NewInt(1)) == 0 {
+		return false
+	}
+	ten := big.NewInt(10)
+	q, m := new(big.Int).Set(d), new(big.Int)
+	for q.Cmp(big.NewInt(1)) > 0 {
+		q.QuoRem(q, ten, m)
+		if m.Sign() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sampleCheck is the value of an expression and its rewritten form at one sample point
+type sampleCheck struct {
+	Point     map[string]float64 `json:"point"`
+	Original  float64            `json:"original"`
+	Rewritten float64            `json:"rewritten"`
+	Error     string             `json:"error,omitempty" jsonschema:"Set when the rewritten form could not be evaluated at the point"`
+}
+
+// Sample points for equivalence checks are drawn from [-sampleRange, sampleRange]
+const (
+	sampleChecks   = 5
+	sampleAttempts = 200
+	sampleRange    = 5.0
+)
+
+// checkEquivalence evaluates original and rewritten at random values of their variables and
+// reports whether they agree at every point where original is defined. Named constants keep
+// their values. The points are drawn from a generator seeded by the expression, so the same
+// expression is always checked at the same points.
+func checkEquivalence(original, rewritten node, funcs map[string]*userFunction) ([]sampleCheck, bool) {
+	var names []string
+	for _, n := range []node{original, rewritten} {
+		walk(n, func(n node) {
+			id, ok := n.(*identNode)
+			if !ok {
+				return
+			}
+			if _, isConst := mathConstants[id.name]; !isConst && !slices.Contains(names, id.name) {
+				names = append(names, id.name)
+			}
+		})
+	}
+	slices.Sort(names)
+
+	h := fnv.New64a()
+	h.Write([]byte(formatNode(original)))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+
+	var checks []sampleCheck
+	for attempt := 0; attempt < sampleAttempts && len(checks) < sampleChecks; attempt++ {
+		point := make(map[string]float64, len(names))
+		for _, name := range names {
+			// Round to 3 decimals so the points are easy to read and re-check
+			point[name] = math.Round((rng.Float64()*2-1)*sampleRange*1000) / 1000
+		}
+		ev := &evaluator{vars: point, funcs: funcs}
+		want, err := ev.eval(original)
+		if err != nil || math.IsNaN(want) || math.IsInf(want, 0) {
+			continue
+		}
+		check := sampleCheck{Point: point, Original: want}
+		got, err := ev.eval(rewritten)
+		if err != nil {
+			check.Error = err.Error()
+			return append(checks, check), false
+		}
+		check.Rewritten = got
+		if !(math.Abs(got-want) <= 1e-9*math.Max(1, math.Max(math.Abs(got), math.Abs(want)))) {
+			return append(checks, check), false
+		}
+		checks = append(checks, check)
+		if len(names) == 0 {
+			break
+		}
+	}
+	return checks, len(checks) > 0
+}
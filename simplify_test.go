@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"2x + 3x - x", "4*x"},
+		{"x*x*x", "x^3"},
+		{"0.1 + 0.2", "0.3"},
+		{"x/2 + x/3", "5*x/6"},
+		{"3*(x+2) + 2*(x+4)", "5*x+14"},
+		{"x - 1 + (x + 1)", "2*x"},
+		{"a*b + b*a", "2*a*b"},
+		{"sqrt(16) + sqrt(2)", "sqrt(2)+4"},
+		{"sqrt(x)*sqrt(x)", "x"},
+		{"x/sqrt(x)", "sqrt(x)"},
+		{"e^x*e^(2x)", "e^(3*x)"},
+		{"x^2/x", "x"},
+		{"(x^2 - 1)/(x - 1)", "x+1"},
+		{"(2x + 2)/(x + 1)", "2"},
+		{"(x+1)*(x+2)/(x+1)", "x+2"},
+		{"1/(x+1) + 2/(x+1)", "3/(x+1)"},
+		{"(1-x)*(1-x)", "(x-1)^2"},
+		{"-(x - 1)", "1-x"},
+		{"pi*r^2 + 2*pi*r", "pi*r*(r+2)"},
+		{"(x^2+x)*(x+1)", "x*(x+1)^2"},
+		{"x > 0 ? 2*x + x : 0", "x > 0 ? 3*x : 0"},
+		{"200 + 15%", "230"},
+		{"5!", "120"},
+		{"(x+1)^100", "(x+1)^100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := parseExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := simplifyNode(n, nil)
+			if err != nil {
+				t.Fatalf("simplify: %v", err)
+			}
+			if formatNode(got) != tt.want {
+				t.Errorf("simplify %s = %s, want %s", tt.expr, formatNode(got), tt.want)
+			}
+			if _, ok := checkEquivalence(n, got, nil); !ok {
+				t.Errorf("simplify %s = %s is not equivalent", tt.expr, formatNode(got))
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"(x+1)^2", "x^2+2*x+1"},
+		{"(x+1)*(x-1)", "x^2-1"},
+		{"(a+b)^3", "a^3+3*a^2*b+3*a*b^2+b^3"},
+		{"(x+y)^2 - (x-y)^2", "4*x*y"},
+		{"(2x+4)*(x+1)", "2*x^2+6*x+4"},
+		{"x*(y+z) - x*y", "x*z"},
+		{"pi*r*(r+2)", "pi*r^2+2*pi*r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			n, err := parseExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := expandNode(n, nil)
+			if err != nil {
+				t.Fatalf("expand: %v", err)
+			}
+			if formatNode(got) != tt.want {
+				t.Errorf("expand %s = %s, want %s", tt.expr, formatNode(got), tt.want)
+			}
+			if _, ok := checkEquivalence(n, got, nil); !ok {
+				t.Errorf("expand %s = %s is not equivalent", tt.expr, formatNode(got))
+			}
+		})
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	for _, tt := range []struct {
+		expr string
+		kind exprErrorKind
+	}{
+		{"x/0", errKindDivisionByZero},
+		{"(x+1)/(y-y)", errKindDivisionByZero},
+		{"(a+b+c+d+e1+f+g+h)^20", errKindUnsupported},
+		{"(x+1)^50", errKindUnsupported},
+		{"(a+b+c+d+e1)^30", errKindUnsupported},
+	} {
+		n, err := parseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.expr, err)
+		}
+		_, err = expandNode(n, nil)
+		if e := asExprError(err, errKindSyntax); err == nil || e.Kind != tt.kind {
+			t.Errorf("expand %s: got %v, want a %s error", tt.expr, err, tt.kind)
+		}
+	}
+}
+
+func TestCheckEquivalence(t *testing.T) {
+	original, _ := parseExpression("(x+1)^2")
+	wrong, _ := parseExpression("x^2+1")
+	if _, ok := checkEquivalence(original, wrong, nil); ok {
+		t.Errorf("expected (x+1)^2 and x^2+1 to differ")
+	}
+
+	// Points where the original is undefined are skipped
+	original, _ = parseExpression("sqrt(x)^2")
+	same, _ := parseExpression("x")
+	checks, ok := checkEquivalence(original, same, nil)
+	if !ok || len(checks) != sampleChecks {
+		t.Errorf("expected %d passing checks, got %v %v", sampleChecks, checks, ok)
+	}
+	for _, c := range checks {
+		if c.Point["x"] < 0 {
+			t.Errorf("sample point %v is outside the domain of sqrt", c.Point)
+		}
+	}
+}
+
+func TestSimplifyAndExpandTools(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out rewriteOutput
+	callTool(t, cs, "simplify", map[string]any{"expression": "2x + 3x - x"}, &out)
+	if out.Expression != "4*x" || !out.Verified || len(out.Checks) != sampleChecks {
+		t.Errorf("unexpected simplify output: %+v", out)
+	}
+
+	out = rewriteOutput{}
+	callTool(t, cs, "expand", map[string]any{"expression": "(x+1)^2"}, &out)
+	if out.Expression != "x^2+2*x+1" || !out.Verified || !strings.Contains(out.Result, "Verified numerically") {
+		t.Errorf("unexpected expand output: %+v", out)
+	}
+
+	// Constant expressions are checked at a single point
+	out = rewriteOutput{}
+	callTool(t, cs, "simplify", map[string]any{"expression": "2^10 - 24"}, &out)
+	if out.Expression != "1000" || len(out.Checks) != 1 {
+		t.Errorf("unexpected simplify output: %+v", out)
+	}
+
+	res := callTool(t, cs, "simplify", map[string]any{"expression": "2 +"}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "Simplify error") {
+		t.Errorf("expected a syntax error, got %q", resultText(res))
+	}
+}
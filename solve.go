@@ -0,0 +1,387 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"math/big"
+	"slices"
+)
+
+// Limits of the numeric root search
+const (
+	solveSamples    = 1000 // subintervals scanned for sign changes
+	maxSolveRoots   = 100
+	maxBrentSteps   = 100
+	maxNewtonSteps  = 100
+	refineSteps     = 3 // Newton steps polishing a root found by Brent's method
+	defaultSolveMin = -10.0
+	defaultSolveMax = 10.0
+)
+
+// solveRoot is a real root of an equation with how it was found
+type solveRoot struct {
+	Value      float64 `json:"value"`
+	Exact      string  `json:"exact,omitempty" jsonschema:"The root in closed form for linear and quadratic equations, e.g. 1/3 or 1-sqrt(2)"`
+	Residual   float64 `json:"residual" jsonschema:"lhs - rhs evaluated at the root"`
+	Method     string  `json:"method" jsonschema:"linear or quadratic for a closed form; brent for a sign change bracketed with Brent's method and polished with Newton steps; newton for a root where the sign does not change; sample when a scanned point is an exact root"`
+	Iterations int     `json:"iterations" jsonschema:"Iterations of the numeric method"`
+	Converged  bool    `json:"converged" jsonschema:"Whether the numeric method reached full float64 precision"`
+}
+
+// parseEquation parses "lhs = rhs" or "lhs == rhs" into the expression lhs - rhs, whose roots
+// solve the equation. A plain expression is taken to equal zero.
+func parseEquation(expr string) (node, error) {
+	tokens, err := tokenize(expr, syntaxStandard)
+	if err != nil {
+		return nil, err
+	}
+	eq := slices.IndexFunc(tokens, func(t token) bool { return t.kind == tokenOperator && t.text == "=" })
+
+	var lhs, rhs node
+	if eq < 0 {
+		n, err := parseExpression(expr)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := n.(*binaryNode); ok && b.op == "==" {
+			lhs, rhs = b.left, b.right
+		} else {
+			lhs, rhs = n, literal(0)
+		}
+	} else {
+		sign := tokens[eq]
+		if again := slices.IndexFunc(tokens[eq+1:], func(t token) bool { return t.kind == tokenOperator && t.text == "=" }); again >= 0 {
+			return nil, tokenError(errKindSyntax, tokens[eq+1+again], "an equation has a single '=', found another at position %d", tokens[eq+1+again].pos)
+		}
+		if eq == 0 {
+			return nil, tokenError(errKindSyntax, sign, "missing left side of the equation").withExpected(expectedOperand...)
+		}
+		if tokens[eq+1].kind == tokenEOF {
+			return nil, tokenError(errKindSyntax, tokens[eq+1], "missing right side of the equation").withExpected(expectedOperand...)
+		}
+		left := append(slices.Clone(tokens[:eq]), token{kind: tokenEOF, pos: sign.pos})
+		if lhs, err = (&parser{tokens: left}).parseExpression(); err != nil {
+			return nil, err
+		}
+		if rhs, err = (&parser{tokens: tokens[eq+1:]}).parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, side := range []node{lhs, rhs} {
+		if isBoolean(side) {
+			return nil, nodeError(errKindUnsupported, side, "%s is a condition, not a number; write the equation as lhs = rhs", formatNode(side))
+		}
+	}
+	if isNumber(rhs, 0) {
+		return lhs, nil
+	}
+	return &binaryNode{op: "-", left: lhs, right: rhs}, nil
+}
+
+// closedForm solves f = 0 exactly when f is a polynomial in x of degree at most 2 with rational
+// coefficients, returning the real roots in ascending order. degree is -1 when f is identically
+// zero, so that every x is a solution, and 0 when f is a non-zero constant.
+func closedForm(f node, x string, funcs map[string]*userFunction) (roots []node, degree int, ok bool) {
+	p, err := (&rewriter{expand: true, funcs: funcs}).canon(f)
+	if err != nil {
+		return nil, 0, false
+	}
+	if c, isConst := p.constant(); isConst {
+		if c.Sign() == 0 {
+			return nil, -1, true
+		}
+		return nil, 0, true
+	}
+	_, coefs, ok := p.coefficients(x)
+	if !ok || len(coefs) > 3 {
+		return nil, 0, false
+	}
+
+	ratNode := func(r *big.Rat) node { return constPoly(r).node() }
+	if len(coefs) == 2 {
+		// a*x + b = 0
+		return []node{ratNode(new(big.Rat).Neg(new(big.Rat).Quo(coefs[0], coefs[1])))}, 1, true
+	}
+
+	// a*x^2 + b*x + c = 0: x = -b/(2a) ± sqrt(b^2 - 4ac)/(2|a|)
+	c, b, a := coefs[0], coefs[1], coefs[2]
+	twoA := new(big.Rat).Mul(big.NewRat(2, 1), a)
+	disc := new(big.Rat).Sub(new(big.Rat).Mul(b, b), new(big.Rat).Mul(big.NewRat(4, 1), new(big.Rat).Mul(a, c)))
+	vertex := new(big.Rat).Neg(new(big.Rat).Quo(b, twoA))
+	switch disc.Sign() {
+	case -1:
+		return nil, 2, true
+	case 0:
+		return []node{ratNode(vertex)}, 2, true
+	}
+
+	// sqrt(n/d) = kn*sqrt(mn)/(kd*sqrt(md)) = kn*sqrt(mn*md)/(kd*md) with mn*md square-free, since
+	// n and d are coprime
+	var offset node
+	kn, mn, okNum := squareFree(disc.Num())
+	kd, md, okDen := squareFree(disc.Denom())
+	m := new(big.Int).Mul(big.NewInt(mn), big.NewInt(md))
+	if okNum && okDen && m.IsInt64() && float64(m.Int64()) <= maxExactFloatInt {
+		scale := new(big.Rat).SetFrac(kn, new(big.Int).Mul(kd, big.NewInt(md)))
+		scale.Quo(scale, twoA).Abs(scale)
+		if m.Int64() == 1 {
+			return []node{ratNode(new(big.Rat).Sub(vertex, scale)), ratNode(new(big.Rat).Add(vertex, scale))}, 2, true
+		}
+		offset = symMul(ratNode(scale), symCall("sqrt", literal(float64(m.Int64()))))
+	} else {
+		// Too large to factor: the discriminant stays under the root
+		offset = symMul(ratNode(new(big.Rat).Abs(new(big.Rat).Inv(twoA))), symCall("sqrt", ratNode(disc)))
+	}
+	root := func(op string) node {
+		n := &binaryNode{op: op, left: ratNode(vertex), right: offset}
+		if s, err := simplifyNode(n, nil); err == nil {
+			return s
+		}
+		return n
+	}
+	return []node{root("-"), root("+")}, 2, true
+}
+
+// squareFree writes n as k^2*m with m square-free. A perfect square of any size gives m = 1;
+// otherwise it gives up when n would not be exact as a float64.
+func squareFree(n *big.Int) (k *big.Int, m int64, ok bool) {
+	if r := new(big.Int).Sqrt(n); new(big.Int).Mul(r, r).Cmp(n) == 0 {
+		return r, 1, true
+	}
+	if !n.IsInt64() || float64(n.Int64()) > maxExactFloatInt {
+		return nil, 0, false
+	}
+	rest, outside := n.Int64(), int64(1)
+	for p := int64(2); p*p <= rest; p++ {
+		for rest%(p*p) == 0 {
+			rest /= p * p
+			outside *= p
+		}
+	}
+	return big.NewInt(outside), rest, true
+}
+
+// solver finds the real roots of f with respect to x numerically. df is the derivative of f, or
+// nil when f could not be differentiated, in which case no Newton steps are taken.
+type solver struct {
+	boundEvaluator
+	f, df node
+}
+
+// eval evaluates n at x. Points where n is undefined, such as ln(x) for x <= 0, give NaN;
+// other errors such as unknown identifiers are returned.
+func (s *solver) eval(n node, x float64) (float64, error) {
+	v, err := s.boundEvaluator.eval(n, x)
+	if err != nil {
+		switch asExprError(err, errKindSyntax).Kind {
+		case errKindDomain, errKindDivisionByZero:
+			return math.NaN(), nil
+		}
+		return 0, err
+	}
+	if math.IsInf(v, 0) {
+		return math.NaN(), nil
+	}
+	return v, nil
+}
+
+// roots scans [lo, hi] for sign changes of f and for points where |f| has a local minimum,
+// then locates a root in each with Brent's method or Newton's method respectively. Sign changes
+// at which f does not approach zero, as for 1/x at 0, are returned as discontinuities.
+// identity is set when f is zero at every sample point.
+func (s *solver) roots(lo, hi float64) (roots []solveRoot, discontinuities []float64, identity bool, err error) {
+	xs := make([]float64, solveSamples+1)
+	fs := make([]float64, solveSamples+1)
+	zeros := 0
+	for i := range xs {
+		xs[i] = lo + (hi-lo)*float64(i)/solveSamples
+		if fs[i], err = s.eval(s.f, xs[i]); err != nil {
+			return nil, nil, false, err
+		}
+		if fs[i] == 0 {
+			zeros++
+		}
+	}
+	if zeros == len(xs) {
+		return nil, nil, true, nil
+	}
+
+	for i := range xs {
+		if len(roots) >= maxSolveRoots {
+			break
+		}
+		fa := fs[i]
+		switch {
+		case fa == 0:
+			roots = append(roots, solveRoot{Value: xs[i], Method: "sample", Converged: true})
+
+		case i+1 < len(xs) && fs[i+1] != 0 && !math.IsNaN(fa) && !math.IsNaN(fs[i+1]) && math.Signbit(fa) != math.Signbit(fs[i+1]):
+			root, err := s.brent(xs[i], xs[i+1], fa, fs[i+1])
+			if err != nil {
+				return nil, nil, false, err
+			}
+			scale := math.Max(1, math.Max(math.Abs(fa), math.Abs(fs[i+1])))
+			if math.IsNaN(root.Residual) || math.Abs(root.Residual) > 1e-8*scale {
+				discontinuities = append(discontinuities, root.Value)
+				continue
+			}
+			roots = append(roots, root)
+
+		case i > 0 && i+1 < len(xs) && !math.IsNaN(fs[i-1]) && !math.IsNaN(fs[i+1]) &&
+			math.Signbit(fs[i-1]) == math.Signbit(fa) && math.Signbit(fs[i+1]) == math.Signbit(fa) &&
+			math.Abs(fa) < math.Abs(fs[i-1]) && math.Abs(fa) <= math.Abs(fs[i+1]):
+			// |f| dips towards zero without crossing it, as (x-1)^2 does at 1
+			if s.df == nil {
+				continue
+			}
+			root, err := s.newton(xs[i], xs[i-1], xs[i+1], maxNewtonSteps)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			scale := math.Max(1, math.Max(math.Abs(fs[i-1]), math.Abs(fs[i+1])))
+			if root.Converged && math.Abs(root.Residual) <= 1e-12*scale {
+				root.Method = "newton"
+				roots = append(roots, root)
+			}
+		}
+	}
+
+	// A root on a sample point next to a bracket, or at the bottom of a dip, can be found twice
+	slices.SortFunc(roots, func(a, b solveRoot) int { return cmp.Compare(a.Value, b.Value) })
+	roots = slices.CompactFunc(roots, func(a, b solveRoot) bool {
+		return math.Abs(a.Value-b.Value) <= 1e-9*math.Max(1, math.Abs(a.Value))
+	})
+	return roots, discontinuities, false, nil
+}
+
+// brent locates a root of f in [a, b], where f(a) and f(b) have opposite signs, with Brent's
+// method and polishes it with Newton steps
+func (s *solver) brent(a, b, fa, fb float64) (solveRoot, error) {
+	const eps = 0x1p-52
+	c, fc := a, fa
+	d := b - a
+	e := d
+	root := solveRoot{Method: "brent"}
+	for root.Iterations < maxBrentSteps {
+		if math.Signbit(fb) == math.Signbit(fc) {
+			c, fc = a, fa
+			d = b - a
+			e = d
+		}
+		if math.Abs(fc) < math.Abs(fb) {
+			a, b, c = b, c, b
+			fa, fb, fc = fb, fc, fb
+		}
+		tol := 2*eps*math.Abs(b) + 0.5*math.SmallestNonzeroFloat64
+		half := 0.5 * (c - b)
+		if math.Abs(half) <= tol || fb == 0 {
+			root.Converged = true
+			break
+		}
+		root.Iterations++
+
+		if math.Abs(e) >= tol && math.Abs(fa) > math.Abs(fb) {
+			// Inverse quadratic interpolation, or the secant method with only two points
+			var p, q float64
+			ratio := fb / fa
+			if a == c {
+				p = 2 * half * ratio
+				q = 1 - ratio
+			} else {
+				q = fa / fc
+				r := fb / fc
+				p = ratio * (2*half*q*(q-r) - (b-a)*(r-1))
+				q = (q - 1) * (r - 1) * (ratio - 1)
+			}
+			if p > 0 {
+				q = -q
+			}
+			p = math.Abs(p)
+			if 2*p < math.Min(3*half*q-math.Abs(tol*q), math.Abs(e*q)) {
+				e = d
+				d = p / q
+			} else {
+				d = half
+				e = d
+			}
+		} else {
+			d = half
+			e = d
+		}
+
+		a, fa = b, fb
+		if math.Abs(d) > tol {
+			b += d
+		} else {
+			b += math.Copysign(tol, half)
+		}
+		var err error
+		if fb, err = s.eval(s.f, b); err != nil {
+			return root, err
+		}
+		if math.IsNaN(fb) {
+			// f is undefined inside the bracket
+			root.Value, root.Residual = b, math.NaN()
+			return root, nil
+		}
+	}
+	root.Value, root.Residual = b, fb
+
+	if s.df != nil && root.Residual != 0 {
+		lo, hi := math.Min(b, c), math.Max(b, c)
+		polished, err := s.newton(b, lo, hi, refineSteps)
+		if err != nil {
+			return root, err
+		}
+		if math.Abs(polished.Residual) < math.Abs(root.Residual) {
+			root.Value, root.Residual = polished.Value, polished.Residual
+			root.Iterations += polished.Iterations
+		}
+	}
+	return root, nil
+}
+
+// newton runs Newton's method from x for at most steps iterations, staying inside [lo, hi]. The
+// result has converged when the step has become negligible.
+func (s *solver) newton(x, lo, hi float64, steps int) (solveRoot, error) {
+	fx, err := s.eval(s.f, x)
+	if err != nil {
+		return solveRoot{}, err
+	}
+	root := solveRoot{Value: x, Residual: fx}
+	for root.Iterations < steps && fx != 0 {
+		dfx, err := s.eval(s.df, x)
+		if err != nil {
+			return root, err
+		}
+		if dfx == 0 || math.IsNaN(dfx) {
+			return root, nil
+		}
+		next := x - fx/dfx
+		if next < lo || next > hi || math.IsNaN(next) {
+			return root, nil
+		}
+		fnext, err := s.eval(s.f, next)
+		if err != nil {
+			return root, err
+		}
+		if math.IsNaN(fnext) {
+			return root, nil
+		}
+		root.Iterations++
+		step := math.Abs(next - x)
+		x, fx = next, fnext
+		if math.Abs(fx) <= math.Abs(root.Residual) {
+			root.Value, root.Residual = x, fx
+		}
+		if step <= 4*0x1p-52*math.Abs(x)+math.SmallestNonzeroFloat64 {
+			root.Converged = true
+			break
+		}
+	}
+	if fx == 0 {
+		root.Converged = true
+	}
+	return root, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseEquation(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"x^2 = 4", "x^2-4"},
+		{"x^2 == 4", "x^2-4"},
+		{"x^3 - 2x - 5 = 0", "x^3-2*x-5"},
+		{"cos(x) - x", "cos(x)-x"},
+	}
+	for _, tt := range tests {
+		f, err := parseEquation(tt.expr)
+		if err != nil {
+			t.Errorf("parseEquation(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := formatNode(f); got != tt.want {
+			t.Errorf("parseEquation(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		expr string
+		msg  string
+	}{
+		{"x = 1 = 2", "single '='"},
+		{"= 3", "missing left side"},
+		{"x^2 =", "missing right side"},
+		{"x > 2", "is a condition"},
+		{"x + = 2", "operator '+'"},
+	} {
+		if _, err := parseEquation(tt.expr); err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("parseEquation(%q): got %v, want an error containing %q", tt.expr, err, tt.msg)
+		}
+	}
+}
+
+func TestClosedForm(t *testing.T) {
+	tests := []struct {
+		expr   string
+		degree int
+		roots  []string
+	}{
+		{"2x + 1 = 7", 1, []string{"3"}},
+		{"3x = 1", 1, []string{"1/3"}},
+		{"x^2 = 4", 2, []string{"-2", "2"}},
+		{"x^2 - 2x - 1", 2, []string{"1-sqrt(2)", "sqrt(2)+1"}},
+		{"x^2/2 = 1/3", 2, []string{"-sqrt(6)/3", "sqrt(6)/3"}},
+		{"0.1x^2 + 0.3x - 1", 2, []string{"-5", "2"}},
+		{"(x-1)^2", 2, []string{"1"}},
+		// Small coefficients give discriminants whose numerator times denominator overflows int64
+		{"x^2 - 1e-20 = 0", 2, []string{"-1e-10", "1e-10"}},
+		{"x^2 - 2x + 1 - 1e-12 = 0", 2, []string{"0.999999", "1.000001"}},
+		{"x^2 = 2e-20", 2, []string{"-sqrt(8e-20)/2", "sqrt(8e-20)/2"}},
+		{"x^2 + 1 = 0", 2, nil},
+		{"x = x + 1", 0, nil},
+		{"2(x+1) = 2x + 2", -1, nil},
+	}
+	for _, tt := range tests {
+		f, err := parseEquation(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.expr, err)
+		}
+		roots, degree, ok := closedForm(f, "x", nil)
+		if !ok || degree != tt.degree || len(roots) != len(tt.roots) {
+			t.Errorf("closedForm(%s) = %d root(s) of degree %d, %v; want %v of degree %d", tt.expr, len(roots), degree, ok, tt.roots, tt.degree)
+			continue
+		}
+		for i, r := range roots {
+			if got := formatNode(r); got != tt.roots[i] {
+				t.Errorf("closedForm(%s) root %d = %s, want %s", tt.expr, i, got, tt.roots[i])
+			}
+		}
+	}
+
+	// Cubics and equations with other symbols are left to the numeric method
+	for _, expr := range []string{"x^3 - 2x - 5", "cos(x) = x", "a*x = 1"} {
+		f, _ := parseEquation(expr)
+		if _, _, ok := closedForm(f, "x", nil); ok {
+			t.Errorf("closedForm(%s) should not apply", expr)
+		}
+	}
+}
+
+func TestSolverRoots(t *testing.T) {
+	tests := []struct {
+		expr            string
+		roots           []float64
+		discontinuities int
+	}{
+		{"x^3 - 2x - 5", []float64{2.0945514815423265}, 0},
+		{"cos(x) = x", []float64{0.7390851332151607}, 0},
+		{"ln(x) = 1", []float64{math.E}, 0},
+		{"(x-1.2345)^2*exp(x)", []float64{1.2345}, 0},
+		{"sin(x)", []float64{-3 * math.Pi, -2 * math.Pi, -math.Pi, 0, math.Pi, 2 * math.Pi, 3 * math.Pi}, 0},
+		{"tan(x/4)", []float64{0}, 2},
+		{"floor(x) = 0.5", nil, 1},
+	}
+	for _, tt := range tests {
+		f, err := parseEquation(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tt.expr, err)
+		}
+		s := &solver{boundEvaluator: boundEvaluator{ctx: context.Background(), x: "x", vars: map[string]float64{}}, f: f}
+		if d, err := differentiate(f, "x", nil); err == nil {
+			s.df = d
+		}
+		roots, discontinuities, _, err := s.roots(-10, 10)
+		if err != nil {
+			t.Fatalf("solving %s: %v", tt.expr, err)
+		}
+		if len(roots) != len(tt.roots) || len(discontinuities) != tt.discontinuities {
+			t.Errorf("solving %s: got %v and discontinuities %v, want %v", tt.expr, roots, discontinuities, tt.roots)
+			continue
+		}
+		for i, r := range roots {
+			if math.Abs(r.Value-tt.roots[i]) > 1e-9*math.Max(1, math.Abs(tt.roots[i])) || !r.Converged {
+				t.Errorf("solving %s: root %d = %+v, want %v", tt.expr, i, r, tt.roots[i])
+			}
+		}
+	}
+}
+
+func TestSolveTool(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out solveOutput
+	callTool(t, cs, "solve", map[string]any{"equation": "x^2 - 2x - 1 = 0"}, &out)
+	if out.Method != "closed form" || len(out.Roots) != 2 || out.Roots[0].Exact != "1-sqrt(2)" || out.Roots[1].Method != "quadratic" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = solveOutput{}
+	callTool(t, cs, "solve", map[string]any{"equation": "x^3 - 2x - 5 = 0"}, &out)
+	if out.Method != "numeric" || len(out.Roots) != 1 || math.Abs(out.Roots[0].Value-2.0945514815423265) > 1e-12 ||
+		out.Evaluations == 0 || out.Equation != "x^3-2*x-5 = 0" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	// Session variables are constants in the equation
+	callTool(t, cs, "calculate", map[string]any{"expression": "k = 3"}, nil)
+	out = solveOutput{}
+	callTool(t, cs, "solve", map[string]any{"equation": "t^3 = k", "variable": "t", "min": 0, "max": 5}, &out)
+	if len(out.Roots) != 1 || math.Abs(out.Roots[0].Value-math.Cbrt(3)) > 1e-12 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	// Closed-form roots outside a given interval are dropped
+	out = solveOutput{}
+	callTool(t, cs, "solve", map[string]any{"equation": "x^2 = 9", "min": 0}, &out)
+	if len(out.Roots) != 1 || out.Roots[0].Value != 3 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	// The echoed equation keeps every digit of a coefficient
+	out = solveOutput{}
+	callTool(t, cs, "solve", map[string]any{"equation": "x^2 - 2x + 1 - 1e-12 = 0"}, &out)
+	if out.Equation != "x^2-2*x+0.999999999999 = 0" || out.Method != "closed form" || len(out.Roots) != 2 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	out = solveOutput{}
+	res := callTool(t, cs, "solve", map[string]any{"equation": "1/(x-1) = 0", "min": 0.05, "max": 2}, &out)
+	if len(out.Roots) != 0 || len(out.Discontinuities) != 1 || !strings.Contains(resultText(res), "no real roots") {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	for _, args := range []map[string]any{
+		{"equation": ""},
+		{"equation": "x^2 = y"},
+		{"equation": "x^2 = 2", "min": 3, "max": 1},
+		{"equation": "x^2 = 2", "variable": "pi"},
+	} {
+		if res := callTool(t, cs, "solve", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v, got %q", args, resultText(res))
+		}
+	}
+}
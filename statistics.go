@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Limits of the statistics tool
+const (
+	maxDatasetSize = 100_000 // values
+	maxDatasetText = 1 << 20 // bytes of CSV text
+)
+
+// dataset is the numbers read from the data argument of the statistics tool
+type dataset struct {
+	values  []float64
+	missing int    // empty CSV cells that were skipped
+	column  string // the CSV column the values were taken from, if the text had several
+}
+
+// parseDataset reads an array of numbers, or text with one or more columns of numbers separated
+// by commas, or by whitespace or semicolons when there are no commas. A first row that is not
+// numeric is a header, and column picks a column of a table by header name or 1-based number.
+func parseDataset(data any, column string) (dataset, error) {
+	switch data := data.(type) {
+	case []any:
+		if len(data) > maxDatasetSize {
+			return dataset{}, fmt.Errorf("%d values is more than the limit of %d", len(data), maxDatasetSize)
+		}
+		d := dataset{values: make([]float64, 0, len(data))}
+		for i, item := range data {
+			v, ok := item.(float64)
+			if !ok {
+				return dataset{}, fmt.Errorf("item %d is not a number: %v", i, item)
+			}
+			d.values = append(d.values, v)
+		}
+		return d, nil
+	case string:
+		if len(data) > maxDatasetText {
+			return dataset{}, fmt.Errorf("the text has %d bytes, more than the limit of %d", len(data), maxDatasetText)
+		}
+		return parseDatasetText(data, column)
+	case nil:
+		return dataset{}, fmt.Errorf("an array of numbers or CSV text is required")
+	}
+	return dataset{}, fmt.Errorf("expected an array of numbers or CSV text, got %v", data)
+}
+
+// parseDatasetText reads the text form of a dataset
+func parseDatasetText(text, column string) (dataset, error) {
+	var records [][]string
+	if strings.Contains(text, ",") {
+		r := csv.NewReader(strings.NewReader(text))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return dataset{}, fmt.Errorf("invalid CSV: %v", err)
+			}
+			records = append(records, record)
+		}
+	} else {
+		for line := range strings.Lines(text) {
+			if fields := strings.FieldsFunc(line, func(r rune) bool {
+				return r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+			}); len(fields) > 0 {
+				records = append(records, fields)
+			}
+		}
+	}
+
+	// A single row, or rows of a single field, form one list of numbers
+	single := len(records) == 1
+	if !single {
+		single = true
+		for _, record := range records {
+			if len(record) > 1 {
+				single = false
+				break
+			}
+		}
+	}
+	if single {
+		var fields []string
+		for _, record := range records {
+			fields = append(fields, record...)
+		}
+		if len(fields) > 0 && !isNumeric(fields[0]) {
+			// A header above a single column
+			fields = fields[1:]
+		}
+		d := dataset{}
+		for i, field := range fields {
+			if err := d.add(field, fmt.Sprintf("value %d", i+1)); err != nil {
+				return dataset{}, err
+			}
+		}
+		return d, nil
+	}
+
+	var header []string
+	if !slices.ContainsFunc(records[0], isNumeric) {
+		header, records = records[0], records[1:]
+	}
+	index := -1
+	if n, err := strconv.Atoi(column); err == nil && n >= 1 {
+		index = n - 1
+	} else if column != "" {
+		index = slices.Index(header, column)
+		if index < 0 {
+			return dataset{}, fmt.Errorf("no column named '%s'; the columns are %s", column, strings.Join(header, ", "))
+		}
+	}
+	if index < 0 {
+		if header != nil {
+			return dataset{}, fmt.Errorf("the data has %d columns; set 'column' to one of %s, or to a column number", len(header), strings.Join(header, ", "))
+		}
+		return dataset{}, fmt.Errorf("the data has several columns; set 'column' to a column number")
+	}
+
+	width := len(header)
+	for _, record := range records {
+		width = max(width, len(record))
+	}
+	if index >= width {
+		return dataset{}, fmt.Errorf("column %d does not exist; the data has %d columns", index+1, width)
+	}
+
+	// Rows are numbered as lines of the text, counting the header
+	first := 1
+	d := dataset{column: strconv.Itoa(index + 1)}
+	if header != nil {
+		first = 2
+		d.column = header[index]
+	}
+	for i, record := range records {
+		field := ""
+		if index < len(record) {
+			field = record[index]
+		}
+		if err := d.add(field, fmt.Sprintf("row %d", first+i)); err != nil {
+			return dataset{}, err
+		}
+	}
+	return d, nil
+}
+
+// add appends the number in field, or counts it as missing if it is empty
+func (d *dataset) add(field, at string) error {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		d.missing++
+		return nil
+	}
+	v, err := strconv.ParseFloat(field, 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return fmt.Errorf("%s is not a finite number: '%s'", at, field)
+	}
+	if len(d.values) == maxDatasetSize {
+		return fmt.Errorf("more than the limit of %d values", maxDatasetSize)
+	}
+	d.values = append(d.values, v)
+	return nil
+}
+
+// isNumeric reports whether a field holds a number
+func isNumeric(field string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+	return err == nil
+}
+
+// summary holds the descriptive statistics of a dataset. Measures that are undefined for the
+// data, such as the sample variance of a single value, are nil.
+type summary struct {
+	count                                int
+	sum, mean, median, min, max, q1, q3  float64
+	mode                                 []float64
+	modeCount                            int
+	populationVariance, sampleVariance   *float64
+	populationDeviation, sampleDeviation *float64
+	skewness, kurtosis                   *float64
+	sorted                               []float64
+}
+
+// describe computes the statistics of a non-empty list of values. The sum is compensated and may
+// overflow to ±Inf. The mean is a running average, which stays finite when the sum does not, and
+// the central moments are computed in further passes over the deviations from it, with the mean
+// and the variance corrected for its rounding, so that large offsets such as 1e9 + {4, 7, 13, 16}
+// do not swamp the variance as they do in the textbook formula Σx² - (Σx)²/n.
+func describe(values []float64) (summary, error) {
+	s := summary{count: len(values), sorted: slices.Clone(values)}
+	slices.Sort(s.sorted)
+	n := float64(s.count)
+
+	// Neumaier's compensated summation
+	var compensation float64
+	for _, x := range values {
+		t := s.sum + x
+		if math.IsInf(t, 0) {
+			s.sum, compensation = t, 0
+			break
+		}
+		if math.Abs(s.sum) >= math.Abs(x) {
+			compensation += (s.sum - t) + x
+		} else {
+			compensation += (x - t) + s.sum
+		}
+		s.sum = t
+	}
+	s.sum += compensation
+
+	// mean += (x - mean)/k, with the difference divided first so that it cannot overflow
+	for i, x := range values {
+		k := float64(i + 1)
+		s.mean += x/k - s.mean/k
+	}
+
+	var m1, m2 float64
+	for _, x := range values {
+		d := x - s.mean
+		m1 += d
+		m2 += d * d
+	}
+	m2 -= m1 * m1 / n
+	if math.IsInf(m2, 0) || math.IsNaN(m2) {
+		return s, fmt.Errorf("the data is too spread out to compute its variance in float64")
+	}
+	m2 = math.Max(m2, 0)
+	s.mean += m1 / n
+
+	populationVariance := m2 / n
+	populationDeviation := math.Sqrt(populationVariance)
+	s.populationVariance, s.populationDeviation = &populationVariance, &populationDeviation
+	if s.count > 1 {
+		sampleVariance := m2 / (n - 1)
+		sampleDeviation := math.Sqrt(sampleVariance)
+		s.sampleVariance, s.sampleDeviation = &sampleVariance, &sampleDeviation
+	}
+	if m2 > 0 {
+		// The moment coefficient of skewness and the excess kurtosis, from standardized
+		// deviations so that their third and fourth powers cannot overflow
+		var z3, z4 float64
+		for _, x := range values {
+			z := (x - s.mean) / populationDeviation
+			z3 += z * z * z
+			z4 += z * z * z * z
+		}
+		skewness, kurtosis := z3/n, z4/n-3
+		s.skewness, s.kurtosis = &skewness, &kurtosis
+	}
+
+	s.min, s.max = s.sorted[0], s.sorted[len(s.sorted)-1]
+	s.median = s.percentile(50)
+	s.q1, s.q3 = s.percentile(25), s.percentile(75)
+
+	// The mode is every value that occurs most often, if any occurs more than once
+	for i := 0; i < len(s.sorted); {
+		j := i
+		for j < len(s.sorted) && s.sorted[j] == s.sorted[i] {
+			j++
+		}
+		switch count := j - i; {
+		case count > s.modeCount:
+			s.mode, s.modeCount = []float64{s.sorted[i]}, count
+		case count == s.modeCount:
+			s.mode = append(s.mode, s.sorted[i])
+		}
+		i = j
+	}
+	if s.modeCount < 2 {
+		s.mode, s.modeCount = nil, 0
+	}
+	return s, nil
+}
+
+// percentile returns the p-th percentile (0 to 100) by linear interpolation between the closest
+// ranks, the default of NumPy and Excel's PERCENTILE.INC
+func (s summary) percentile(p float64) float64 {
+	h := (float64(len(s.sorted)) - 1) * p / 100
+	lo := math.Floor(h)
+	i := int(lo)
+	if i+1 >= len(s.sorted) {
+		return s.sorted[len(s.sorted)-1]
+	}
+	return s.sorted[i] + (h-lo)*(s.sorted[i+1]-s.sorted[i])
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	s, err := describe([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.count != 8 || s.sum != 40 || s.mean != 5 || s.median != 4.5 || s.min != 2 || s.max != 9 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if s.q1 != 4 || s.q3 != 5.5 {
+		t.Errorf("quartiles = %v, %v; want 4, 5.5", s.q1, s.q3)
+	}
+	if !slices.Equal(s.mode, []float64{4}) || s.modeCount != 3 {
+		t.Errorf("mode = %v (%d times), want 4 (3 times)", s.mode, s.modeCount)
+	}
+	if *s.populationVariance != 4 || *s.populationDeviation != 2 || math.Abs(*s.sampleVariance-32.0/7) > 1e-15 {
+		t.Errorf("variances = %v, %v", *s.populationVariance, *s.sampleVariance)
+	}
+	if math.Abs(*s.skewness-0.65625) > 1e-15 || math.Abs(*s.kurtosis+0.21875) > 1e-15 {
+		t.Errorf("skewness = %v, kurtosis = %v; want 0.65625, -0.21875", *s.skewness, *s.kurtosis)
+	}
+
+	// A large offset does not cost the variance its accuracy
+	s, _ = describe([]float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16})
+	if *s.sampleVariance != 30 {
+		t.Errorf("sample variance = %v, want 30", *s.sampleVariance)
+	}
+	s, _ = describe([]float64{0.1, 0.2, 0.3})
+	if s.sum != 0.6 {
+		t.Errorf("sum = %v, want 0.6", s.sum)
+	}
+
+	// Undefined measures are left out
+	s, _ = describe([]float64{3})
+	if s.sampleVariance != nil || s.skewness != nil || s.mode != nil || *s.populationVariance != 0 || s.median != 3 {
+		t.Errorf("unexpected summary of one value: %+v", s)
+	}
+	s, _ = describe([]float64{1, 1, 2, 2, 3})
+	if !slices.Equal(s.mode, []float64{1, 2}) || s.modeCount != 2 {
+		t.Errorf("mode = %v, want 1 and 2", s.mode)
+	}
+
+	// The mean is representable even when the sum overflows
+	s, err = describe([]float64{1e308, 1e308, 1e308})
+	if err != nil || !math.IsInf(s.sum, 1) || s.mean != 1e308 || *s.populationVariance != 0 {
+		t.Errorf("unexpected summary: %+v, %v", s, err)
+	}
+	if _, err := describe([]float64{-math.MaxFloat64, math.MaxFloat64}); err == nil {
+		t.Errorf("expected the variance to overflow")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	s, _ := describe([]float64{15, 20, 35, 40, 50})
+	for _, tt := range []struct{ p, want float64 }{
+		{0, 15}, {5, 16}, {30, 23}, {40, 29}, {50, 35}, {95, 48}, {100, 50},
+	} {
+		if got := s.percentile(tt.p); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("P%v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestParseDataset(t *testing.T) {
+	tests := []struct {
+		data    any
+		column  string
+		want    []float64
+		missing int
+		name    string
+	}{
+		{[]any{1.0, 2.5, -3.0}, "", []float64{1, 2.5, -3}, 0, ""},
+		{"1, 2, 3", "", []float64{1, 2, 3}, 0, ""},
+		{"1 2\t3; 4", "", []float64{1, 2, 3, 4}, 0, ""},
+		{"1\n2\r\n3", "", []float64{1, 2, 3}, 0, ""},
+		{"x\ty\n1\t10\n2\t20", "y", []float64{10, 20}, 0, "y"},
+		{"price\n10\n\n20\n", "", []float64{10, 20}, 0, ""},
+		{"a,b\n1,10\n2,20\n3,", "b", []float64{10, 20}, 1, "b"},
+		{"a,b\n1,10\n2,20", "1", []float64{1, 2}, 0, "a"},
+		{"1,10\n2,20", "2", []float64{10, 20}, 0, "2"},
+		{"name,\"score, final\"\nann,\"7\"\nbo,9", "score, final", []float64{7, 9}, 0, "score, final"},
+	}
+	for _, tt := range tests {
+		d, err := parseDataset(tt.data, tt.column)
+		if err != nil || !slices.Equal(d.values, tt.want) || d.missing != tt.missing || d.column != tt.name {
+			t.Errorf("parseDataset(%q, %q) = %+v, %v; want %v", tt.data, tt.column, d, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		data   any
+		column string
+		msg    string
+	}{
+		{nil, "", "is required"},
+		{true, "", "expected an array"},
+		{[]any{1.0, "2"}, "", "item 1 is not a number"},
+		{"1, two, 3", "", "value 2 is not a finite number: 'two'"},
+		{"1, inf", "", "value 2 is not a finite number"},
+		{"a,b\n1,2", "", "set 'column' to one of a, b"},
+		{"1,2\n3,4", "", "set 'column' to a column number"},
+		{"a,b\n1,2", "c", "no column named 'c'"},
+		{"a,b\n1,2", "3", "column 3 does not exist"},
+		{"a,b\n1,x", "b", "row 2 is not a finite number: 'x'"},
+		{"a,\"b\n1", "", "invalid CSV"},
+		{make([]any, maxDatasetSize+1), "", "limit"},
+	} {
+		if _, err := parseDataset(tt.data, tt.column); err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("parseDataset(%v, %q): got %v, want an error containing %q", tt.data, tt.column, err, tt.msg)
+		}
+	}
+}
+
+func TestStatisticsTool(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out statisticsOutput
+	callTool(t, cs, "statistics", map[string]any{"data": []float64{2, 4, 4, 4, 5, 5, 7, 9}, "percentiles": []float64{10, 90}}, &out)
+	if out.Count != 8 || *out.Mean != 5 || *out.Median != 4.5 || *out.IQR != 1.5 || *out.PopulationStddev != 2 || len(out.Percentiles) != 2 || math.Abs(out.Percentiles[0].Value-3.4) > 1e-12 {
+		t.Errorf("unexpected output: %+v", out)
+	}
+	if !strings.HasPrefix(out.Result, "Count: 8, sum: 40, mean: 5\nMedian: 4.5, mode: 4 (3 times)\n") || !strings.Contains(out.Result, "P10 = 3.4, P90 = 7.6") {
+		t.Errorf("unexpected result text:\n%s", out.Result)
+	}
+
+	out = statisticsOutput{}
+	callTool(t, cs, "statistics", map[string]any{"data": "x\n42"}, &out)
+	if out.Count != 1 || out.SampleVariance != nil || out.Skewness != nil || !strings.Contains(out.Result, "no sample variance") {
+		t.Errorf("unexpected output: %+v", out)
+	}
+
+	for _, args := range []map[string]any{
+		{"data": []any{}},
+		{"data": "a, b"},
+		{"data": []float64{1, 2}, "percentiles": []float64{101}},
+	} {
+		if res := callTool(t, cs, "statistics", args, nil); !res.IsError {
+			t.Errorf("expected an error for %v, got %q", args, resultText(res))
+		}
+	}
+
+	// A failed call publishes no statistics
+	out = statisticsOutput{}
+	res := callTool(t, cs, "statistics", map[string]any{"data": []float64{-1e308, 1e308}}, &out)
+	if !res.IsError || out.Error == nil || out.Error.Kind != errKindInvalidResult || out.Sum != nil || out.Mean != nil || out.Median != nil {
+		t.Errorf("expected an invalid_result error and no statistics, got %+v", out)
+	}
+
+	out = statisticsOutput{}
+	callTool(t, cs, "statistics", map[string]any{"data": []float64{1e308, 1e308}}, &out)
+	if out.Sum != nil || *out.Mean != 1e308 || !strings.HasPrefix(out.Result, "Count: 2, sum: overflows float64, mean: 1e+308") {
+		t.Errorf("unexpected output: %+v", out)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import "math"
+
+// The sym* constructors build expression trees for symbolic results, folding constants and
+// applying identities such as 0 + x = x, 1 * x = x and x^1 = x as they go. Built nodes carry no
+// source positions.
+
+// numberValue returns the value of a literal number node
+func numberValue(n node) (float64, bool) {
+	num, ok := n.(*numberNode)
+	if !ok {
+		return 0, false
+	}
+	return num.value, true
+}
+
+// isNumber reports whether n is the literal v
+func isNumber(n node, v float64) bool {
+	x, ok := numberValue(n)
+	return ok && x == v
+}
+
+// isInteger reports whether v is a whole number small enough to print exactly
+func isInteger(v float64) bool {
+	return v == math.Trunc(v) && math.Abs(v) < maxExactFloatInt
+}
+
+// sameNode reports whether a and b are structurally equal
+func sameNode(a, b node) bool {
+	return formatNode(a) == formatNode(b)
+}
+
+func symNeg(a node) node {
+	if v, ok := numberValue(a); ok {
+		return literal(-v)
+	}
+	if u, ok := a.(*unaryNode); ok && u.op == "-" {
+		return u.operand
+	}
+	if b, ok := a.(*binaryNode); ok && b.op == "-" {
+		return symSub(b.right, b.left)
+	}
+	if b, ok := a.(*binaryNode); ok && (b.op == "*" || b.op == "/") {
+		return symMul(literal(-1), a)
+	}
+	return &unaryNode{op: "-", operand: a}
+}
+
+func symAdd(a, b node) node {
+	av, aNum := numberValue(a)
+	bv, bNum := numberValue(b)
+	switch {
+	case aNum && bNum:
+		return literal(av + bv)
+	case aNum && av == 0:
+		return b
+	case bNum && bv == 0:
+		return a
+	case bNum && bv < 0:
+		return symSub(a, literal(-bv))
+	}
+	if neg, ok := negativeTerm(b); ok {
+		return symSub(a, neg)
+	}
+	if neg, ok := negativeTerm(a); ok {
+		return symSub(b, neg)
+	}
+	if sameNode(a, b) {
+		return symMul(literal(2), a)
+	}
+	return &binaryNode{op: "+", left: a, right: b}
+}
+
+// negativeTerm returns -n when n is written with a leading minus sign: -x, -2*x or -x/y
+func negativeTerm(n node) (node, bool) {
+	switch m := n.(type) {
+	case *unaryNode:
+		if m.op == "-" {
+			return m.operand, true
+		}
+	case *binaryNode:
+		if m.op == "*" || m.op == "/" {
+			first := m.left
+			for {
+				b, ok := first.(*binaryNode)
+				if !ok || (b.op != "*" && b.op != "/") {
+					break
+				}
+				first = b.left
+			}
+			if v, ok := numberValue(first); ok && v < 0 {
+				return symNeg(n), true
+			}
+			if u, ok := first.(*unaryNode); ok && u.op == "-" {
+				return symNeg(n), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func symSub(a, b node) node {
+	av, aNum := numberValue(a)
+	bv, bNum := numberValue(b)
+	switch {
+	case aNum && bNum:
+		return literal(av - bv)
+	case bNum && bv == 0:
+		return a
+	case aNum && av == 0:
+		return symNeg(b)
+	case bNum && bv < 0:
+		return symAdd(a, literal(-bv))
+	case sameNode(a, b):
+		return literal(0)
+	}
+	if neg, ok := negativeTerm(b); ok {
+		return symAdd(a, neg)
+	}
+	return &binaryNode{op: "-", left: a, right: b}
+}
+
+func symMul(a, b node) node {
+	return symProduct(a, b, false)
+}
+
+func symDiv(a, b node) node {
+	if isNumber(b, 0) {
+		return &binaryNode{op: "/", left: a, right: b}
+	}
+	return symProduct(a, b, true)
+}
+
+// factor is one base^exponent term of a product
+type factor struct {
+	base, exponent node
+}
+
+// product is a monomial: num/den times the product of its factors. The coefficient is kept as
+// a fraction so that 1/3 does not turn into 0.3333333333. text, if set, is the exact decimal
+// text of a whole coefficient num that formatResult would round, such as 0.999999999999.
+type product struct {
+	num, den float64
+	text     string
+	factors  []factor
+}
+
+// symProduct returns a*b, or a/b if divide is set. Both operands are flattened into one product
+// whose coefficients are multiplied out and whose powers of the same base are merged, so
+// 2*x*3*x = 6*x^2 and 2*x/(4*x^3) = 1/(2*x^2).
+func symProduct(a, b node, divide bool) node {
+	p := &product{num: 1, den: 1}
+	p.collect(a, false)
+	p.collect(b, divide)
+	return p.node()
+}
+
+// collect multiplies p by n, or divides it by n if inverse is set
+func (p *product) collect(n node, inverse bool) {
+	if v, ok := numberValue(n); ok && v != 0 {
+		if inverse {
+			p.den *= v
+		} else {
+			p.num *= v
+		}
+		return
+	}
+	switch m := n.(type) {
+	case *numberNode:
+		p.num = 0
+		return
+	case *unaryNode:
+		if m.op == "-" {
+			p.num = -p.num
+			p.collect(m.operand, inverse)
+			return
+		}
+	case *binaryNode:
+		switch m.op {
+		case "*":
+			p.collect(m.left, inverse)
+			p.collect(m.right, inverse)
+			return
+		case "/":
+			if !isNumber(m.right, 0) {
+				p.collect(m.left, inverse)
+				p.collect(m.right, !inverse)
+				return
+			}
+		}
+	}
+
+	base, exponent := powerOf(n)
+	if inverse {
+		exponent = symNeg(exponent)
+	}
+	for i, f := range p.factors {
+		if sameNode(f.base, base) {
+			p.factors[i].exponent = symAdd(f.exponent, exponent)
+			return
+		}
+	}
+	p.factors = append(p.factors, factor{base, exponent})
+}
+
+// node rebuilds the product as coefficient*numerator/denominator
+func (p *product) node() node {
+	if p.num == 0 {
+		return literal(0)
+	}
+	num, den := p.num, p.den
+	if den < 0 {
+		num, den = -num, -den
+	}
+	if isInteger(num) && isInteger(den) {
+		g := gcd(math.Abs(num), den)
+		num, den = num/g, den/g
+	} else {
+		num, den = num/den, 1
+	}
+
+	var numerator, denominator node
+	multiply := func(acc, n node) node {
+		if acc == nil {
+			return n
+		}
+		return &binaryNode{op: "*", left: acc, right: n}
+	}
+	for _, f := range p.factors {
+		e, numeric := numberValue(f.exponent)
+		u, negated := f.exponent.(*unaryNode)
+		switch {
+		case numeric && e == 0:
+		case numeric && e < 0:
+			denominator = multiply(denominator, symPow(f.base, literal(-e)))
+		case negated && u.op == "-":
+			denominator = multiply(denominator, symPow(f.base, u.operand))
+		default:
+			numerator = multiply(numerator, symPow(f.base, f.exponent))
+		}
+	}
+
+	coef := literal(num)
+	if p.text != "" {
+		coef = &numberNode{value: num, text: p.text}
+	}
+	switch {
+	case numerator == nil:
+		numerator = coef
+	case num == -1:
+		numerator = negateFirst(numerator)
+	case num != 1:
+		numerator = prependFactor(coef, numerator)
+	}
+	if den != 1 {
+		denominator = prependFactor(literal(den), denominator)
+	}
+	if denominator == nil {
+		return numerator
+	}
+	return &binaryNode{op: "/", left: numerator, right: denominator}
+}
+
+// prependFactor returns c*n, with c as the first factor of the product n; n may be nil
+func prependFactor(c, n node) node {
+	if n == nil {
+		return c
+	}
+	if m, ok := n.(*binaryNode); ok && m.op == "*" {
+		return &binaryNode{op: "*", left: prependFactor(c, m.left), right: m.right}
+	}
+	return &binaryNode{op: "*", left: c, right: n}
+}
+
+// negateFirst negates the first factor of the product n, so that -(x*y) prints as -x*y
+func negateFirst(n node) node {
+	if m, ok := n.(*binaryNode); ok && m.op == "*" {
+		return &binaryNode{op: "*", left: negateFirst(m.left), right: m.right}
+	}
+	return &unaryNode{op: "-", operand: n}
+}
+
+// powerOf splits n into base^exponent, treating anything but a power as n^1
+func powerOf(n node) (base, exponent node) {
+	if p, ok := n.(*binaryNode); ok && p.op == "^" {
+		return p.left, p.right
+	}
+	return n, literal(1)
+}
+
+// gcd returns the greatest common divisor of two non-negative whole numbers
+func gcd(a, b float64) float64 {
+	for b != 0 {
+		a, b = b, math.Mod(a, b)
+	}
+	return a
+}
+
+func symPow(a, b node) node {
+	av, aNum := numberValue(a)
+	bv, bNum := numberValue(b)
+	switch {
+	case bNum && bv == 0:
+		return literal(1)
+	case bNum && bv == 1:
+		return a
+	case aNum && av == 1:
+		return literal(1)
+	case aNum && bNum && isInteger(math.Pow(av, bv)) && bv > 0:
+		return literal(math.Pow(av, bv))
+	}
+	if p, ok := a.(*binaryNode); ok && bNum && isInteger(bv) {
+		switch p.op {
+		case "^":
+			// (x^2)^3 = x^6
+			if e, ok := numberValue(p.right); ok {
+				return symPow(p.left, literal(e*bv))
+			}
+		case "*":
+			// (2*x)^2 = 4*x^2
+			return symMul(symPow(p.left, b), symPow(p.right, b))
+		case "/":
+			return symDiv(symPow(p.left, b), symPow(p.right, b))
+		}
+	}
+	return &binaryNode{op: "^", left: a, right: b}
+}
+
+func symCall(name string, args ...node) node {
+	return &callNode{name: name, args: args}
+}
+
+// dependsOn reports whether n refers to the variable x
+func dependsOn(n node, x string) bool {
+	found := false
+	walk(n, func(n node) {
+		if id, ok := n.(*identNode); ok && id.name == x {
+			found = true
+		}
+	})
+	return found
+}
+
+// substitute returns n with each identifier in values replaced by its expression. Nodes without
+// a replacement inside are shared with n.
+func substitute(n node, values map[string]node) node {
+	switch n := n.(type) {
+	case *identNode:
+		if v, ok := values[n.name]; ok {
+			return v
+		}
+	case *unaryNode:
+		return &unaryNode{op: n.op, operand: substitute(n.operand, values), start: n.start}
+	case *percentNode:
+		return &percentNode{operand: substitute(n.operand, values), start: n.start, end: n.end}
+	case *factorialNode:
+		return &factorialNode{operand: substitute(n.operand, values), double: n.double, start: n.start, end: n.end}
+	case *binaryNode:
+		return &binaryNode{op: n.op, left: substitute(n.left, values), right: substitute(n.right, values), opPos: n.opPos, implicit: n.implicit}
+	case *conditionalNode:
+		return &conditionalNode{cond: substitute(n.cond, values), then: substitute(n.then, values), otherwise: substitute(n.otherwise, values), start: n.start, end: n.end}
+	case *callNode:
+		args := make([]node, len(n.args))
+		for i, arg := range n.args {
+			args[i] = substitute(arg, values)
+		}
+		return &callNode{name: n.name, args: args, start: n.start, end: n.end}
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxTraceSteps bounds the length of an evaluation trace
+const maxTraceSteps = 200
+
+// traceStatement evaluates the expression of a statement one reduction at a time, in the order
+// the evaluator uses: operands left to right, innermost first. It returns the expression as
+// written followed by each intermediate form, ending with the result, e.g.
+// ["2 + 3 * 4", "2+12", "14"]. Names are replaced by their values one step at a time, calls of
+// user-defined functions are reduced in a single step and only the selected branch of a
+// conditional is evaluated.
+func traceStatement(expr string, ev *evaluator) ([]string, error) {
+	stmt, err := parseStatement(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	source := expr
+	if stmt.target != "" {
+		source = expr[strings.Index(expr, "=")+1:]
+	}
+	steps := []string{strings.TrimSpace(source)}
+	for n := stmt.expr; len(steps) <= maxTraceSteps; {
+		next, reduced, err := ev.reduce(n)
+		if err != nil {
+			return nil, err
+		}
+		if !reduced {
+			return steps, nil
+		}
+		n = next
+		// Negating a literal, as in -2^2 → -4, does not change how the expression reads
+		if step := formatNode(n); step != steps[len(steps)-1] {
+			steps = append(steps, step)
+		}
+	}
+	return nil, fmt.Errorf("the evaluation takes more than %d steps to trace", maxTraceSteps)
+}
+
+// isLiteral reports whether n is a value that cannot be reduced further
+func isLiteral(n node) bool {
+	_, ok := n.(*numberNode)
+	return ok
+}
+
+// reduce performs the first reduction of n in evaluation order, returning the new tree and
+// whether anything was reduced. Reduced subtrees become literals; the rest of the tree is shared.
+func (ev *evaluator) reduce(n node) (node, bool, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return n, false, nil
+
+	case *unaryNode:
+		if !isLiteral(n.operand) {
+			operand, _, err := ev.reduce(n.operand)
+			return &unaryNode{op: n.op, operand: operand, start: n.start}, true, err
+		}
+
+	case *percentNode:
+		if !isLiteral(n.operand) {
+			operand, _, err := ev.reduce(n.operand)
+			return &percentNode{operand: operand, start: n.start, end: n.end}, true, err
+		}
+
+	case *factorialNode:
+		if !isLiteral(n.operand) {
+			operand, _, err := ev.reduce(n.operand)
+			return &factorialNode{operand: operand, double: n.double, start: n.start, end: n.end}, true, err
+		}
+
+	case *binaryNode:
+		if !isLiteral(n.left) {
+			left, _, err := ev.reduce(n.left)
+			return &binaryNode{op: n.op, left: left, right: n.right, opPos: n.opPos, implicit: n.implicit}, true, err
+		}
+		// 'and' and 'or' short-circuit on their left operand
+		left := n.left.(*numberNode).value
+		if (n.op == "and" && left == 0) || (n.op == "or" && left != 0) {
+			return boolLiteral(n.op == "or"), true, nil
+		}
+		// In a + b%, the percentage is of a, so b% is only reduced together with the addition
+		right := n.right
+		if p, ok := right.(*percentNode); ok && relativePercent(n) {
+			right = p.operand
+		}
+		if !isLiteral(right) {
+			reduced, _, err := ev.reduce(n.right)
+			return &binaryNode{op: n.op, left: n.left, right: reduced, opPos: n.opPos, implicit: n.implicit}, true, err
+		}
+
+	case *conditionalNode:
+		if !isLiteral(n.cond) {
+			cond, _, err := ev.reduce(n.cond)
+			return &conditionalNode{cond: cond, then: n.then, otherwise: n.otherwise, start: n.start, end: n.end}, true, err
+		}
+		if n.cond.(*numberNode).value != 0 {
+			return n.then, true, nil
+		}
+		return n.otherwise, true, nil
+
+	case *callNode:
+		for i, arg := range n.args {
+			if !isLiteral(arg) {
+				args := append([]node(nil), n.args...)
+				reduced, _, err := ev.reduce(arg)
+				args[i] = reduced
+				return &callNode{name: n.name, args: args, start: n.start, end: n.end}, true, err
+			}
+		}
+	}
+
+	// Every operand is a literal (or n is a name), so n itself is the next reduction
+	v, err := ev.eval(n)
+	if err != nil {
+		return nil, false, err
+	}
+	if isBoolean(n) {
+		return boolLiteral(v != 0), true, nil
+	}
+	return literal(v), true, nil
+}
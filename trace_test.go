@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestTraceStatement(t *testing.T) {
+	tests := []struct {
+		expr  string
+		steps []string
+	}{
+		{"2+3*4", []string{"2+3*4", "2+12", "14"}},
+		{"(2 + 3) * 4", []string{"(2 + 3) * 4", "5*4", "20"}},
+		{"2^3^2", []string{"2^3^2", "2^9", "512"}},
+		{"-2^2 + 1", []string{"-2^2 + 1", "-4+1", "-3"}},
+		{"pi*r^2", []string{"pi*r^2", "3.141592654*r^2", "3.141592654*2^2", "3.141592654*4", "12.56637061"}},
+		{"sqrt(16) + 200 + 15%", []string{"sqrt(16) + 200 + 15%", "4+200+15%", "204+15%", "234.6"}},
+		{"r > 1 ? 10 : 1/0", []string{"r > 1 ? 10 : 1/0", "2 > 1 ? 10 : 1/0", "true ? 10 : 1/0", "10"}},
+		{"r < 1 and 1/0 > 0", []string{"r < 1 and 1/0 > 0", "2 < 1 and 1/0 > 0", "false and 1/0 > 0", "false"}},
+		{"x = 3! - 10", []string{"3! - 10", "6-10", "-4"}},
+		{"1 - (2 - 3)", []string{"1 - (2 - 3)", "1-(-1)", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			steps, err := traceStatement(tt.expr, &evaluator{vars: map[string]float64{"r": 2}})
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if strings.Join(steps, " → ") != strings.Join(tt.steps, " → ") {
+				t.Errorf("%q: expected %q, got %q", tt.expr, tt.steps, steps)
+			}
+		})
+	}
+}
+
+func TestFormatNodeRoundTrip(t *testing.T) {
+	for _, expr := range []string{
+		"2+3*4", "(2+3)*4", "2^3^2", "(2^3)^2", "(-2)^2", "-2^2", "1-(2-3)", "2/(3*4)", "x%3",
+		"5!!", "(1+2)!", "200+15%", "not x < 1 or y", "x > 0 ? x : -x", "(a ? b : c) ? d : e", "max(1, x+2)",
+	} {
+		n, err := parseExpression(expr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", expr, err)
+		}
+		if got := formatNode(n); got != strings.ReplaceAll(expr, " ", "") && !strings.Contains(expr, " ") {
+			t.Errorf("expected %q to print as itself, got %q", expr, got)
+		}
+		again, err := parseExpression(formatNode(n))
+		if err != nil {
+			t.Fatalf("printed form %q of %q does not parse: %v", formatNode(n), expr, err)
+		}
+		if sexpr(again) != sexpr(n) {
+			t.Errorf("%q: printed form %q parses as %s, expected %s", expr, formatNode(n), sexpr(again), sexpr(n))
+		}
+	}
+}
+
+func TestCalculateTrace(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "2+3*4", "trace": true}, &out)
+	if strings.Join(out.Trace, " → ") != "2+3*4 → 2+12 → 14" {
+		t.Errorf("unexpected trace: %q", out.Trace)
+	}
+
+	if res := callTool(t, cs, "calculate", map[string]any{"expression": "1/3", "trace": true, "mode": "exact"}, nil); !res.IsError {
+		t.Errorf("expected trace to be rejected in exact mode")
+	}
+}
+
+func TestExplainCalculationPromptEmbedsTrace(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	res, err := cs.GetPrompt(context.Background(), &mcp.GetPromptParams{
+		Name:      "explain_calculation",
+		Arguments: map[string]string{"expression": "2 + 3 * 4"},
+	})
+	if err != nil {
+		t.Fatalf("GetPrompt failed: %v", err)
+	}
+	text := res.Messages[0].Content.(*mcp.TextContent).Text
+	if !strings.Contains(text, "2 + 3 * 4\n→ 2+12\n→ 14") {
+		t.Errorf("expected the verified trace in the prompt, got:\n%s", text)
+	}
+	// Long expressions are refused like in calculate, before they are parsed
+	long := strings.Repeat("(", 3_000_000) + "1" + strings.Repeat(")", 3_000_000)
+	if _, err := cs.GetPrompt(context.Background(), &mcp.GetPromptParams{Name: "explain_calculation", Arguments: map[string]string{"expression": long}}); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("expected the expression to be refused as too long, got %v", err)
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// dimension holds the exponents of the SI base quantities:
+// length, mass, time, electric current, temperature, amount of substance and luminous intensity
+type dimension [7]int
+
+// baseUnitSymbols are the SI units of each dimension, in the order used to format units
+var baseUnitSymbols = []struct {
+	index  int
+	symbol string
+}{{1, "kg"}, {0, "m"}, {2, "s"}, {3, "A"}, {4, "K"}, {5, "mol"}, {6, "cd"}}
+
+var (
+	dimLength      = dimension{1, 0, 0, 0, 0, 0, 0}
+	dimMass        = dimension{0, 1, 0, 0, 0, 0, 0}
+	dimTime        = dimension{0, 0, 1, 0, 0, 0, 0}
+	dimCurrent     = dimension{0, 0, 0, 1, 0, 0, 0}
+	dimTemperature = dimension{0, 0, 0, 0, 1, 0, 0}
+	dimAmount      = dimension{0, 0, 0, 0, 0, 1, 0}
+	dimLuminosity  = dimension{0, 0, 0, 0, 0, 0, 1}
+)
+
+func (d dimension) mul(o dimension) dimension {
+	for i := range d {
+		d[i] += o[i]
+	}
+	return d
+}
+
+func (d dimension) div(o dimension) dimension {
+	for i := range d {
+		d[i] -= o[i]
+	}
+	return d
+}
+
+// pow raises d to a power, failing if an exponent would not be an integer (e.g. sqrt(m))
+func (d dimension) pow(e float64) (dimension, bool) {
+	for i := range d {
+		v := float64(d[i]) * e
+		if math.Abs(v-math.Round(v)) > 1e-9 {
+			return d, false
+		}
+		d[i] = int(math.Round(v))
+	}
+	return d, true
+}
+
+func (d dimension) dimensionless() bool {
+	return d == dimension{}
+}
+
+// unitDef is a unit in terms of SI base units: value = factor in base units of dimension dim
+type unitDef struct {
+	factor     float64
+	dim        dimension
+	prefixable bool
+}
+
+func prefixable(factor float64, dim dimension) unitDef {
+	return unitDef{factor: factor, dim: dim, prefixable: true}
+}
+
+func fixed(factor float64, dim dimension) unitDef {
+	return unitDef{factor: factor, dim: dim}
+}
+
+var (
+	dimForce  = dimMass.mul(dimLength).div(dimTime).div(dimTime)
+	dimEnergy = dimForce.mul(dimLength)
+	dimPower  = dimEnergy.div(dimTime)
+	dimCharge = dimCurrent.mul(dimTime)
+	dimVolt   = dimPower.div(dimCurrent)
+	dimArea   = dimLength.mul(dimLength)
+	dimVolume = dimArea.mul(dimLength)
+	dimPress  = dimForce.div(dimArea)
+	dimSpeed  = dimLength.div(dimTime)
+)
+
+// units is the registry of unit symbols. Prefixable units also accept SI prefixes (km, ms, hPa, kWh).
+var units = map[string]unitDef{
+	// SI base units; the gram carries the prefixes so that kg is k + g
+	"m":   prefixable(1, dimLength),
+	"g":   prefixable(1e-3, dimMass),
+	"s":   prefixable(1, dimTime),
+	"A":   prefixable(1, dimCurrent),
+	"K":   prefixable(1, dimTemperature),
+	"mol": prefixable(1, dimAmount),
+	"cd":  prefixable(1, dimLuminosity),
+
+	// SI derived units
+	"Hz":  prefixable(1, dimension{}.div(dimTime)),
+	"N":   prefixable(1, dimForce),
+	"Pa":  prefixable(1, dimPress),
+	"J":   prefixable(1, dimEnergy),
+	"W":   prefixable(1, dimPower),
+	"C":   prefixable(1, dimCharge),
+	"V":   prefixable(1, dimVolt),
+	"ohm": prefixable(1, dimVolt.div(dimCurrent)),
+	"S":   prefixable(1, dimCurrent.div(dimVolt)),
+	"F":   prefixable(1, dimCharge.div(dimVolt)),
+	"Wb":  prefixable(1, dimVolt.mul(dimTime)),
+	"T":   prefixable(1, dimVolt.mul(dimTime).div(dimArea)),
+	"H":   prefixable(1, dimVolt.mul(dimTime).div(dimCurrent)),
+
+	// Units accepted for use with SI
+	"L":   prefixable(1e-3, dimVolume),
+	"t":   prefixable(1000, dimMass),
+	"eV":  prefixable(1.602176634e-19, dimEnergy),
+	"Wh":  prefixable(3600, dimEnergy),
+	"bar": prefixable(1e5, dimPress),
+	"cal": prefixable(4.184, dimEnergy),
+	"min": fixed(60, dimTime),
+	"h":   fixed(3600, dimTime),
+	"day": fixed(86400, dimTime),
+	"ha":  fixed(1e4, dimArea),
+	"rad": fixed(1, dimension{}),
+	"deg": fixed(math.Pi/180, dimension{}),
+
+	// Imperial and US customary units
+	"in":    fixed(0.0254, dimLength),
+	"ft":    fixed(0.3048, dimLength),
+	"yd":    fixed(0.9144, dimLength),
+	"mi":    fixed(1609.344, dimLength),
+	"nmi":   fixed(1852, dimLength),
+	"lb":    fixed(0.45359237, dimMass),
+	"oz":    fixed(0.45359237/16, dimMass),
+	"gal":   fixed(3.785411784e-3, dimVolume),
+	"mph":   fixed(1609.344/3600, dimSpeed),
+	"knot":  fixed(1852.0/3600, dimSpeed),
+	"lbf":   fixed(4.4482216152605, dimForce),
+	"psi":   fixed(4.4482216152605/(0.0254*0.0254), dimPress),
+	"atm":   fixed(101325, dimPress),
+	"hp":    fixed(745.69987158227022, dimPower),
+	"BTU":   fixed(1055.05585262, dimEnergy),
+	"acre":  fixed(4046.8564224, dimArea),
+	"floz":  fixed(3.785411784e-3/128, dimVolume),
+	"ounce": fixed(0.45359237/16, dimMass),
+}
+
+// siPrefixes are tried longest first so that "da" wins over "d"
+var siPrefixes = []struct {
+	symbol string
+	factor float64
+}{
+	{"da", 1e1},
+	{"Y", 1e24}, {"Z", 1e21}, {"E", 1e18}, {"P", 1e15}, {"T", 1e12}, {"G", 1e9}, {"M", 1e6}, {"k", 1e3}, {"h", 1e2},
+	{"d", 1e-1}, {"c", 1e-2}, {"m", 1e-3}, {"u", 1e-6}, {"n", 1e-9}, {"p", 1e-12}, {"f", 1e-15}, {"a", 1e-18}, {"z", 1e-21}, {"y", 1e-24},
+}
+
+// lookupUnit resolves a unit symbol, with an optional SI prefix on prefixable units.
+// Exact symbols win, so min is a minute and Pa a pascal.
+func lookupUnit(name string) (unitDef, bool) {
+	if u, ok := units[name]; ok {
+		return u, true
+	}
+	for _, p := range siPrefixes {
+		base, ok := strings.CutPrefix(name, p.symbol)
+		if !ok {
+			continue
+		}
+		if u, ok := units[base]; ok && u.prefixable {
+			return unitDef{factor: p.factor * u.factor, dim: u.dim}, true
+		}
+	}
+	return unitDef{}, false
+}
+
+// namedUnits are the derived units preferred when a result has exactly their dimension
+var namedUnits = []string{"N", "J", "W", "Pa", "C", "V", "ohm", "F", "Wb", "T", "H"}
+
+// formatDimension returns the simplest SI unit for d, e.g. "m/s^2", "J" or "kg/(m*s^2)".
+// A dimensionless quantity has the empty unit.
+func formatDimension(d dimension) string {
+	if d.dimensionless() {
+		return ""
+	}
+	for _, name := range namedUnits {
+		if units[name].dim == d {
+			return name
+		}
+	}
+
+	var num, den []string
+	for _, b := range baseUnitSymbols {
+		e := d[b.index]
+		switch {
+		case e == 1:
+			num = append(num, b.symbol)
+		case e > 1:
+			num = append(num, fmt.Sprintf("%s^%d", b.symbol, e))
+		case e == -1:
+			den = append(den, b.symbol)
+		case e < -1:
+			den = append(den, fmt.Sprintf("%s^%d", b.symbol, -e))
+		}
+	}
+
+	unit := strings.Join(num, "*")
+	if unit == "" {
+		unit = "1"
+	}
+	switch len(den) {
+	case 0:
+		return unit
+	case 1:
+		return unit + "/" + den[0]
+	}
+	return unit + "/(" + strings.Join(den, "*") + ")"
+}
+
+// describeDimension names the SI unit of d for error messages
+func describeDimension(d dimension) string {
+	if d.dimensionless() {
+		return "a dimensionless number"
+	}
+	return formatDimension(d)
+}
+
+// quantity is a number with a dimension; value is expressed in SI base units
+type quantity struct {
+	value float64
+	dim   dimension
+}
+
+// errIncompatibleUnits reports an operation on quantities whose dimensions do not fit together
+var errIncompatibleUnits = errors.New("incompatible units")
+
+// unitResult is a units mode result: value expressed in unit, "" for a dimensionless number
+type unitResult struct {
+	value float64
+	unit  string
+}
+
+// unitEvaluator evaluates an AST over quantities. Session variables are dimensionless.
+type unitEvaluator struct {
+	vars map[string]float64
+}
+
+// evaluateStatementUnits evaluates an expression with units. The result is given in the target
+// of a 'to' conversion, or otherwise in the simplest SI unit of its dimension.
+func evaluateStatementUnits(expr string, vars map[string]float64) (unitResult, error) {
+	stmt, err := parseStatementSyntax(expr, syntaxUnits)
+	if err == nil {
+		err = rejectLogical(stmt.expr)
+	}
+	if err != nil {
+		return unitResult{}, err
+	}
+	if stmt.target != "" {
+		start := strings.Index(expr, stmt.target)
+		return unitResult{}, newExprError(errKindUnsupported, start, start+len(stmt.target),
+			"assignment is not supported in mode 'units', since variables hold plain numbers")
+	}
+
+	ev := &unitEvaluator{vars: vars}
+	var result unitResult
+	if conv, ok := stmt.expr.(*binaryNode); ok && conv.op == "to" {
+		result, err = ev.convert(expr, conv)
+	} else {
+		var q quantity
+		q, err = ev.eval(stmt.expr)
+		result = unitResult{value: q.value, unit: formatDimension(q.dim)}
+	}
+	if err != nil {
+		return unitResult{}, err
+	}
+	if math.IsNaN(result.value) {
+		return unitResult{}, newExprError(errKindInvalidResult, 0, len(expr), "Calculation resulted in an invalid number (NaN)")
+	}
+	return result, nil
+}
+
+// convert evaluates "quantity to unit", expressing the quantity as a multiple of the target unit
+func (ev *unitEvaluator) convert(expr string, n *binaryNode) (unitResult, error) {
+	q, err := ev.eval(n.left)
+	if err != nil {
+		return unitResult{}, err
+	}
+	target, err := ev.eval(n.right)
+	if err != nil {
+		return unitResult{}, err
+	}
+	if q.dim != target.dim {
+		return unitResult{}, nodeError(errKindDimension, n.right, "%v: cannot convert %s to %s", errIncompatibleUnits, describeDimension(q.dim), describeDimension(target.dim))
+	}
+	if target.value == 0 {
+		return unitResult{}, nodeError(errKindDivisionByZero, n.right, "cannot convert to a zero quantity")
+	}
+	start, end := n.right.span()
+	return unitResult{value: q.value / target.value, unit: strings.TrimSpace(expr[start:end])}, nil
+}
+
+func (ev *unitEvaluator) eval(n node) (quantity, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return quantity{value: n.value}, nil
+
+	case *identNode:
+		return ev.lookup(n)
+
+	case *unaryNode:
+		q, err := ev.eval(n.operand)
+		if n.op == "-" {
+			q.value = -q.value
+		}
+		return q, err
+
+	case *percentNode:
+		q, err := ev.eval(n.operand)
+		q.value /= 100
+		return q, err
+
+	case *factorialNode:
+		q, err := ev.eval(n.operand)
+		if err != nil {
+			return quantity{}, err
+		}
+		if !q.dim.dimensionless() {
+			return quantity{}, nodeError(errKindDimension, n, "%v: factorial requires a dimensionless operand, got %s", errIncompatibleUnits, describeDimension(q.dim))
+		}
+		v, err := factorialFloat(q.value, n.double)
+		if err != nil {
+			return quantity{}, nodeError(errKindDomain, n, "%v", err)
+		}
+		return quantity{value: v}, nil
+
+	case *binaryNode:
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return quantity{}, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return quantity{}, err
+		}
+		if relativePercent(n) {
+			right, _ = applyBinaryUnits("*", left, right)
+		}
+		result, err := applyBinaryUnits(n.op, left, right)
+		switch {
+		case errors.Is(err, errDivisionByZero) || errors.Is(err, errModuloByZero):
+			return quantity{}, nodeError(errKindDivisionByZero, n.right, "%v", err)
+		case errors.Is(err, errIncompatibleUnits):
+			return quantity{}, nodeError(errKindDimension, n, "%v", err)
+		case err != nil:
+			return quantity{}, nodeError(errKindSyntax, n, "%v", err)
+		}
+		return result, nil
+
+	case *callNode:
+		return ev.call(n)
+	}
+
+	start, end := n.span()
+	return quantity{}, newExprError(errKindSyntax, start, end, "unsupported expression node %T", n)
+}
+
+// lookup resolves a unit symbol, session variable or named constant. Units take precedence, so
+// a variable named like a unit (m, s, h) is hidden in units mode.
+func (ev *unitEvaluator) lookup(n *identNode) (quantity, error) {
+	if u, ok := lookupUnit(n.name); ok {
+		return quantity{value: u.factor, dim: u.dim}, nil
+	}
+	if v, ok := ev.vars[n.name]; ok {
+		return quantity{value: v}, nil
+	}
+	if v, ok := mathConstants[n.name]; ok {
+		return quantity{value: v}, nil
+	}
+	candidates := append(sortedKeys(units), constantNames()...)
+	candidates = append(candidates, sortedKeys(ev.vars)...)
+	return quantity{}, nodeError(errKindUnknownIdentifier, n, "unknown unit, variable or constant '%s'%s", n.name, suggestion(n.name, candidates))
+}
+
+// applyBinaryUnits applies an arithmetic operator to quantities, checking their dimensions
+func applyBinaryUnits(op string, left, right quantity) (quantity, error) {
+	switch op {
+	case "+", "-", "%":
+		if left.dim != right.dim {
+			verb := map[string]string{"+": "add", "-": "subtract", "%": "take the modulo of"}[op]
+			return quantity{}, fmt.Errorf("%w: cannot %s %s and %s", errIncompatibleUnits, verb, describeDimension(left.dim), describeDimension(right.dim))
+		}
+		v, err := applyBinary(op, left.value, right.value)
+		return quantity{value: v, dim: left.dim}, err
+	case "//":
+		if left.dim != right.dim {
+			return quantity{}, fmt.Errorf("%w: cannot floor divide %s by %s", errIncompatibleUnits, describeDimension(left.dim), describeDimension(right.dim))
+		}
+		v, err := applyBinary(op, left.value, right.value)
+		return quantity{value: v}, err
+	case "*":
+		return quantity{value: left.value * right.value, dim: left.dim.mul(right.dim)}, nil
+	case "/":
+		v, err := applyBinary(op, left.value, right.value)
+		return quantity{value: v, dim: left.dim.div(right.dim)}, err
+	case "^":
+		if !right.dim.dimensionless() {
+			return quantity{}, fmt.Errorf("%w: the exponent must be dimensionless, got %s", errIncompatibleUnits, describeDimension(right.dim))
+		}
+		dim, ok := left.dim.pow(right.value)
+		if !ok {
+			return quantity{}, fmt.Errorf("%w: %s raised to %s does not give whole powers of units", errIncompatibleUnits, describeDimension(left.dim), formatResult(right.value))
+		}
+		v, err := applyBinary(op, left.value, right.value)
+		return quantity{value: v, dim: dim}, err
+	}
+	return quantity{}, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// unitRoots are the functions that take a root of their argument's dimension
+var unitRoots = map[string]float64{"sqrt": 0.5, "cbrt": 1.0 / 3}
+
+// call applies a built-in function. sqrt and cbrt take roots of units, abs, min and max keep the
+// unit of their arguments, and every other function requires dimensionless arguments (angles in
+// rad or deg are dimensionless).
+func (ev *unitEvaluator) call(n *callNode) (quantity, error) {
+	fn, ok := builtinFunctions[n.name]
+	if !ok {
+		return quantity{}, newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+			"unknown function '%s' at position %d%s", n.name, n.start, suggestion(n.name, builtinFunctionNames()))
+	}
+	if err := fn.checkArity(n.name, len(n.args)); err != nil {
+		return quantity{}, nodeError(errKindArity, n, "%v", err)
+	}
+
+	args := make([]quantity, len(n.args))
+	values := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		q, err := ev.eval(arg)
+		if err != nil {
+			return quantity{}, err
+		}
+		args[i], values[i] = q, q.value
+	}
+
+	var dim dimension
+	switch root, isRoot := unitRoots[n.name]; {
+	case isRoot:
+		var ok bool
+		if dim, ok = args[0].dim.pow(root); !ok {
+			return quantity{}, nodeError(errKindDimension, n, "%v: %s(%s) does not give whole powers of units", errIncompatibleUnits, n.name, describeDimension(args[0].dim))
+		}
+	case n.name == "abs" || n.name == "min" || n.name == "max":
+		dim = args[0].dim
+		for i, q := range args {
+			if q.dim != dim {
+				return quantity{}, nodeError(errKindDimension, n.args[i], "%v: %s arguments must share a unit, got %s and %s", errIncompatibleUnits, n.name, describeDimension(dim), describeDimension(q.dim))
+			}
+		}
+	default:
+		for i, q := range args {
+			if !q.dim.dimensionless() {
+				return quantity{}, nodeError(errKindDimension, n.args[i], "%v: %s requires a dimensionless argument, got %s", errIncompatibleUnits, n.name, describeDimension(q.dim))
+			}
+		}
+	}
+
+	result, err := fn.apply(values)
+	if err != nil {
+		return quantity{}, nodeError(errKindDomain, n, "%s: %v", n.name, err)
+	}
+	return quantity{value: result, dim: dim}, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluateStatementUnits(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value string
+		unit  string
+	}{
+		{"5 km / 20 min", "4.166666667", "m/s"},
+		{"5 km/20 min to m/s", "4.166666667", "m/s"},
+		{"5 km / 20 min to km/h", "15", "km/h"},
+		{"60 mph to km/h", "96.56064", "km/h"},
+		{"2 kg * 9.81 m/s^2", "19.62", "N"},
+		{"3 N m", "3", "J"},
+		{"1 kWh to J", "3600000", "J"},
+		{"12 in + 1 ft to cm", "60.96", "cm"},
+		{"sqrt(16 m^2)", "4", "m"},
+		{"10 m / 2 m", "5", ""},
+		{"sin(90 deg)", "1", ""},
+		{"max(1 m, 50 cm) to mm", "1000", "mm"},
+		{"1 / 2 s", "0.5", "1/s"},
+		{"-5 km + 2000 m", "-3000", "m"},
+		{"2 mol / 4 L to mol/L", "0.5", "mol/L"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := evaluateStatementUnits(tt.expr, nil)
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tt.expr, err)
+			}
+			if got := formatResult(result.value); got != tt.value {
+				t.Errorf("%q: expected %s, got %s", tt.expr, tt.value, got)
+			}
+			if result.unit != tt.unit {
+				t.Errorf("%q: expected unit %q, got %q", tt.expr, tt.unit, result.unit)
+			}
+		})
+	}
+}
+
+func TestEvaluateStatementUnitsErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"5 m + 3 s", errKindDimension, "5 m + 3 s"},
+		{"5 km to s", errKindDimension, "s"},
+		{"sqrt(2 m)", errKindDimension, "sqrt(2 m)"},
+		{"sin(3 m)", errKindDimension, "3 m"},
+		{"2 ^ s", errKindDimension, "2 ^ s"},
+		{"5 furlong", errKindUnknownIdentifier, "furlong"},
+		{"5 m / 0 s", errKindDivisionByZero, "0 s"},
+		{"x = 5 m", errKindUnsupported, "x"},
+		{"1 m < 2 m", errKindUnsupported, "<"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := evaluateStatementUnits(tt.expr, nil)
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestUnitsModeVariables(t *testing.T) {
+	result, err := evaluateStatementUnits("d * 1 km / 2 h to km/h", map[string]float64{"d": 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := formatResult(result.value); got != "50" || result.unit != "km/h" {
+		t.Errorf("expected 50 km/h, got %s %s", got, result.unit)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Limits of user-defined functions: maxCallDepth bounds nested calls, stopping runaway recursion,
+// and maxFunctionCalls the calls in one evaluation, stopping recursion that branches, such as a
+// naive fib(60), which stays shallow but would make 10^12 calls
+const (
+	maxCallDepth     = 100
+	maxFunctionCalls = 100_000
+)
+
+// userFunction is a function defined in a session, e.g. f(x, y) = x^2 + y
+type userFunction struct {
+	name   string
+	params []string
+	body   node
+	source string // the body as written
+}
+
+// signature returns the function head, e.g. "f(x, y)"
+func (f *userFunction) signature() string {
+	return f.name + "(" + strings.Join(f.params, ", ") + ")"
+}
+
+// parseDefinition recognizes a function definition of the form "name(params) = body".
+// isDefinition is false when expr is not a definition and should be evaluated as a statement;
+// a malformed definition returns isDefinition true together with the error.
+func parseDefinition(expr string) (fn *userFunction, isDefinition bool, err error) {
+	tokens, err := tokenize(expr, syntaxStandard)
+	if err != nil || len(tokens) < 3 || tokens[0].kind != tokenIdent || tokens[1].kind != tokenLParen {
+		return nil, false, nil
+	}
+	eq := slices.IndexFunc(tokens, func(t token) bool { return t.kind == tokenOperator && t.text == "=" })
+	if eq < 0 {
+		return nil, false, nil
+	}
+
+	name := tokens[0].text
+	fn = &userFunction{name: name}
+	p := &parser{tokens: tokens, pos: 2}
+	for {
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, true, tokenError(errKindInvalidDefinition, t, "expected a parameter name at position %d in the definition of '%s'", t.pos, name).withExpected("identifier")
+		}
+		fn.params = append(fn.params, t.text)
+		t = p.next()
+		if t.kind == tokenRParen {
+			break
+		}
+		if t.kind != tokenComma {
+			return nil, true, tokenError(errKindInvalidDefinition, t, "unexpected %s at position %d in the parameter list of '%s'", t.describe(), t.pos, name).withExpected(",", ")")
+		}
+	}
+	if t := p.next(); t.kind != tokenOperator || t.text != "=" {
+		return nil, true, tokenError(errKindInvalidDefinition, t, "unexpected %s at position %d, expected '=' after %s", t.describe(), t.pos, fn.signature()).withExpected("=")
+	}
+	if t := p.peek(); t.kind == tokenEOF {
+		return nil, true, tokenError(errKindInvalidDefinition, t, "missing body in the definition of %s", fn.signature()).withExpected(expectedOperand...)
+	}
+
+	body, err := p.parseExpression()
+	if err != nil {
+		return nil, true, err
+	}
+	fn.body = body
+	start, _ := body.span()
+	fn.source = strings.TrimSpace(expr[start:])
+	return fn, true, nil
+}
+
+// validateDefinition checks a definition against the session before it is stored: the name must
+// not clash with a built-in, parameters must be distinct, and the body may only use its
+// parameters, constants, session variables and known functions with the right number of arguments.
+// Calls to fn itself are allowed, so functions may be recursive.
+func validateDefinition(expr string, fn *userFunction, vars map[string]float64, funcs map[string]*userFunction) error {
+	// The name may be preceded by whitespace; errors about the head cover the name
+	nameStart := strings.Index(expr, fn.name)
+	nameEnd := nameStart + len(fn.name)
+	if keywords[fn.name] {
+		return newExprError(errKindInvalidDefinition, nameStart, nameEnd, "cannot define a function named after the keyword '%s'", fn.name)
+	}
+	if _, ok := builtinFunctions[fn.name]; ok {
+		return newExprError(errKindInvalidDefinition, nameStart, nameEnd, "cannot redefine built-in function '%s'", fn.name)
+	}
+	if _, ok := mathConstants[fn.name]; ok {
+		return newExprError(errKindInvalidDefinition, nameStart, nameEnd, "cannot define a function named after the constant '%s'", fn.name)
+	}
+
+	// Parameters are checked like variables, so the body sees them alongside the session variables
+	scope := maps.Clone(vars)
+	if scope == nil {
+		scope = make(map[string]float64)
+	}
+	for i, param := range fn.params {
+		if slices.Contains(fn.params[:i], param) {
+			return newExprError(errKindInvalidDefinition, nameStart, nameEnd, "duplicate parameter '%s' in %s", param, fn.signature())
+		}
+		if keywords[param] {
+			return newExprError(errKindInvalidDefinition, nameStart, nameEnd, "parameter '%s' is a keyword", param)
+		}
+		if _, ok := mathConstants[param]; ok {
+			return newExprError(errKindInvalidDefinition, nameStart, nameEnd, "parameter '%s' would hide the constant '%s'", param, param)
+		}
+		scope[param] = 0
+	}
+
+	arity := func(name string) (builtinFunction, bool) {
+		if name == fn.name {
+			return builtinFunction{minArgs: len(fn.params), maxArgs: len(fn.params)}, true
+		}
+		if f, ok := funcs[name]; ok {
+			return builtinFunction{minArgs: len(f.params), maxArgs: len(f.params)}, true
+		}
+		f, ok := builtinFunctions[name]
+		return f, ok
+	}
+
+	var check func(n node) error
+	check = func(n node) error {
+		switch n := n.(type) {
+		case *identNode:
+			_, err := (&evaluator{vars: scope}).lookupIdentifier(n)
+			return err
+		case *unaryNode:
+			return check(n.operand)
+		case *percentNode:
+			return check(n.operand)
+		case *factorialNode:
+			return check(n.operand)
+		case *conditionalNode:
+			for _, part := range []node{n.cond, n.then, n.otherwise} {
+				if err := check(part); err != nil {
+					return err
+				}
+			}
+		case *binaryNode:
+			if err := check(n.left); err != nil {
+				return err
+			}
+			return check(n.right)
+		case *callNode:
+			f, ok := arity(n.name)
+			if !ok {
+				names := append(builtinFunctionNames(), sortedKeys(funcs)...)
+				return newExprError(errKindUnknownFunction, n.start, n.start+len(n.name),
+					"unknown function '%s' at position %d%s", n.name, n.start, suggestion(n.name, append(names, fn.name)))
+			}
+			if err := f.checkArity(n.name, len(n.args)); err != nil {
+				return nodeError(errKindArity, n, "%v", err)
+			}
+			for _, arg := range n.args {
+				if err := check(arg); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return check(fn.body)
+}
+
+// callUser evaluates a call of a user-defined function. Errors raised in the body are reported
+// at the call site, since their offsets refer to the definition rather than the expression.
+func (ev *evaluator) callUser(n *callNode, fn *userFunction) (float64, error) {
+	arity := builtinFunction{minArgs: len(fn.params), maxArgs: len(fn.params)}
+	if err := arity.checkArity(n.name, len(n.args)); err != nil {
+		return 0, nodeError(errKindArity, n, "%v", err)
+	}
+	if ev.depth >= maxCallDepth {
+		return 0, nodeError(errKindRecursionLimit, n, "maximum call depth of %d exceeded calling %s; check the definition for runaway recursion", maxCallDepth, fn.signature())
+	}
+	if ev.ctx != nil && ev.ctx.Err() != nil {
+		return 0, ev.ctx.Err()
+	}
+	if ev.calls == nil {
+		ev.calls = new(int)
+	}
+	if *ev.calls++; *ev.calls > maxFunctionCalls {
+		return 0, nodeError(errKindRecursionLimit, n, "more than %d function calls in one evaluation, calling %s; check the definition for recursion that branches", maxFunctionCalls, fn.signature())
+	}
+
+	locals := make(map[string]float64, len(fn.params))
+	for i, arg := range n.args {
+		val, err := ev.eval(arg)
+		if err != nil {
+			return 0, err
+		}
+		locals[fn.params[i]] = val
+	}
+
+	result, err := (&evaluator{ctx: ev.ctx, vars: ev.vars, locals: locals, funcs: ev.funcs, depth: ev.depth + 1, calls: ev.calls, tolerance: ev.tolerance}).eval(fn.body)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, err
+	}
+	if err != nil {
+		e := asExprError(err, errKindSyntax)
+		start, end := n.span()
+		if e.Kind == errKindRecursionLimit {
+			return 0, newExprError(e.Kind, start, end, "%s", e.Message)
+		}
+		return 0, newExprError(e.Kind, start, end, "in %s: %s", fn.signature(), e.Message)
+	}
+	return result, nil
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
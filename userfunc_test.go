@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDefinition(t *testing.T) {
+	fn, ok, err := parseDefinition("f(x, y) = x^2 + y")
+	if !ok || err != nil {
+		t.Fatalf("expected a definition, got ok=%v err=%v", ok, err)
+	}
+	if fn.name != "f" || !reflect.DeepEqual(fn.params, []string{"x", "y"}) || fn.source != "x^2 + y" {
+		t.Errorf("unexpected definition: %+v", fn)
+	}
+
+	for _, expr := range []string{"f(3, 4)", "x = f(2)", "2 + 3"} {
+		if _, ok, _ := parseDefinition(expr); ok {
+			t.Errorf("%q: should not be a definition", expr)
+		}
+	}
+
+	tests := []struct {
+		expr string
+		text string
+	}{
+		{"f(1) = 2", "1"},
+		{"f(x y) = x", "y"},
+		{"f(x) + 1 = 2", "+"},
+		{"f(x) = ", ""},
+		{"f() = 1", ")"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, ok, err := parseDefinition(tt.expr)
+			var e *exprError
+			if !ok || !errors.As(err, &e) {
+				t.Fatalf("expected a definition error, got ok=%v err=%v", ok, err)
+			}
+			if e.Kind != errKindInvalidDefinition {
+				t.Errorf("expected kind %q, got %q (%s)", errKindInvalidDefinition, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestValidateDefinition(t *testing.T) {
+	vars := map[string]float64{"a": 2}
+	funcs := map[string]*userFunction{"g": {name: "g", params: []string{"x"}}}
+	tests := []struct {
+		expr string
+		kind exprErrorKind
+		text string
+	}{
+		{"f(x) = a*x + g(x) + f(x - 1)", "", ""},
+		{"sqrt(x) = x", errKindInvalidDefinition, "sqrt"},
+		{" pi(x) = x", errKindInvalidDefinition, "pi"},
+		{"f(x, x) = x", errKindInvalidDefinition, "f"},
+		{"f(e) = e", errKindInvalidDefinition, "f"},
+		{"f(x) = x + y", errKindUnknownIdentifier, "y"},
+		{"f(x) = sqrt", errKindUnknownIdentifier, "sqrt"},
+		{"f(x) = h(x)", errKindUnknownFunction, "h"},
+		{"f(x) = g(x, 1)", errKindArity, "g(x, 1)"},
+		{"f(x, y) = f(x)", errKindArity, "f(x)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			fn, _, err := parseDefinition(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			err = validateDefinition(tt.expr, fn, vars, funcs)
+			if tt.kind == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind {
+				t.Errorf("expected kind %q, got %q (%s)", tt.kind, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestCallUserFunction(t *testing.T) {
+	funcs := map[string]*userFunction{}
+	for _, def := range []string{"f(x, y) = x^2 + y", "g(x) = 1/(x - 1)", "loop(x) = loop(x) + 1", "scaled(x) = k*x", "fib(n) = n < 2 ? n : fib(n-1) + fib(n-2)"} {
+		fn, _, err := parseDefinition(def)
+		if err != nil {
+			t.Fatalf("%q: %v", def, err)
+		}
+		funcs[fn.name] = fn
+	}
+	vars := map[string]float64{"k": 10, "x": 100}
+
+	tests := []struct {
+		expr     string
+		expected float64
+		kind     exprErrorKind
+		text     string
+		message  string
+	}{
+		{expr: "f(3, 4)", expected: 13},
+		{expr: "f(f(1, 1), x)", expected: 104},
+		{expr: "scaled(2) + x", expected: 120},
+		{expr: "1 + g(1)", kind: errKindDivisionByZero, text: "g(1)", message: "in g(x): division by zero is not allowed"},
+		{expr: "2 * loop(0)", kind: errKindRecursionLimit, text: "loop(0)", message: "maximum call depth of 100 exceeded"},
+		{expr: "fib(20)", expected: 6765},
+		{expr: "fib(60)", kind: errKindRecursionLimit, text: "fib(60)", message: "more than 100000 function calls"},
+		{expr: "f(1)", kind: errKindArity, text: "f(1)", message: "function 'f' expects 2 arguments, got 1"},
+		{expr: "ff(1, 2)", kind: errKindUnknownFunction, text: "ff", message: "(did you mean 'f'?)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, result, _, err := evaluateSessionStatement(context.Background(), tt.expr, vars, funcs, 0)
+			if tt.kind == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if result != tt.expected {
+					t.Errorf("expected %v, got %v", tt.expected, result)
+				}
+				return
+			}
+			var e *exprError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *exprError, got %T: %v", err, err)
+			}
+			if e.Kind != tt.kind || !strings.Contains(e.Message, tt.message) {
+				t.Errorf("expected %q error containing %q, got %q: %s", tt.kind, tt.message, e.Kind, e.Message)
+			}
+			if got := tt.expr[e.Start:e.End]; got != tt.text {
+				t.Errorf("expected error to cover %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestCallUserFunctionCancelled(t *testing.T) {
+	fn, _, _ := parseDefinition("f(x) = x + 1")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := evaluateSessionStatement(ctx, "f(f(1))", nil, map[string]*userFunction{"f": fn}, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestSessionFunctions(t *testing.T) {
+	cs, _ := connectTestClient(t)
+
+	var out calculateOutput
+	callTool(t, cs, "calculate", map[string]any{"expression": "f(x, y) = x^2 + y"}, &out)
+	if out.Result != "Defined: f(x, y) = x^2 + y" {
+		t.Errorf("unexpected definition result: %q", out.Result)
+	}
+	callTool(t, cs, "calculate", map[string]any{"expression": "f(3, 4)"}, &out)
+	if out.Result != "Result: f(3, 4) = 13" {
+		t.Errorf("unexpected call result: %q", out.Result)
+	}
+
+	res := callTool(t, cs, "calculate", map[string]any{"expression": "h(x) = x + y"}, &out)
+	if !res.IsError || out.Error == nil || out.Error.Kind != errKindUnknownIdentifier {
+		t.Errorf("expected the definition to be rejected, got %q", resultText(res))
+	}
+
+	var list functionsOutput
+	callTool(t, cs, "functions", nil, &list)
+	if !reflect.DeepEqual(list.Functions, map[string]string{"f(x, y)": "x^2 + y"}) {
+		t.Errorf("unexpected functions: %v", list.Functions)
+	}
+
+	callTool(t, cs, "functions", map[string]any{"action": "clear", "name": "f"}, nil)
+	res = callTool(t, cs, "calculate", map[string]any{"expression": "f(3, 4)"}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "unknown function 'f'") {
+		t.Errorf("expected deleted function to be unknown, got %q", resultText(res))
+	}
+	if res := callTool(t, cs, "functions", map[string]any{"action": "clear", "name": "f"}, nil); !res.IsError {
+		t.Errorf("expected error deleting an undefined function")
+	}
+}